@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"obx/protocol/btsnoop"
+	"os"
+)
+
+// runBtsnoop converts the UBoom X traffic of a btsnoop HCI log into a JSONL session on stdout.
+func runBtsnoop(args []string) {
+	flags := flag.NewFlagSet("btsnoop", flag.ExitOnError)
+	channel := flags.Uint("channel", 2, "RFCOMM channel of the speaker")
+	address := flags.String("address", "", "Only keep traffic of the device with this MAC address")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: OpenBoomX btsnoop [-channel 2] [-address MAC] btsnoop_hci.log > session.jsonl")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *channel < 1 || *channel > 30 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening btsnoop log:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	entries, err := btsnoop.ExtractSession(file, btsnoop.Options{Channel: uint8(*channel), Address: *address})
+	encoder := json.NewEncoder(os.Stdout)
+	for _, entry := range entries {
+		if encodeErr := encoder.Encode(entry); encodeErr != nil {
+			fmt.Fprintln(os.Stderr, "Error writing session:", encodeErr)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		// the entries up to a truncated record are still useful, a capture may be copied while it is written
+		fmt.Fprintln(os.Stderr, "Error reading btsnoop log:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"obx/protocol"
+	"os"
+	"strings"
+)
+
+// runDecode explains the hex frames given as arguments, or read line by line from stdin if there are none.
+// A line may hold several frames. It exits with status 1 if any input couldn't be decoded.
+func runDecode(args []string) {
+	ok := true
+	if len(args) > 0 {
+		for _, arg := range args {
+			ok = decodeLine(arg) && ok
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			ok = decodeLine(scanner.Text()) && ok
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading stdin:", err)
+			ok = false
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func decodeLine(line string) bool {
+	hexMsg := strings.Join(strings.Fields(line), "")
+	data, err := hex.DecodeString(hexMsg)
+	if err != nil {
+		fmt.Printf("%s: invalid hex: %v\n", line, err)
+		return false
+	}
+
+	var buffer protocol.FrameBuffer
+	buffer.Write(data)
+	ok := true
+	for {
+		frame, err := buffer.Next()
+		if errors.Is(err, protocol.ErrIncompleteFrame) {
+			break
+		}
+		var garbage *protocol.GarbageError
+		if errors.As(err, &garbage) {
+			fmt.Printf("%x: not a frame\n", garbage.Data)
+			ok = false
+			continue
+		}
+		fmt.Printf("%s: %s\n", frame, protocol.Describe(frame))
+	}
+
+	if buffer.Len() > 0 {
+		fmt.Printf("%s: incomplete frame\n", hexMsg[len(hexMsg)-2*buffer.Len():])
+		ok = false
+	}
+	return ok
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"obx/protocol"
+	"obx/utils/registry"
+	"os"
+	"time"
+)
+
+// runDevices lists the known speakers, or names or forgets one of them.
+func runDevices(args []string) {
+	flags := flag.NewFlagSet("devices", flag.ExitOnError)
+	device := flags.String("device", "", "Speaker to name or forget: its MAC address or nickname")
+	nickname := flags.String("nickname", "", "Name the speaker, so it can be connected with -device <nickname>")
+	forget := flags.Bool("forget", false, "Remove the speaker from the known speakers")
+	flags.Parse(args)
+
+	known, err := registry.Open()
+	exitOnError("error opening device registry", err)
+
+	if *device == "" {
+		if *nickname != "" || *forget {
+			fmt.Fprintln(os.Stderr, "-nickname and -forget need -device")
+			os.Exit(2)
+		}
+		printDevices(known.Devices())
+		return
+	}
+
+	address, err := protocol.ParseMAC(*device)
+	if err != nil {
+		found, ok := known.Find(*device)
+		if !ok {
+			exitOnError("unknown speaker", fmt.Errorf("%s is neither a MAC address nor the nickname of a known speaker", *device))
+		}
+		address = found.Address
+	}
+
+	switch {
+	case *forget:
+		exitOnError("error forgetting speaker", known.Forget(address))
+		fmt.Printf("Forgot %s\n", address)
+	case flagSet(flags, "nickname"):
+		exitOnError("error naming speaker", known.SetNickname(address, *nickname))
+		fmt.Printf("Named %s %q\n", address, *nickname)
+	default:
+		found, ok := known.Find(address.String())
+		if !ok {
+			exitOnError("unknown speaker", fmt.Errorf("%s is not a known speaker", address))
+		}
+		printDevices([]registry.Device{found})
+	}
+}
+
+func printDevices(devices []registry.Device) {
+	if len(devices) == 0 {
+		fmt.Println("No known speakers, connect to one first")
+		return
+	}
+	for _, device := range devices {
+		lastConnected := "never"
+		if !device.LastConnected.IsZero() {
+			lastConnected = device.LastConnected.Format(time.DateTime)
+		}
+		fmt.Printf("%-12s  %s  %-16s  %-24s  last connected %s\n", device.Nickname, device.Address, device.Model, device.Firmware, lastConnected)
+	}
+}
+
+// flagSet reports whether the flag was given, even if it is empty.
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"obx/protocol"
+	"obx/protocol/explorer"
+	"obx/utils/bluetooth"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runExplore sweeps read requests over a range of opcodes and payloads and appends every result to a JSONL report.
+func runExplore(args []string) {
+	flags := flag.NewFlagSet("explore", flag.ExitOnError)
+	device := flags.String("device", "", "Speaker to connect to, see the main usage. Scans for the speaker if empty")
+	opcodes := flags.String("opcodes", "00-ff", "Opcodes to probe: comma separated hex bytes or ranges, e.g. 10,14,20-2f")
+	payloads := flags.String("payloads", "", "Payloads to send with each opcode: comma separated hex payloads or ranges of single bytes, e.g. ',00-03,0101'. An empty entry is an empty payload")
+	deny := flags.String("deny", "", "Opcodes to never send on top of the built-in denylist, same format as -opcodes")
+	interval := flags.Duration("interval", 500*time.Millisecond, fmt.Sprintf("Time between two probes, at least %s", explorer.MinInterval))
+	wait := flags.Duration("wait", time.Second, "How long to collect replies after each probe")
+	report := flags.String("report", "explore.jsonl", "JSONL report, every probe is appended as soon as it is done")
+	resume := flags.Bool("resume", false, "Continue a sweep, skipping the probes that are already in the report")
+	flags.Parse(args)
+
+	opcodeList, err := parseByteRanges(*opcodes)
+	exitOnError("invalid -opcodes", err)
+	denyList, err := parseByteRanges(*deny)
+	exitOnError("invalid -deny", err)
+	payloadList, err := parsePayloads(*payloads)
+	exitOnError("invalid -payloads", err)
+
+	done := map[string]bool{}
+	if *resume {
+		done, err = readReport(*report)
+		exitOnError("error reading report", err)
+	} else if _, err := os.Stat(*report); err == nil {
+		exitOnError("error creating report", fmt.Errorf("%s already exists, use -resume to continue it", *report))
+	}
+
+	file, err := os.OpenFile(*report, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	exitOnError("error opening report", err)
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dialCtx, cancel := context.WithTimeout(ctx, commandTimeout)
+	rfcomm, selected, err := bluetooth.DialUBoomX(dialCtx, *device)
+	cancel()
+	exitOnError("error connecting to speaker", err)
+
+	client := protocol.NewSpeakerClient(rfcomm, bluetooth.ModelOf(selected))
+	defer client.CloseConnection()
+
+	sweep, err := explorer.NewExplorer(client, *interval, *wait, denyList)
+	exitOnError("invalid explorer settings", err)
+
+	probes := explorer.Probes(opcodeList, payloadList)
+	fmt.Printf("Probing %d requests, %d already done\n", len(probes), len(done))
+
+	err = sweep.Run(ctx, probes, done, func(result explorer.Result) error {
+		if len(result.Replies) > 0 {
+			fmt.Printf("%s: %d replies\n", result.Request, len(result.Replies))
+			for _, reply := range result.Replies {
+				fmt.Printf("  %s after %s: %s\n", reply.Hex, reply.Latency.Round(time.Microsecond), reply.Description)
+			}
+		}
+		return encoder.Encode(result)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Sweep stopped, continue it with -resume:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Sweep finished, report written to", *report)
+}
+
+func exitOnError(message string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", message, err)
+		os.Exit(1)
+	}
+}
+
+// readReport returns the requests of a report, a missing report is an empty one.
+func readReport(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var result explorer.Result
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		// probes that lost the connection are tried again
+		if result.Error == "" {
+			done[result.Request] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+// parseByteRanges parses "10,14,20-2f" into the listed bytes.
+func parseByteRanges(spec string) ([]byte, error) {
+	var values []byte
+	if spec == "" {
+		return values, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			last = first
+		}
+		from, err := strconv.ParseUint(first, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte %q", first)
+		}
+		to, err := strconv.ParseUint(last, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte %q", last)
+		}
+		if from > to {
+			return nil, fmt.Errorf("invalid range %q", item)
+		}
+		for value := from; value <= to; value++ {
+			values = append(values, byte(value))
+		}
+	}
+	return values, nil
+}
+
+// parsePayloads parses ",00-03,0101" into an empty payload, the single byte payloads 00 to 03 and 0101.
+func parsePayloads(spec string) ([][]byte, error) {
+	var payloads [][]byte
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "-") {
+			values, err := parseByteRanges(item)
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				payloads = append(payloads, []byte{value})
+			}
+			continue
+		}
+
+		payload, err := hex.DecodeString(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload %q", item)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
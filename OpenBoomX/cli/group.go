@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"obx/protocol"
+	"obx/utils/bluetooth"
+	"os"
+	"strings"
+)
+
+// deviceList collects repeated -device flags.
+type deviceList []string
+
+func (devices *deviceList) String() string {
+	return strings.Join(*devices, ", ")
+}
+
+func (devices *deviceList) Set(device string) error {
+	*devices = append(*devices, device)
+	return nil
+}
+
+// runGroup sends command to all devices in parallel and prints the result of every speaker.
+// It exits with 1 if any speaker couldn't be connected or failed the command.
+func runGroup(ctx context.Context, devices []string, command func(ctx context.Context, client protocol.ISpeakerClient) error) {
+	group, results := bluetooth.ConnectUBoomXGroup(ctx, devices)
+	commandErrors := map[string]error{}
+	for _, result := range group.Do(ctx, nil, command) {
+		commandErrors[result.Device] = result.Err
+	}
+	_ = group.CloseConnection()
+
+	failed := false
+	for _, result := range results {
+		err := result.Err
+		if err == nil {
+			err = commandErrors[result.Device]
+		}
+		if err != nil {
+			failed = true
+			fmt.Printf("%s: %v\n", result.Device, err)
+			continue
+		}
+		fmt.Printf("%s: command executed successfully\n", result.Device)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"obx/protocol"
+	"obx/utils/bluetooth"
+	"obx/utils/registry"
+	"strings"
+	"time"
+)
+
+// runInfo connects to a speaker and prints what is known about it and its connection, for diagnosing connection problems.
+func runInfo(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	device := flags.String("device", "", "Speaker to connect to, see the main usage")
+	refresh := flags.Bool("refresh", false, "Look up the RFCOMM channel in the speaker's SDP records again instead of using the cached one")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	if *refresh {
+		selected, _, err := bluetooth.SelectUBoomX(*device)
+		exitOnError("error selecting speaker", err)
+		resolved, ok, err := bluetooth.ResolveUBoomXChannel(ctx, selected, true)
+		exitOnError("error resolving RFCOMM channel", err)
+		if ok {
+			fmt.Printf("SDP lookup:      %s\n", resolved)
+		}
+	}
+
+	client, selected, err := bluetooth.ConnectUBoomX(ctx, *device)
+	exitOnError("error connecting to speaker", err)
+	defer client.CloseConnection()
+
+	fmt.Printf("Device:          %s\n", selected)
+	if resolved, ok := bluetooth.ConnectedChannel(selected); ok {
+		fmt.Printf("RFCOMM channel:  %s\n", resolved)
+	}
+	if known, err := registry.Open(); err == nil {
+		if device, ok := known.Find(selected); ok {
+			fmt.Printf("Nickname:        %s\n", device.Nickname)
+			fmt.Printf("Last connected:  %s\n", device.LastConnected.Format(time.DateTime))
+		}
+	}
+
+	firmware, err := client.ReadFirmwarePackageName(ctx)
+	if err != nil {
+		fmt.Printf("Firmware:        %v\n", err)
+	} else {
+		printFirmware(client.Model(), firmware)
+		if err := bluetooth.RecordFirmware(selected, firmware); err != nil {
+			fmt.Println("Error remembering speaker:", err)
+		}
+	}
+	// the capabilities are shown after reading the firmware, whose quirks may change them
+	fmt.Printf("Model:           %s\n", client.Model().Name)
+	fmt.Printf("Supports:        %s\n", describeCapabilities(client.Model().Capabilities))
+	battery, err := client.ReadBatteryLevel(ctx)
+	if err != nil {
+		fmt.Printf("Battery:         %v\n", err)
+	} else {
+		fmt.Printf("Battery:         %d%%\n", battery)
+	}
+}
+
+// printFirmware prints the firmware, whether the model profile knows it and its quirks.
+func printFirmware(model *protocol.Model, firmware string) {
+	info, err := protocol.ParseFirmware(firmware)
+	if err != nil {
+		fmt.Printf("Firmware:        %s (%v)\n", firmware, err)
+	} else {
+		fmt.Printf("Firmware:        %s (%s)\n", info, firmware)
+	}
+	if !model.IsKnownFirmware(info) {
+		known := make([]string, len(model.KnownFirmware))
+		for i, firmware := range model.KnownFirmware {
+			known[i] = firmware.String()
+		}
+		fmt.Printf("                 UNKNOWN FIRMWARE: the %s profile was confirmed with %s only, settings may not work as expected\n",
+			model.Name, strings.Join(known, ", "))
+	}
+	for _, quirk := range protocol.Quirks(model.Name, info) {
+		fmt.Printf("Quirk:           %s (%s)\n", quirk.Description, quirk.Firmware)
+	}
+}
+
+// describeCapabilities lists the settings of a model, like "custom EQ (10 bands), 7 Oluv's EQ modes, lights".
+func describeCapabilities(capabilities protocol.Capabilities) string {
+	var supported []string
+	if capabilities.EQ != nil {
+		supported = append(supported, fmt.Sprintf("custom EQ (%d bands)", capabilities.EQ.Bands()))
+	}
+	if len(capabilities.OluvModes) > 0 {
+		supported = append(supported, fmt.Sprintf("%d Oluv's EQ modes", len(capabilities.OluvModes)))
+	}
+	if len(capabilities.LightModes) > 0 {
+		supported = append(supported, "lights")
+	}
+	if capabilities.VideoMode {
+		supported = append(supported, "video mode")
+	}
+	if len(capabilities.BeepVolumes) > 0 {
+		supported = append(supported, "beep volume")
+	}
+	if len(capabilities.ShutdownTimeouts) > 0 {
+		supported = append(supported, "shutdown timeout")
+	}
+	if capabilities.PowerOff {
+		supported = append(supported, "power off")
+	}
+	if len(supported) == 0 {
+		return "no settings"
+	}
+	return strings.Join(supported, ", ")
+}
@@ -1,54 +1,280 @@
 package main
 
 import (
+	"context"
+	"encoding"
 	"flag"
 	"fmt"
+	"obx/protocol"
+	"obx/protocol/eq"
 	"obx/utils"
 	"obx/utils/bluetooth"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// commandTimeout covers scanning for the speaker, connecting and the command itself
+const commandTimeout = 15 * time.Second
+
 func main() {
-	lightAction := flag.String("light", "", "Set light action: 'default', 'off', or RGB hex value")
-	solidLight := flag.Bool("solid", false, "Set if the light should be solid. Otherwise it will dance. Must be used with -light.")
-	eq := flag.String("eq", "", "Set custom eq bands: 10 comma separated values from 0 (-10 dB) to 120 (+10dB). E.g. 0,0,0,0,0,0,0,0,0,0")
-	oluvMode := flag.String("oluv", "", "Set EQ mode: 'studio', 'indoor', 'indoor+', 'outdoor', 'outdoor+', 'boom', 'ground'")
-	shutdown := flag.String("shutdown", "", "Set shutdown timeout: '5m', '10m', '30m', '60m', '90m', '120m', 'no'")
-	poweroff := flag.Bool("poweroff", false, "Power off the speaker")
-	video := flag.String("video", "", "Enable or disable Video mode: 'on' or 'off'")
-	volume := flag.Int("volume", -1, "Set beep volume: 0, 25, 50, 75, 100")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "decode":
+			runDecode(os.Args[2:])
+			return
+		case "btsnoop":
+			runBtsnoop(os.Args[2:])
+			return
+		case "explore":
+			runExplore(os.Args[2:])
+			return
+		case "scan":
+			runScan(os.Args[2:])
+			return
+		case "devices":
+			runDevices(os.Args[2:])
+			return
+		case "info":
+			runInfo(os.Args[2:])
+			return
+		}
+	}
+
+	// the usage of the setting flags is set by describeSettings for the model of the speaker
+	lightAction := flag.String("light", "", "")
+	solidLight := flag.Bool("solid", false, "")
+	var curve eq.Curve
+	flag.Func("eq", "", func(text string) error {
+		return parseEQ(&curve, text)
+	})
+	var oluvMode protocol.OluvMode
+	textFlag(&oluvMode, "oluv", "")
+	var shutdown protocol.ShutdownTimeout
+	textFlag(&shutdown, "shutdown", "")
+	poweroff := flag.Bool("poweroff", false, "")
+	var video protocol.VideoMode
+	textFlag(&video, "video", "")
+	var volume protocol.BeepVolume
+	textFlag(&volume, "volume", "")
 	custom := flag.String("custom", "", "Send custom hex message (advanced)")
+	var devices deviceList
+	flag.Var(&devices, "device", fmt.Sprintf("Speaker to connect to: a MAC address, the nickname of a known speaker or a URI like rfcomm://MAC/channel or tcp://host:port (transports: %s). Connects to the last used speaker, or scans for one, if empty. Repeat to send the command to several speakers", strings.Join(protocol.TransportSchemes(), ", ")))
+	record := flag.String("record", "", "Record every sent and received frame to a JSONL session file")
+	monitor := flag.Bool("monitor", false, "Stay connected, reconnect when the speaker drops and print connection, battery and speaker changes")
+	flag.Usage = func() {
+		describeSettings(usageModel(devices))
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
-	client, err := bluetooth.ConnectUBoomX()
-	if err != nil {
-		panic(err)
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var light protocol.LightState
+	if set["light"] {
+		var err error
+		light, err = protocol.ParseLightAction(*lightAction, *solidLight)
+		utils.Must("parse light action", err)
 	}
-	defer client.CloseConnection()
 
+	if len(devices) > 1 && (*monitor || *record != "") {
+		fmt.Fprintln(os.Stderr, "-monitor and -record take a single -device")
+		os.Exit(2)
+	}
+	device := ""
+	if len(devices) == 1 {
+		device = devices[0]
+	}
+
+	if *monitor {
+		runMonitor(device, *record)
+		return
+	}
+
+	var command func(ctx context.Context, client protocol.ISpeakerClient) error
 	switch {
-	case *lightAction != "":
-		err = client.HandleLightAction(*lightAction, *solidLight)
-	case *eq != "":
-		err = client.SetCustomEQ(*eq)
-	case *oluvMode != "":
-		err = client.SetOluvMode(*oluvMode)
-	case *shutdown != "":
-		err = client.SetShutdownTimeout(*shutdown)
+	case set["light"]:
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SetLight(ctx, light)
+		}
+	case set["eq"]:
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SetEQ(ctx, curve)
+		}
+	case set["oluv"]:
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SetOluvMode(ctx, oluvMode)
+		}
+	case set["shutdown"]:
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SetShutdownTimeout(ctx, shutdown)
+		}
 	case *poweroff:
-		err = client.PowerOffSpeaker()
-	case *video != "":
-		err = client.SetVideoMode(*video)
-	case *volume != -1:
-		err = client.SetBeepVolume(*volume)
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.PowerOffSpeaker(ctx)
+		}
+	case set["video"]:
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SetVideoMode(ctx, video)
+		}
+	case set["volume"]:
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SetBeepVolume(ctx, volume)
+		}
 	case *custom != "":
-		err = client.SendMessage(*custom)
+		command = func(ctx context.Context, client protocol.ISpeakerClient) error {
+			return client.SendMessage(ctx, *custom)
+		}
 	default:
 		fmt.Println("No valid action specified")
 		flag.Usage()
 		return
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	if len(devices) > 1 {
+		runGroup(ctx, devices, command)
+		return
+	}
+
+	rfcomm, device, err := bluetooth.DialUBoomX(ctx, device)
+	if err != nil {
+		panic(err)
+	}
+	rfcomm, err = withRecorder(rfcomm, *record)
+	utils.Must("open session file", err)
+
+	client := protocol.NewSpeakerClient(rfcomm, bluetooth.ModelOf(device))
+	defer client.CloseConnection()
+	if err := bluetooth.PersistState(client, device); err != nil {
+		fmt.Fprintln(os.Stderr, "Error keeping speaker state:", err)
+	}
+
+	err = command(ctx, client)
 	utils.Must("send message", err)
 
 	fmt.Println("Command executed successfully")
 }
+
+// textFlag defines a flag that is parsed into value, which keeps its zero value if the flag isn't set.
+func textFlag(value encoding.TextUnmarshaler, name string, usage string) {
+	flag.Func(name, usage, func(text string) error {
+		return value.UnmarshalText([]byte(text))
+	})
+}
+
+// parseEQ parses the gains in dB of the -eq flag. The flag took the band bytes from 0 to 120 before,
+// values that are only valid in that form are rejected with the gains they stand for.
+func parseEQ(curve *eq.Curve, text string) error {
+	parsed, err := eq.Parse(text)
+	if err == nil {
+		*curve = parsed
+		return nil
+	}
+
+	fields := strings.Split(text, ",")
+	values := make([]byte, len(fields))
+	for i, field := range fields {
+		value, parseErr := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if parseErr != nil || value > uint64(eq.MaxValue) {
+			return err
+		}
+		values[i] = byte(value)
+	}
+	old, oldErr := eq.FromBytes(values)
+	if oldErr != nil {
+		return err
+	}
+	return fmt.Errorf("gains are from %.0f to %+.0f dB, values from 0 to %d are no longer supported: use -eq=%s for the same curve",
+		eq.MinGain, eq.MaxGain, eq.MaxValue, old)
+}
+
+// quoted lists setting values for a flag usage, e.g. 'on', 'off'.
+func quoted[T fmt.Stringer](values []T) string {
+	return "'" + strings.Join(utils.Names(values), "', '") + "'"
+}
+
+// frequencies lists the approximate centre frequencies of the EQ bands.
+func frequencies(bands []float64) string {
+	names := make([]string, len(bands))
+	for i, frequency := range bands {
+		names[i] = eq.FormatFrequency(frequency)
+	}
+	return strings.Join(names, ", ")
+}
+
+// usageModel returns the model of the first -device, or of the speaker connected last, without connecting to it.
+func usageModel(devices deviceList) *protocol.Model {
+	device := ""
+	if len(devices) > 0 {
+		device = devices[0]
+	}
+	selected, _, err := bluetooth.SelectUBoomX(device)
+	if err != nil || selected == "" {
+		return protocol.UBoomX
+	}
+	return bluetooth.ModelOf(selected)
+}
+
+// describeSettings sets the usage of the setting flags to the values the model supports.
+func describeSettings(model *protocol.Model) {
+	capabilities := model.Capabilities
+	unsupported := fmt.Sprintf("Not supported by the %s", model.Name)
+	usages := map[string]string{
+		"light":    unsupported,
+		"solid":    unsupported,
+		"eq":       unsupported,
+		"oluv":     unsupported,
+		"shutdown": unsupported,
+		"poweroff": unsupported,
+		"video":    unsupported,
+		"volume":   unsupported,
+	}
+	if len(capabilities.LightModes) > 0 {
+		usages["light"] = "Set light action: 'default', 'off', or RGB hex value"
+		usages["solid"] = "Set if the light should be solid. Otherwise it will dance. Must be used with -light."
+	}
+	if bands := capabilities.EQ; bands != nil {
+		usages["eq"] = fmt.Sprintf("Set custom eq bands: %d comma separated gains from %.0f to %+.0f dB in 1/%d dB steps, for bands at about %s (approximate, the speaker doesn't report them). E.g. -2,0,0,0,0,0,0,0,1.5,3",
+			bands.Bands(), bands.MinGain, bands.MaxGain, bands.StepsPerDB, frequencies(bands.Frequencies))
+	}
+	if len(capabilities.OluvModes) > 0 {
+		usages["oluv"] = fmt.Sprintf("Set EQ mode: %s", quoted(capabilities.OluvModes))
+	}
+	if len(capabilities.ShutdownTimeouts) > 0 {
+		usages["shutdown"] = fmt.Sprintf("Set shutdown timeout: %s", quoted(capabilities.ShutdownTimeouts))
+	}
+	if capabilities.PowerOff {
+		usages["poweroff"] = "Power off the speaker"
+	}
+	if capabilities.VideoMode {
+		usages["video"] = fmt.Sprintf("Enable or disable Video mode: %s", quoted(protocol.AllVideoModes()))
+	}
+	if len(capabilities.BeepVolumes) > 0 {
+		usages["volume"] = fmt.Sprintf("Set beep volume: %s", quoted(capabilities.BeepVolumes))
+	}
+	for name, usage := range usages {
+		flag.Lookup(name).Usage = usage
+	}
+}
+
+// withRecorder wraps rfcomm in a session recorder if a session file path is given.
+func withRecorder(rfcomm protocol.RfcommClient, record string) (protocol.RfcommClient, error) {
+	if record == "" {
+		return rfcomm, nil
+	}
+	recorder, err := protocol.NewSessionRecorder(rfcomm, record)
+	if err != nil {
+		_ = rfcomm.CloseSocket()
+		return nil, err
+	}
+	return recorder, nil
+}
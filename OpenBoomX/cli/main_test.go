@@ -0,0 +1,37 @@
+package main
+
+import (
+	"obx/protocol/eq"
+	"strings"
+	"testing"
+)
+
+func TestParseEQ(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    eq.Curve
+		wantErr string
+	}{
+		{text: "-2,0,0,0,0,0,0,0,1.5,3", want: eq.Curve{-2, 0, 0, 0, 0, 0, 0, 0, 1.5, 3}},
+		{text: "-10,10,0,0,0,0,0,0,0,0", want: eq.Curve{-10, 10}},
+		{text: "60,60,60,60,60,60,60,60,60,120", wantErr: "use -eq=0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,10.0"},
+		{text: "0,0,0,0,0,0,0,0,0,121", wantErr: "between -10 dB and +10 dB"},
+		{text: "11,0,0", wantErr: "exactly 10 bands"},
+		{text: "a,0,0,0,0,0,0,0,0,0", wantErr: "invalid EQ band gain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var curve eq.Curve
+			err := parseEQ(&curve, tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseEQ() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || curve != tt.want {
+				t.Errorf("parseEQ() = %v, %v, want %v", curve, err, tt.want)
+			}
+		})
+	}
+}
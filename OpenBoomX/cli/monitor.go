@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"obx/protocol"
+	"obx/utils"
+	"obx/utils/bluetooth"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const monitorInterval = 30 * time.Second
+
+// runMonitor keeps a supervised connection open, printing connection state changes, the battery level and the frames the speaker sends on its own until interrupted.
+func runMonitor(device string, record string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	supervisor, device, err := bluetooth.SuperviseUBoomX(ctx, device)
+	utils.Must("connect to speaker", err)
+
+	rfcomm, err := withRecorder(supervisor, record)
+	utils.Must("open session file", err)
+
+	client := protocol.NewSpeakerClient(rfcomm, bluetooth.ModelOf(device))
+	defer client.CloseConnection()
+	if err := bluetooth.PersistState(client, device); err != nil {
+		fmt.Fprintln(os.Stderr, "Error keeping speaker state:", err)
+	}
+	if err := bluetooth.RememberFirmware(ctx, client, device); err != nil {
+		fmt.Fprintln(os.Stderr, "Error remembering speaker:", err)
+	}
+
+	states, unsubscribe := supervisor.Subscribe()
+	defer unsubscribe()
+	events, unsubscribeEvents := client.Subscribe(nil)
+	defer unsubscribeEvents()
+
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+
+	printBattery(ctx, client)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case state, ok := <-states:
+			if !ok {
+				return
+			}
+			fmt.Printf("%s connection %s\n", time.Now().Format(time.TimeOnly), state)
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			printEvent(event)
+		case <-ticker.C:
+			printBattery(ctx, client)
+		}
+	}
+}
+
+// printEvent prints a frame the speaker sent on its own, unknown frames are printed as hex to help mapping them.
+func printEvent(event protocol.Event) {
+	if event.Raw {
+		fmt.Printf("%s unknown frame %s: %s\n", time.Now().Format(time.TimeOnly), event.Frame, event.Description)
+		return
+	}
+	fmt.Printf("%s speaker %s\n", time.Now().Format(time.TimeOnly), event.Description)
+}
+
+func printBattery(ctx context.Context, client protocol.ISpeakerClient) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	level, err := client.ReadBatteryLevel(ctx)
+	if err != nil {
+		fmt.Printf("%s battery read failed: %v\n", time.Now().Format(time.TimeOnly), err)
+		return
+	}
+	fmt.Printf("%s battery %d%%\n", time.Now().Format(time.TimeOnly), level)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"obx/utils/bluetooth"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// runScan lists the EarFun devices in range, printing each one as soon as it is seen.
+func runScan(args []string) {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	duration := flags.Duration("duration", bluetooth.DefaultScanDuration, "How long to scan")
+	jsonOutput := flags.Bool("json", false, "Print every sighting as a JSON line instead of text")
+	flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var candidates []bluetooth.Candidate
+	seen := make(map[string]bool)
+	var encoder *json.Encoder
+	if *jsonOutput {
+		encoder = json.NewEncoder(os.Stdout)
+	} else {
+		fmt.Printf("Scanning for %s...\n", *duration)
+	}
+	err := bluetooth.Discover(ctx, *duration, func(candidate bluetooth.Candidate) {
+		if encoder != nil {
+			_ = encoder.Encode(candidate)
+		} else if !seen[candidate.Address] {
+			fmt.Println(formatCandidate(candidate))
+		}
+		seen[candidate.Address] = true
+		candidates = bluetooth.MergeCandidate(candidates, candidate)
+	})
+	if err != nil && ctx.Err() == nil {
+		exitOnError("error scanning", err)
+	}
+	if encoder != nil {
+		return
+	}
+
+	bluetooth.SortCandidates(candidates)
+	fmt.Printf("\nFound %d devices:\n", len(candidates))
+	for _, candidate := range candidates {
+		fmt.Println(formatCandidate(candidate))
+	}
+}
+
+// formatCandidate formats a device like "F8:AB:E5:12:34:56  -62 dBm  EarFun UBOOM X  EarFun OUI  seen 12:00:01".
+func formatCandidate(candidate bluetooth.Candidate) string {
+	name := candidate.Name
+	if name == "" {
+		name = "(no name)"
+	}
+	oui := ""
+	if candidate.OUIMatch {
+		oui = "EarFun OUI"
+	}
+	return fmt.Sprintf("%s  %4d dBm  %-20s  %-10s  seen %s", candidate.Address, candidate.RSSI, name, oui, candidate.LastSeen.Format(time.TimeOnly))
+}
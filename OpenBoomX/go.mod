@@ -1,20 +1,23 @@
 module obx
 
-go 1.23.3
+go 1.24
 
 require (
 	gioui.org v0.7.1
+	gioui.org/x v0.7.1
+	github.com/godbus/dbus/v5 v5.1.0
+	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f
+	golang.org/x/exp/shiny v0.0.0-20241217172543-b2144cdd0a67
 	golang.org/x/sys v0.27.0
+	golang.org/x/text v0.16.0
 	tinygo.org/x/bluetooth v0.10.0
 )
 
 require (
 	gioui.org/cpu v0.0.0-20210817075930-8d6a761490d2 // indirect
 	gioui.org/shader v1.0.8 // indirect
-	gioui.org/x v0.7.1 // indirect
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/go-text/typesetting v0.1.1 // indirect
-	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/saltosystems/winrt-go v0.0.0-20241030114511-98be01919aa6 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
@@ -22,9 +25,6 @@ require (
 	github.com/soypat/seqs v0.0.0-20240527012110-1201bab640ef // indirect
 	github.com/tinygo-org/cbgo v0.0.4 // indirect
 	github.com/tinygo-org/pio v0.0.0-20240901140349-27cbe9d986eb // indirect
-	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f // indirect
-	golang.org/x/exp/shiny v0.0.0-20241217172543-b2144cdd0a67 // indirect
 	golang.org/x/image v0.18.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
 	tinygo.org/x/drivers v0.29.0 // indirect
 )
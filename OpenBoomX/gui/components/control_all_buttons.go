@@ -0,0 +1,62 @@
+package components
+
+import (
+	"fmt"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"obx/gui/theme"
+)
+
+// ControlAllButtons switch between controlling the first speaker only and all connected speakers.
+type ControlAllButtons struct {
+	clickableOne        widget.Clickable
+	clickableAll        widget.Clickable
+	OnControlAllChanged func(all bool)
+	all                 bool
+}
+
+func CreateControlAllButtons(onControlAllChanged func(all bool)) *ControlAllButtons {
+	return &ControlAllButtons{
+		OnControlAllChanged: onControlAllChanged,
+	}
+}
+
+func (cb *ControlAllButtons) Layout(th *material.Theme, gtx layout.Context, speakerCount int) layout.Dimensions {
+	if cb.clickableOne.Clicked(gtx) && cb.all {
+		cb.all = false
+		cb.OnControlAllChanged(false)
+	}
+	if cb.clickableAll.Clicked(gtx) && !cb.all {
+		cb.all = true
+		cb.OnControlAllChanged(true)
+	}
+
+	oneStyle := material.Button(th, &cb.clickableOne, "This Speaker")
+	allStyle := material.Button(th, &cb.clickableAll, fmt.Sprintf("All Speakers (%d)", speakerCount))
+	if cb.all {
+		oneStyle.Background = theme.Surface0Color
+	} else {
+		allStyle.Background = theme.Surface0Color
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return oneStyle.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Spacer{Width: unit.Dp(8)}.Layout(gtx)
+				}),
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return allStyle.Layout(gtx)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Spacer{Height: unit.Dp(8)}.Layout(gtx)
+		}),
+	)
+}
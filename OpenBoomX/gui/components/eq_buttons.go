@@ -7,11 +7,13 @@ import (
 	"gioui.org/widget/material"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	"obx/gui/theme"
 )
 
 type EqButtons struct {
 	Buttons       []EQButton
 	OnModeClicked func(mode string)
+	selected      string
 }
 
 type EQButton struct {
@@ -27,6 +29,11 @@ func CreateEQButtons(modes []string, onModeClicked func(mode string)) *EqButtons
 	return &EqButtons{Buttons: buttons, OnModeClicked: onModeClicked}
 }
 
+// SetSelected highlights the button of mode, an empty mode highlights none.
+func (eq *EqButtons) SetSelected(mode string) {
+	eq.selected = mode
+}
+
 func (eq *EqButtons) Layout(th *material.Theme, gtx layout.Context) layout.Dimensions {
 	var buttons []layout.FlexChild
 
@@ -35,11 +42,16 @@ func (eq *EqButtons) Layout(th *material.Theme, gtx layout.Context) layout.Dimen
 	for i := range eq.Buttons {
 		btn := &eq.Buttons[i]
 		if btn.clickable.Clicked(gtx) {
+			eq.selected = btn.mode
 			eq.OnModeClicked(btn.mode)
 		}
 
 		btnLayout := layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			return material.Button(th, &btn.clickable, caser.String(btn.mode)).Layout(gtx)
+			btnStyle := material.Button(th, &btn.clickable, caser.String(btn.mode))
+			if eq.selected != "" && btn.mode != eq.selected {
+				btnStyle.Background = theme.Surface0Color
+			}
+			return btnStyle.Layout(gtx)
 		})
 
 		spacerLayout := layout.Rigid(func(gtx layout.Context) layout.Dimensions {
@@ -6,6 +6,7 @@ import (
 	"gioui.org/widget/material"
 	"gioui.org/x/component"
 	"obx/gui/theme"
+	"obx/protocol/eq"
 )
 
 type EqSaveButton struct {
@@ -67,6 +68,6 @@ func (btn *EqSaveButton) SetText(text string) {
 	btn.editor.SetText(text)
 }
 
-func (btn *EqSaveButton) OnPresetChanged(newPreset string, values []float32) {
+func (btn *EqSaveButton) OnPresetChanged(newPreset string, curve eq.Curve) {
 	btn.SetText(newPreset)
 }
@@ -1,7 +1,6 @@
 package components
 
 import (
-	"fmt"
 	"gioui.org/f32"
 	"gioui.org/layout"
 	"gioui.org/op"
@@ -9,26 +8,24 @@ import (
 	"gioui.org/widget/material"
 	"gioui.org/x/component"
 	"image"
-	"log"
 	"math"
 	"obx/gui/theme"
-	"strconv"
+	"obx/protocol/eq"
 )
 
 type EqSlider struct {
-	sliderValues    []float32
-	editorValues    []string
-	OnValuesChanged func(values []float32)
-	sliders         []widget.Float
-	editors         []widget.Editor
-	defaultValues   []float32
+	sliderValues   []float32
+	editorValues   []string
+	OnCurveChanged func(curve eq.Curve)
+	sliders        []widget.Float
+	editors        []widget.Editor
 }
 
-func CreateEqSlider(onValuesChanged func(values []float32)) *EqSlider {
-	sliderValues := make([]float32, 10)
-	sliders := make([]widget.Float, 10)
-	editorValues := make([]string, 10)
-	editors := make([]widget.Editor, 10)
+func CreateEqSlider(onCurveChanged func(curve eq.Curve)) *EqSlider {
+	sliderValues := make([]float32, eq.BandCount)
+	sliders := make([]widget.Float, eq.BandCount)
+	editorValues := make([]string, eq.BandCount)
+	editors := make([]widget.Editor, eq.BandCount)
 
 	for i, _ := range editors {
 		editors[i].SingleLine = true
@@ -37,57 +34,44 @@ func CreateEqSlider(onValuesChanged func(values []float32)) *EqSlider {
 		editors[i].Filter = "-.0123456789"
 	}
 
-	eq := &EqSlider{
-		sliderValues:    sliderValues,
-		editorValues:    editorValues,
-		OnValuesChanged: onValuesChanged,
-		sliders:         sliders,
-		editors:         editors,
-		defaultValues:   []float32{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5},
+	slider := &EqSlider{
+		sliderValues:   sliderValues,
+		editorValues:   editorValues,
+		OnCurveChanged: onCurveChanged,
+		sliders:        sliders,
+		editors:        editors,
 	}
-
-	err := eq.SetSliderValues(eq.defaultValues)
-	if err != nil {
-		return nil
-	}
-
-	return eq
+	slider.SetCurve(eq.Flat())
+	return slider
 }
 
-func (eq *EqSlider) ResetValues() error {
-	err := eq.SetSliderValues(eq.defaultValues)
-	if err != nil {
-		return err
-	}
-	eq.OnValuesChanged(eq.sliderValues)
-	return nil
+func (s *EqSlider) ResetValues() {
+	s.SetCurve(eq.Flat())
+	s.OnCurveChanged(s.GetCurve())
 }
 
-func (eq *EqSlider) GetSliderValues() []float32 {
-	valuesCopy := make([]float32, len(eq.sliderValues))
-	copy(valuesCopy, eq.sliderValues)
-	return valuesCopy
-}
-
-// SetSliderValues sets the eq values, values must have a length of 10 (10 bands)
-func (eq *EqSlider) SetSliderValues(values []float32) error {
-	if len(values) != 10 {
-		return fmt.Errorf("values must have a length of 10")
+// GetCurve returns the curve shown by the sliders, quantized to the speaker's steps.
+func (s *EqSlider) GetCurve() eq.Curve {
+	var curve eq.Curve
+	for i, value := range s.sliderValues {
+		curve[i] = sliderToGain(value)
 	}
+	return curve.Quantize()
+}
 
-	for i := 0; i < 10; i++ {
-		eq.sliderValues[i] = values[i]
-		eq.sliders[i].Value = values[i]
-		eq.editorValues[i] = sliderToDb(values[i])
-		eq.editors[i].SetText(eq.editorValues[i])
+// SetCurve shows curve without sending it.
+func (s *EqSlider) SetCurve(curve eq.Curve) {
+	for i, gain := range curve {
+		s.sliderValues[i] = gainToSlider(gain)
+		s.sliders[i].Value = s.sliderValues[i]
+		s.editorValues[i] = eq.FormatGain(eq.Quantize(gain))
+		s.editors[i].SetText(s.editorValues[i])
 	}
-
-	return nil
 }
 
-func (eq *EqSlider) Layout(th *material.Theme, gtx layout.Context) layout.Dimensions {
-	children := make([]layout.FlexChild, len(eq.sliders))
-	for i := range eq.sliders {
+func (s *EqSlider) Layout(th *material.Theme, gtx layout.Context) layout.Dimensions {
+	children := make([]layout.FlexChild, len(s.sliders))
+	for i := range s.sliders {
 		children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 
 			return layout.Flex{Axis: layout.Vertical, Alignment: layout.Middle}.Layout(gtx,
@@ -106,7 +90,7 @@ func (eq *EqSlider) Layout(th *material.Theme, gtx layout.Context) layout.Dimens
 
 					op.Offset(image.Pt(-estimateSize, -estimateSize)).Add(gtx.Ops)
 
-					slider := material.Slider(th, &eq.sliders[i])
+					slider := material.Slider(th, &s.sliders[i])
 
 					dims := slider.Layout(gtx)
 
@@ -116,14 +100,14 @@ func (eq *EqSlider) Layout(th *material.Theme, gtx layout.Context) layout.Dimens
 
 					recorded.Add(gtx.Ops)
 
-					if !eq.sliders[i].Dragging() {
-						if eq.sliderValues[i] != eq.sliders[i].Value {
-							eq.sliderValues[i] = eq.sliders[i].Value
-							eq.editorValues[i] = sliderToDb(eq.sliderValues[i])
-							eq.editors[i].SetText(eq.editorValues[i])
+					if !s.sliders[i].Dragging() {
+						if s.sliderValues[i] != s.sliders[i].Value {
+							s.sliderValues[i] = s.sliders[i].Value
+							s.editorValues[i] = eq.FormatGain(eq.Quantize(sliderToGain(s.sliderValues[i])))
+							s.editors[i].SetText(s.editorValues[i])
 
-							if eq.OnValuesChanged != nil {
-								eq.OnValuesChanged(eq.sliderValues)
+							if s.OnCurveChanged != nil {
+								s.OnCurveChanged(s.GetCurve())
 							}
 						}
 					}
@@ -134,15 +118,15 @@ func (eq *EqSlider) Layout(th *material.Theme, gtx layout.Context) layout.Dimens
 				}),
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					// update slider values
-					if eq.editors[i].Text() != eq.editorValues[i] {
-						if value, err := strconv.ParseFloat(eq.editors[i].Text(), 64); err == nil {
-							sliderValue := dbToSlider(value)
-
-							eq.editorValues[i] = eq.editors[i].Text()
-							eq.sliderValues[i] = float32(sliderValue)
-							eq.sliders[i].Value = float32(sliderValue)
-							if eq.OnValuesChanged != nil {
-								eq.OnValuesChanged(eq.sliderValues)
+					if s.editors[i].Text() != s.editorValues[i] {
+						if gain, err := eq.ParseGain(s.editors[i].Text()); err == nil {
+							sliderValue := gainToSlider(gain)
+
+							s.editorValues[i] = s.editors[i].Text()
+							s.sliderValues[i] = sliderValue
+							s.sliders[i].Value = sliderValue
+							if s.OnCurveChanged != nil {
+								s.OnCurveChanged(s.GetCurve())
 							}
 						}
 					}
@@ -158,39 +142,39 @@ func (eq *EqSlider) Layout(th *material.Theme, gtx layout.Context) layout.Dimens
 
 					return surfaceStyle.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 						return layout.UniformInset(4).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
-							material.Editor(th, &eq.editors[i], "val").Layout(gtx)
+							material.Editor(th, &s.editors[i], "val").Layout(gtx)
 							return layout.Dimensions{Size: image.Pt(gtx.Dp(41.5), gtx.Dp(19))}
 						})
 					})
 				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Spacer{Height: 4}.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					// the band frequencies are approximate, the speaker doesn't report them
+					return material.Caption(th, eq.FormatBandFrequency(eq.Frequencies[i])).Layout(gtx)
+				}),
 			)
 		})
 	}
 	return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceBetween}.Layout(gtx, children...)
 }
 
-func (eq *EqSlider) OnPresetChanged(newPreset string, values []float32) {
-	if newPreset == "" || values == nil {
+func (s *EqSlider) OnPresetChanged(newPreset string, curve eq.Curve) {
+	if newPreset == "" {
 		return
 	}
 
-	err := eq.SetSliderValues(values)
-	if err != nil {
-		log.Println(err)
-	}
-	eq.OnValuesChanged(eq.sliderValues)
+	s.SetCurve(curve)
+	s.OnCurveChanged(s.GetCurve())
 }
 
-// dbToSlider maps dB value back to 0-1 range for the slider
-func dbToSlider(value float64) float64 {
-	sliderValue := (10 - value) / 20
-	sliderValue = min(sliderValue, 1)
-	sliderValue = max(sliderValue, 0)
-	return sliderValue
+// gainToSlider maps a gain to the slider, which has +10 dB at 0 because it is rotated
+func gainToSlider(gain float64) float32 {
+	return float32(1 - eq.Position(gain))
 }
 
-// sliderToDb maps slider value to dB for the editor
-func sliderToDb(value float32) string {
-	dBValue := (1-value)*20 - 10
-	return fmt.Sprintf("%.1f", dBValue)
+// sliderToGain maps a slider value back to its gain
+func sliderToGain(value float32) float64 {
+	return eq.GainAt(1 - float64(value))
 }
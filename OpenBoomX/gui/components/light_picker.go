@@ -60,6 +60,15 @@ func (lp *LightPicker) SetColor(color color.NRGBA) {
 	lp.sendUpdate()
 }
 
+// SetState shows the color and mode the speaker is using, without sending it back.
+func (lp *LightPicker) SetState(color color.NRGBA, solidColor bool) {
+	lp.picker.SetColor(color)
+	lp.radioButtonsGroup.Value = dancingLights
+	if solidColor {
+		lp.radioButtonsGroup.Value = solidLights
+	}
+}
+
 func (lp *LightPicker) GetColor() color.NRGBA {
 	return lp.picker.Color()
 }
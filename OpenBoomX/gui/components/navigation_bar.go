@@ -6,6 +6,7 @@ import (
 	"gioui.org/widget/material"
 	"obx/gui/routes"
 	"obx/gui/theme"
+	"slices"
 )
 
 type RouteButtonData struct {
@@ -24,16 +25,25 @@ var buttons = []RouteButtonData{
 
 type NavigationBar struct {
 	OnRouteSelected func(route routes.AppRoute)
+	buttons         []RouteButtonData
 	clickables      []*widget.Clickable
 }
 
-func CreateNavigationBar(onRouteSelected func(route routes.AppRoute)) *NavigationBar {
-	clickables := make([]*widget.Clickable, len(buttons))
+// CreateNavigationBar shows a button for each of the available routes.
+func CreateNavigationBar(available []routes.AppRoute, onRouteSelected func(route routes.AppRoute)) *NavigationBar {
+	var shown []RouteButtonData
+	for _, button := range buttons {
+		if slices.Contains(available, button.route) {
+			shown = append(shown, button)
+		}
+	}
+	clickables := make([]*widget.Clickable, len(shown))
 	for i := range clickables {
 		clickables[i] = new(widget.Clickable)
 	}
 	return &NavigationBar{
 		OnRouteSelected: onRouteSelected,
+		buttons:         shown,
 		clickables:      clickables,
 	}
 }
@@ -42,9 +52,9 @@ func (nb *NavigationBar) Layout(th *material.Theme, gtx layout.Context) layout.D
 	navTheme := *th
 	navTheme.ContrastBg = theme.CrustColor
 
-	routeButtons := make([]layout.FlexChild, len(buttons))
+	routeButtons := make([]layout.FlexChild, len(nb.buttons))
 
-	for i, btnData := range buttons {
+	for i, btnData := range nb.buttons {
 		clickable := nb.clickables[i]
 		route := btnData.route
 		label := btnData.label
@@ -8,6 +8,7 @@ import (
 	"gioui.org/widget/material"
 	"obx/gui/services"
 	"obx/gui/theme"
+	"obx/protocol/eq"
 )
 
 type PresetButtons struct {
@@ -91,6 +92,6 @@ func createPresetButtons(presetTitles []string) []*PresetButton {
 	return presetButtons
 }
 
-func (pb *PresetButtons) OnPresetChanged(newPreset string, values []float32) {
+func (pb *PresetButtons) OnPresetChanged(newPreset string, curve eq.Curve) {
 	pb.presetButtons = createPresetButtons(pb.presetService.ListPresets())
 }
@@ -9,7 +9,8 @@ import (
 )
 
 type StatusBar struct {
-	BatteryLevel int
+	BatteryLevel     int
+	ConnectionStatus string
 }
 
 func CreateStatusBar() *StatusBar {
@@ -28,6 +29,14 @@ func (sb *StatusBar) Layout(th *material.Theme, gtx layout.Context) layout.Dimen
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				return layout.Spacer{Height: unit.Dp(32)}.Layout(gtx)
 			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if sb.ConnectionStatus == "" {
+					return layout.Dimensions{}
+				}
+				return layout.Inset{Left: unit.Dp(16)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return material.H6(th, sb.ConnectionStatus).Layout(gtx)
+				})
+			}),
 		)
 	})
 }
@@ -36,6 +36,11 @@ func CreateBeepSlider(steps int, title string, stepLabels []string, onStepChange
 	return bs
 }
 
+// SetStep moves the slider to step without calling OnStepChanged.
+func (bs *StepSlider) SetStep(step int) {
+	bs.value.Value = float32(step) / float32(bs.steps-1)
+}
+
 func (bs *StepSlider) Update(gtx layout.Context) {
 	if !bs.value.Dragging() {
 		step := float32(1) / float32(bs.steps-1)
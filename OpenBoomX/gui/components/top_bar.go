@@ -15,11 +15,11 @@ type TopBar struct {
 	statusBar     *StatusBar
 }
 
-func CreateTopBar(theme *material.Theme, buttonTheme *material.Theme, onRouteSelected func(route routes.AppRoute)) *TopBar {
+func CreateTopBar(theme *material.Theme, buttonTheme *material.Theme, available []routes.AppRoute, onRouteSelected func(route routes.AppRoute)) *TopBar {
 	bar := &TopBar{}
 	bar.theme = theme
 	bar.buttonTheme = buttonTheme
-	bar.navigationBar = CreateNavigationBar(onRouteSelected)
+	bar.navigationBar = CreateNavigationBar(available, onRouteSelected)
 	bar.statusBar = CreateStatusBar()
 	return bar
 }
@@ -51,3 +51,8 @@ func (t *TopBar) Layout(gtx layout.Context) layout.Dimensions {
 func (t *TopBar) UpdateBatteryLevel(value int) {
 	t.statusBar.BatteryLevel = value
 }
+
+// UpdateConnectionStatus shows a status next to the battery level, an empty status hides it
+func (t *TopBar) UpdateConnectionStatus(status string) {
+	t.statusBar.ConnectionStatus = status
+}
@@ -5,6 +5,7 @@ import (
 	"gioui.org/unit"
 	"gioui.org/widget"
 	"gioui.org/widget/material"
+	"obx/gui/theme"
 )
 
 type VideoModeButtons struct {
@@ -12,6 +13,9 @@ type VideoModeButtons struct {
 	clickableOff   widget.Clickable
 	OnModeEnabled  func()
 	OnModeDisabled func()
+	// known is false until the video mode was set or read from the speaker
+	known   bool
+	enabled bool
 }
 
 func CreateVideoModeButtons(onModeEnabled func(), onModeDisabled func()) *VideoModeButtons {
@@ -21,25 +25,41 @@ func CreateVideoModeButtons(onModeEnabled func(), onModeDisabled func()) *VideoM
 	}
 }
 
+// SetEnabled highlights the button of the current video mode.
+func (pb *VideoModeButtons) SetEnabled(enabled bool) {
+	pb.known = true
+	pb.enabled = enabled
+}
+
 func (pb *VideoModeButtons) Layout(th *material.Theme, gtx layout.Context) layout.Dimensions {
 	if pb.clickableOn.Clicked(gtx) {
+		pb.SetEnabled(true)
 		pb.OnModeEnabled()
 	}
 	if pb.clickableOff.Clicked(gtx) {
+		pb.SetEnabled(false)
 		pb.OnModeDisabled()
 	}
 
+	onStyle := material.Button(th, &pb.clickableOn, "Video Mode On")
+	offStyle := material.Button(th, &pb.clickableOff, "Video Mode Off")
+	if pb.known && pb.enabled {
+		offStyle.Background = theme.Surface0Color
+	} else if pb.known {
+		onStyle.Background = theme.Surface0Color
+	}
+
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
-					return material.Button(th, &pb.clickableOn, "Video Mode On").Layout(gtx)
+					return onStyle.Layout(gtx)
 				}),
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					return layout.Spacer{Width: unit.Dp(8)}.Layout(gtx)
 				}),
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
-					return material.Button(th, &pb.clickableOff, "Video Mode Off").Layout(gtx)
+					return offStyle.Layout(gtx)
 				}),
 			)
 		}),
@@ -1,3 +1,5 @@
 package constants
 
-var AppName = "OpenBoomX"
+import "obx/utils"
+
+var AppName = utils.AppName
@@ -1,14 +1,17 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"image/color"
+	"io"
 	"log"
 	"obx/protocol"
-	"obx/utils"
-	"strconv"
-	"strings"
+	"obx/protocol/eq"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,26 +21,74 @@ type MessageListener interface {
 
 type SpeakerController struct {
 	client         protocol.ISpeakerClient
+	group          *protocol.SpeakerGroup
+	controlAll     atomic.Bool
 	debounceMutex  sync.Mutex
 	debounceTimer  *time.Timer
 	lastColor      color.NRGBA
 	lastColorSolid bool
 	firstColorSet  bool
-	timeoutMap     []string
+	beepVolumes    []protocol.BeepVolume
+	timeouts       []protocol.ShutdownTimeout
 	listeners      []MessageListener
 }
 
 const debounceDelay = 200 * time.Millisecond
 
-func NewSpeakerController(client protocol.ISpeakerClient) *SpeakerController {
+// commandTimeout bounds a single speaker command, so a silent speaker can't block the caller forever
+const commandTimeout = 5 * time.Second
+
+func commandContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), commandTimeout)
+}
+
+// NewSpeakerController controls client, or all speakers of group in "control all" mode.
+// client must be in group. The settings shown are always read from client, and offered as its model supports them.
+func NewSpeakerController(client protocol.ISpeakerClient, group *protocol.SpeakerGroup) *SpeakerController {
+	capabilities := client.Model().Capabilities
 	return &SpeakerController{
-		client:     client,
-		timeoutMap: utils.SortedKeysByValue(protocol.ShutdownTimeouts),
+		client:      client,
+		group:       group,
+		beepVolumes: capabilities.BeepVolumes,
+		timeouts:    capabilities.ShutdownTimeouts,
 	}
 }
 
-func (sc *SpeakerController) OnModeClicked(mode string) {
-	err := sc.client.SetOluvMode(mode)
+// Model returns the model of the speaker, the pages only show the settings it supports.
+func (sc *SpeakerController) Model() *protocol.Model {
+	return sc.client.Model()
+}
+
+// target returns the client commands are sent to.
+func (sc *SpeakerController) target() protocol.ISpeakerClient {
+	if sc.controlAll.Load() {
+		return sc.group
+	}
+	return sc.client
+}
+
+// SpeakerCount returns the number of connected speakers.
+func (sc *SpeakerController) SpeakerCount() int {
+	return len(sc.group.Devices())
+}
+
+// OnControlAllChanged sends the following commands to all speakers or only to the first one.
+func (sc *SpeakerController) OnControlAllChanged(all bool) {
+	sc.controlAll.Store(all)
+	if all {
+		sc.notifyListeners(fmt.Sprintf("Controlling all %d speakers", sc.SpeakerCount()))
+		return
+	}
+	sc.notifyListeners("Controlling this speaker only")
+}
+
+func (sc *SpeakerController) OnModeClicked(name string) {
+	ctx, cancel := commandContext()
+	defer cancel()
+	mode, err := protocol.ParseOluvMode(name)
+	if err == nil {
+		err = sc.target().SetOluvMode(ctx, mode)
+	}
 	if err != nil {
 		log.Printf("SetOluvMode failed: %v", err)
 		sc.notifyListeners(fmt.Sprintf("Failed setting %s mode", mode))
@@ -48,7 +99,9 @@ func (sc *SpeakerController) OnModeClicked(mode string) {
 }
 
 func (sc *SpeakerController) OnLightOffClicked() {
-	err := sc.client.HandleLightAction(protocol.LightOff, false)
+	ctx, cancel := commandContext()
+	defer cancel()
+	err := sc.target().SetLight(ctx, protocol.LightState{Mode: protocol.LightModeSolid})
 	if err != nil {
 		log.Printf("OnLightOffClicked failed: %v", err)
 		sc.notifyListeners("Failed turning lights off")
@@ -59,7 +112,9 @@ func (sc *SpeakerController) OnLightOffClicked() {
 }
 
 func (sc *SpeakerController) OnLightDefaultClicked() {
-	err := sc.client.HandleLightAction(protocol.LightDefault, false)
+	ctx, cancel := commandContext()
+	defer cancel()
+	err := sc.target().SetLight(ctx, protocol.LightState{Mode: protocol.LightModeDefault})
 	if err != nil {
 		log.Printf("OnLightDefaultClicked failed: %v", err)
 		sc.notifyListeners("Failed setting default lights")
@@ -69,9 +124,15 @@ func (sc *SpeakerController) OnLightDefaultClicked() {
 }
 
 func (sc *SpeakerController) OnColorChanged(color color.NRGBA, solidColor bool) {
-	err := sc.client.HandleLightAction(utils.NrgbaToHex(color), solidColor)
+	ctx, cancel := commandContext()
+	defer cancel()
+	light := protocol.LightState{Mode: protocol.LightModeDancing, Color: [3]byte{color.R, color.G, color.B}}
+	if solidColor {
+		light.Mode = protocol.LightModeSolid
+	}
+	err := sc.target().SetLight(ctx, light)
 	if err != nil {
-		log.Printf("HandleLightAction failed: %v", err)
+		log.Printf("SetLight failed: %v", err)
 		sc.notifyListeners("Failed setting lights color")
 	}
 }
@@ -101,17 +162,22 @@ func (sc *SpeakerController) OnColorChangedDebounced(color color.NRGBA, solidCol
 }
 
 func (sc *SpeakerController) OnBeepStepChanged(step int) {
-	err := sc.client.SetBeepVolume(25 * step)
+	ctx, cancel := commandContext()
+	defer cancel()
+	volume := sc.beepVolumes[step]
+	err := sc.target().SetBeepVolume(ctx, volume)
 	if err != nil {
 		log.Printf("SetBeepVolume failed: %v", err)
-		sc.notifyListeners(fmt.Sprintf("Failed setting beep volume to %d", 25*step))
+		sc.notifyListeners(fmt.Sprintf("Failed setting beep volume to %d", volume.Percent()))
 		return
 	}
-	sc.notifyListeners(fmt.Sprintf("Successfully set beep volume to %d", 25*step))
+	sc.notifyListeners(fmt.Sprintf("Successfully set beep volume to %d", volume.Percent()))
 }
 
 func (sc *SpeakerController) OnOffButtonClicked() {
-	err := sc.client.PowerOffSpeaker()
+	ctx, cancel := commandContext()
+	defer cancel()
+	err := sc.target().PowerOffSpeaker(ctx)
 	if err != nil {
 		log.Printf("PowerOffSpeaker failed: %v", err)
 		sc.notifyListeners("Failed powering off speaker")
@@ -121,7 +187,9 @@ func (sc *SpeakerController) OnOffButtonClicked() {
 }
 
 func (sc *SpeakerController) OnVideoModeEnabled() {
-	err := sc.client.SetVideoMode(protocol.VideoModeOn)
+	ctx, cancel := commandContext()
+	defer cancel()
+	err := sc.target().SetVideoMode(ctx, protocol.VideoModeOn)
 	if err != nil {
 		log.Printf("SetVideoMode failed: %v", err)
 		sc.notifyListeners("Failed turning video mode on")
@@ -131,7 +199,9 @@ func (sc *SpeakerController) OnVideoModeEnabled() {
 }
 
 func (sc *SpeakerController) OnVideoModeDisabled() {
-	err := sc.client.SetVideoMode(protocol.VideoModeOff)
+	ctx, cancel := commandContext()
+	defer cancel()
+	err := sc.target().SetVideoMode(ctx, protocol.VideoModeOff)
 	if err != nil {
 		log.Printf("SetVideoMode failed: %v", err)
 		sc.notifyListeners("Failed turning video mode off")
@@ -141,33 +211,36 @@ func (sc *SpeakerController) OnVideoModeDisabled() {
 }
 
 func (sc *SpeakerController) OnShutdownStepChanged(step int) {
-	err := sc.client.SetShutdownTimeout(sc.timeoutMap[step])
+	ctx, cancel := commandContext()
+	defer cancel()
+	timeout := sc.timeouts[step]
+	err := sc.target().SetShutdownTimeout(ctx, timeout)
 	if err != nil {
 		log.Printf("SetShutdownTimeout failed: %v", err)
-		sc.notifyListeners(fmt.Sprintf("Failed setting shutdown timeout to %s", sc.timeoutMap[step]))
+		sc.notifyListeners(fmt.Sprintf("Failed setting shutdown timeout to %s", timeout))
 		return
 	}
-	sc.notifyListeners(fmt.Sprintf("Successfully set shutdown timeout to %s", sc.timeoutMap[step]))
+	sc.notifyListeners(fmt.Sprintf("Successfully set shutdown timeout to %s", timeout))
 }
 
-func (sc *SpeakerController) OnEqValuesChanged(values []float32) {
-	var sb strings.Builder
-	for i, value := range values {
-		// convert normalized value to range from 0 to 120
-		converted := int((1 - value) * 120)
-		sb.WriteString(strconv.Itoa(converted))
-		if i != len(values)-1 {
-			sb.WriteString(",")
+// OnEqChanged sends the curve, limited to the gains the speaker model supports.
+func (sc *SpeakerController) OnEqChanged(curve eq.Curve) {
+	ctx, cancel := commandContext()
+	defer cancel()
+	if capability := sc.Model().Capabilities.EQ; capability != nil {
+		for i, gain := range curve {
+			curve[i] = min(max(gain, capability.MinGain), capability.MaxGain)
 		}
 	}
-	err := sc.client.SetCustomEQ(sb.String())
+	err := sc.target().SetEQ(ctx, curve)
 	if err != nil {
-		log.Printf("SetCustomEQ failed: %v", err)
+		log.Printf("SetEQ failed: %v", err)
 		sc.notifyListeners("Failed setting custom EQ")
 		return
 	}
 }
 
+// UpdateBattery reports the battery level every 5 seconds until the speaker is gone, which is reported with an error.
 func (sc *SpeakerController) UpdateBattery(onUpdate func(value int, err error)) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -175,17 +248,24 @@ func (sc *SpeakerController) UpdateBattery(onUpdate func(value int, err error))
 	// starts the first iteration immediately
 	// in comparison to the "for range ticker.C" way
 	for ; true; <-ticker.C {
-		batteryLevel, err := sc.client.ReadBatteryLevel()
+		ctx, cancel := commandContext()
+		batteryLevel, err := sc.client.ReadBatteryLevel(ctx)
+		cancel()
 
 		if err == nil {
 			onUpdate(batteryLevel, nil)
 			continue
 		}
 
-		fmt.Println("Error reading battery level:", err)
+		log.Printf("Error reading battery level: %v", err)
 
-		// handling for unix and windows if device disconnected
-		if protocol.IsSocketDisconnected(err) {
+		// a supervised connection is being reestablished, keep polling until it is back
+		if errors.Is(err, protocol.ErrNotConnected) {
+			continue
+		}
+
+		// handling for unix and windows if device disconnected, or the connection was closed under the client
+		if protocol.IsSocketDisconnected(err) || errors.Is(err, protocol.ErrConnectionClosed) || errors.Is(err, io.EOF) {
 			onUpdate(0, fmt.Errorf("Is speaker not connected?: %w", err))
 			err = sc.client.CloseConnection()
 			if err != nil {
@@ -196,12 +276,108 @@ func (sc *SpeakerController) UpdateBattery(onUpdate func(value int, err error))
 	}
 }
 
-func (sc *SpeakerController) GetFirmwareName() string {
-	firmware, err := sc.client.ReadFirmwarePackageName()
+// GetFirmware returns the firmware the speaker reported last, it is read when connecting and kept in the speaker state.
+// unknown is set if the model profile wasn't confirmed with it. A firmware that wasn't read is empty and not flagged.
+func (sc *SpeakerController) GetFirmware() (firmware protocol.FirmwareInfo, unknown bool) {
+	name := sc.SpeakerState().Firmware
+	if name == "" {
+		return protocol.FirmwareInfo{}, false
+	}
+	firmware, err := protocol.ParseFirmware(name)
 	if err != nil {
 		log.Println(err)
 	}
-	return firmware
+	return firmware, !sc.Model().IsKnownFirmware(firmware)
+}
+
+// ReadSettings asks the speaker for its current settings, the replies update the speaker state.
+// The reads share one commandTimeout, so a speaker that doesn't answer them holds the caller up only once.
+// Settings the model doesn't support are skipped.
+func (sc *SpeakerController) ReadSettings() {
+	reads := []struct {
+		name string
+		read func(ctx context.Context) error
+	}{
+		{"ReadCustomEQ", func(ctx context.Context) error {
+			_, _, err := sc.client.ReadCustomEQ(ctx)
+			return err
+		}},
+		{"ReadOluvMode", func(ctx context.Context) error {
+			_, err := sc.client.ReadOluvMode(ctx)
+			return err
+		}},
+		{"ReadLight", func(ctx context.Context) error {
+			_, err := sc.client.ReadLight(ctx)
+			return err
+		}},
+		{"ReadBeepVolume", func(ctx context.Context) error {
+			_, err := sc.client.ReadBeepVolume(ctx)
+			return err
+		}},
+		{"ReadVideoMode", func(ctx context.Context) error {
+			_, err := sc.client.ReadVideoMode(ctx)
+			return err
+		}},
+		{"ReadShutdownTimeout", func(ctx context.Context) error {
+			_, err := sc.client.ReadShutdownTimeout(ctx)
+			return err
+		}},
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	for _, read := range reads {
+		err := read.read(ctx)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			log.Printf("%s failed: %v", read.name, err)
+		}
+		if ctx.Err() != nil {
+			log.Printf("Stopped reading the speaker settings: %v", ctx.Err())
+			return
+		}
+	}
+}
+
+// SpeakerState returns the last known state of the speaker.
+func (sc *SpeakerController) SpeakerState() protocol.SpeakerState {
+	return sc.client.State().State()
+}
+
+// SubscribeSpeakerState returns a channel of speaker state changes, call the returned function to unsubscribe.
+func (sc *SpeakerController) SubscribeSpeakerState() (<-chan protocol.StateChange, func()) {
+	return sc.client.State().Subscribe()
+}
+
+// SubscribeSpeakerEvents returns a channel of the changes made on the speaker itself, call the returned function to unsubscribe.
+func (sc *SpeakerController) SubscribeSpeakerEvents() (<-chan protocol.Event, func()) {
+	return sc.client.Subscribe(nil)
+}
+
+// EventMessage returns the message shown for an event, false for events that aren't worth a message.
+func (sc *SpeakerController) EventMessage(event protocol.Event) (string, bool) {
+	if event.Raw {
+		return "", false
+	}
+	switch event.Field {
+	case protocol.FieldOluvMode:
+		return fmt.Sprintf("Speaker switched to %s mode", event.Value), true
+	case protocol.FieldVideoMode:
+		return fmt.Sprintf("Video mode turned %s on the speaker", event.Value), true
+	case protocol.FieldBattery, protocol.FieldFirmware:
+		return "", false
+	default:
+		return fmt.Sprintf("Speaker changed %s", event.Field), true
+	}
+}
+
+// BeepStep converts a beep volume to a step of the beep slider.
+func (sc *SpeakerController) BeepStep(volume protocol.BeepVolume) int {
+	return slices.Index(sc.beepVolumes, volume)
+}
+
+// ShutdownStep converts a shutdown timeout to a step of the shutdown slider.
+func (sc *SpeakerController) ShutdownStep(timeout protocol.ShutdownTimeout) int {
+	return slices.Index(sc.timeouts, timeout)
 }
 
 func (sc *SpeakerController) RegisterListener(listener MessageListener) {
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"obx/protocol"
+	"obx/protocol/emulator"
+	"obx/protocol/eq"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingListener struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *recordingListener) OnMessage(msg string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingListener) last() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.messages) == 0 {
+		return ""
+	}
+	return l.messages[len(l.messages)-1]
+}
+
+// newEmulatedController returns a controller of an emulated speaker, which is the only speaker of its group.
+func newEmulatedController(t *testing.T) (*emulator.Speaker, *SpeakerController, *recordingListener) {
+	t.Helper()
+	speaker := emulator.New()
+	client := protocol.NewSpeakerClient(speaker, nil)
+	group := protocol.NewSpeakerGroup()
+	if err := group.Add("emulator", client); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = group.CloseConnection() })
+
+	controller := NewSpeakerController(client, group)
+	listener := &recordingListener{}
+	controller.RegisterListener(listener)
+	return speaker, controller, listener
+}
+
+// readFirmware reads the firmware like the GUI does when it connects.
+func readFirmware(t *testing.T, controller *SpeakerController) {
+	t.Helper()
+	ctx, cancel := commandContext()
+	defer cancel()
+	if _, err := controller.client.ReadFirmwarePackageName(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpeakerControllerSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		do      func(sc *SpeakerController)
+		check   func(state emulator.State) bool
+		message string
+	}{
+		{
+			name:    "Oluv mode",
+			do:      func(sc *SpeakerController) { sc.OnModeClicked("outdoor") },
+			check:   func(s emulator.State) bool { return s.OluvMode == byte(protocol.OluvOutdoor) },
+			message: "Successfully set outdoor mode",
+		},
+		{
+			name:    "beep volume",
+			do:      func(sc *SpeakerController) { sc.OnBeepStepChanged(4) },
+			check:   func(s emulator.State) bool { return s.BeepVolume == byte(protocol.BeepVolume100) },
+			message: "Successfully set beep volume to 100",
+		},
+		{
+			name:    "shutdown timeout",
+			do:      func(sc *SpeakerController) { sc.OnShutdownStepChanged(0) },
+			check:   func(s emulator.State) bool { return s.ShutdownTimeout == byte(protocol.Shutdown5m) },
+			message: "Successfully set shutdown timeout to " + protocol.Shutdown5m.String(),
+		},
+		{
+			name: "lights off",
+			do:   func(sc *SpeakerController) { sc.OnLightOffClicked() },
+			check: func(s emulator.State) bool {
+				return s.LightMode == byte(protocol.LightModeSolid) && s.LightColor == [3]byte{}
+			},
+			message: "Successfully turned lights off",
+		},
+		{
+			name:    "video mode",
+			do:      func(sc *SpeakerController) { sc.OnVideoModeEnabled() },
+			check:   func(s emulator.State) bool { return s.VideoMode == byte(protocol.VideoModeOn) },
+			message: "Successfully turned video mode on",
+		},
+		{
+			name:    "unknown Oluv mode",
+			do:      func(sc *SpeakerController) { sc.OnModeClicked("disco") },
+			check:   func(s emulator.State) bool { return s.OluvMode == emulator.DefaultState.OluvMode },
+			message: "Failed setting " + protocol.OluvMode(0).String() + " mode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			speaker, controller, listener := newEmulatedController(t)
+			tt.do(controller)
+			if state := speaker.State(); !tt.check(state) {
+				t.Errorf("speaker state = %+v", state)
+			}
+			if got := listener.last(); got != tt.message {
+				t.Errorf("message = %q, want %q", got, tt.message)
+			}
+		})
+	}
+}
+
+func TestSpeakerControllerClampsEQ(t *testing.T) {
+	speaker, controller, _ := newEmulatedController(t)
+	controller.OnEqChanged(eq.Curve{12, -15, 3})
+
+	want, err := eq.NewCurve(10, -10, 3, 0, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := speaker.State(); !slices.Equal(state.CustomEQ, want.Bytes()) {
+		t.Errorf("custom EQ = %x, want %x", state.CustomEQ, want.Bytes())
+	}
+}
+
+func TestSpeakerControllerReadSettings(t *testing.T) {
+	_, controller, _ := newEmulatedController(t)
+	controller.ReadSettings()
+	readFirmware(t, controller)
+
+	state := controller.SpeakerState()
+	if state.OluvMode == nil || *state.OluvMode != protocol.OluvStudio {
+		t.Errorf("Oluv mode = %v, want studio", state.OluvMode)
+	}
+	if state.BeepVolume == nil || controller.BeepStep(*state.BeepVolume) != 2 {
+		t.Errorf("beep volume = %v, want step 2", state.BeepVolume)
+	}
+
+	firmware, unknown := controller.GetFirmware()
+	if firmware.Platform != "SP500" || unknown {
+		t.Errorf("GetFirmware() = %+v, unknown %v, want the known SP500 firmware", firmware, unknown)
+	}
+}
+
+func TestSpeakerControllerFirmwareNotRead(t *testing.T) {
+	speaker, controller, _ := newEmulatedController(t)
+	var frames []protocol.Frame
+	speaker.OnFrame(func(frame protocol.Frame) {
+		frames = append(frames, frame)
+	})
+
+	if firmware, unknown := controller.GetFirmware(); firmware.Package != "" || unknown {
+		t.Errorf("GetFirmware() = %+v, unknown %v, want no firmware before it was read", firmware, unknown)
+	}
+	if len(frames) != 0 {
+		t.Errorf("GetFirmware() sent %v", frames)
+	}
+}
+
+func TestSpeakerControllerUnknownFirmware(t *testing.T) {
+	speaker, controller, _ := newEmulatedController(t)
+	speaker.SetFirmware("SP500_20260101_v0.42_ota.bin")
+	readFirmware(t, controller)
+
+	if firmware, unknown := controller.GetFirmware(); firmware.Version.Minor != 42 || !unknown {
+		t.Errorf("GetFirmware() = %+v, unknown %v, want the unknown v0.42", firmware, unknown)
+	}
+}
+
+func TestSpeakerControllerReadSettingsInOrder(t *testing.T) {
+	speaker, controller, _ := newEmulatedController(t)
+	var mutex sync.Mutex
+	var opcodes []byte
+	speaker.OnFrame(func(frame protocol.Frame) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		opcodes = append(opcodes, frame.Opcode)
+	})
+	controller.ReadSettings()
+
+	want := []byte{protocol.OpCustomEQ, protocol.OpOluvMode, protocol.OpLight, protocol.OpBeepVolume, protocol.OpVideoMode, protocol.OpShutdownTimeout}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !slices.Equal(opcodes, want) {
+		t.Errorf("read opcodes %x, want %x", opcodes, want)
+	}
+}
+
+func TestSpeakerControllerReadSettingsOfSilentSpeaker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the command timeout")
+	}
+	speaker, controller, _ := newEmulatedController(t)
+	speaker.SetFaults(emulator.Faults{DropReplies: true})
+
+	start := time.Now()
+	controller.ReadSettings()
+	if elapsed := time.Since(start); elapsed > commandTimeout+time.Second {
+		t.Errorf("ReadSettings() took %s, want the reads to share the command timeout of %s", elapsed, commandTimeout)
+	}
+}
+
+func TestSpeakerControllerUpdateBatteryStopsOnDisconnect(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the next battery poll")
+	}
+	speaker, controller, _ := newEmulatedController(t)
+	speaker.SetBattery(80)
+
+	type update struct {
+		value int
+		err   error
+	}
+	updates := make(chan update, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		controller.UpdateBattery(func(value int, err error) {
+			updates <- update{value, err}
+		})
+	}()
+
+	if got := <-updates; got.value != 80 || got.err != nil {
+		t.Fatalf("first update = %d, %v, want 80", got.value, got.err)
+	}
+	speaker.Disconnect()
+
+	select {
+	case got := <-updates:
+		if got.err == nil {
+			t.Errorf("update after disconnect = %d, want an error", got.value)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the disconnect was never reported")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("UpdateBattery kept polling after the disconnect")
+	}
+}
@@ -0,0 +1,180 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"obx/gui/theme"
+	"obx/utils/bluetooth"
+	"sync"
+)
+
+// DevicePickerPage scans for speakers and lets the user pick the one to connect to.
+type DevicePickerPage struct {
+	buttonTheme *material.Theme
+	scanButton  widget.Clickable
+	backButton  widget.Clickable
+	list        widget.List
+	onPicked    func(device string)
+	onBack      func()
+
+	mutex      sync.Mutex
+	candidates []bluetooth.Candidate
+	buttons    map[string]*widget.Clickable
+	scanning   bool
+	scanError  error
+	cancelScan context.CancelFunc
+}
+
+func NewDevicePickerPage(buttonTheme *material.Theme, onPicked func(device string), onBack func()) *DevicePickerPage {
+	return &DevicePickerPage{
+		buttonTheme: buttonTheme,
+		list: widget.List{
+			List: layout.List{
+				Axis: layout.Vertical,
+			},
+		},
+		onPicked: onPicked,
+		onBack:   onBack,
+		buttons:  make(map[string]*widget.Clickable),
+	}
+}
+
+// StartScan forgets the devices found so far and scans again, the devices are listed as they are found.
+func (p *DevicePickerPage) StartScan() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.scanning {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.candidates = nil
+	p.scanning = true
+	p.scanError = nil
+	p.cancelScan = cancel
+
+	go func() {
+		err := bluetooth.Discover(ctx, bluetooth.DefaultScanDuration, func(candidate bluetooth.Candidate) {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			p.candidates = bluetooth.MergeCandidate(p.candidates, candidate)
+			bluetooth.SortCandidates(p.candidates)
+			if _, ok := p.buttons[candidate.Address]; !ok {
+				p.buttons[candidate.Address] = &widget.Clickable{}
+			}
+		})
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.scanning = false
+		if ctx.Err() == nil {
+			p.scanError = err
+		}
+		cancel()
+	}()
+}
+
+// StopScan stops a running scan, the devices found so far stay listed.
+func (p *DevicePickerPage) StopScan() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cancelScan != nil {
+		p.cancelScan()
+	}
+}
+
+func (p *DevicePickerPage) Layout(gtx layout.Context) layout.Dimensions {
+	p.mutex.Lock()
+	candidates := append([]bluetooth.Candidate(nil), p.candidates...)
+	buttons := make([]*widget.Clickable, len(candidates))
+	for i, candidate := range candidates {
+		buttons[i] = p.buttons[candidate.Address]
+	}
+	scanning := p.scanning
+	scanError := p.scanError
+	p.mutex.Unlock()
+
+	for i, candidate := range candidates {
+		if buttons[i].Clicked(gtx) {
+			p.StopScan()
+			p.onPicked(candidate.Address)
+		}
+	}
+	if p.scanButton.Clicked(gtx) {
+		p.StartScan()
+	}
+	if p.backButton.Clicked(gtx) {
+		p.StopScan()
+		p.onBack()
+	}
+
+	status := fmt.Sprintf("Found %d devices", len(candidates))
+	if scanError != nil {
+		status = scanError.Error()
+	} else if scanning {
+		status = fmt.Sprintf("Scanning... found %d devices", len(candidates))
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return material.H6(p.buttonTheme, status).Layout(gtx)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						if !scanning {
+							return layout.Dimensions{}
+						}
+						gtx.Constraints.Max.X = gtx.Dp(24)
+						gtx.Constraints.Max.Y = gtx.Dp(24)
+						return material.Loader(p.buttonTheme).Layout(gtx)
+					}),
+				)
+			})
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return material.List(p.buttonTheme, &p.list).Layout(gtx, len(candidates), func(gtx layout.Context, index int) layout.Dimensions {
+				candidate := candidates[index]
+				return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					btnStyle := material.Button(p.buttonTheme, buttons[index], candidateLabel(candidate))
+					if !candidate.IsSupported() {
+						btnStyle.Background = theme.Surface0Color
+					}
+					return btnStyle.Layout(gtx)
+				})
+			})
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Top: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return material.Button(p.buttonTheme, &p.backButton, "Back").Layout(gtx)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return layout.Spacer{Width: unit.Dp(8)}.Layout(gtx)
+					}),
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						if scanning {
+							return layout.Dimensions{}
+						}
+						return material.Button(p.buttonTheme, &p.scanButton, "Scan Again").Layout(gtx)
+					}),
+				)
+			})
+		}),
+	)
+}
+
+// candidateLabel describes a device like "EarFun UBOOM X  F8:AB:E5:12:34:56  -62 dBm".
+func candidateLabel(candidate bluetooth.Candidate) string {
+	name := candidate.Name
+	if name == "" {
+		name = "Unknown device"
+	}
+	return fmt.Sprintf("%s  %s  %d dBm", name, candidate.Address, candidate.RSSI)
+}
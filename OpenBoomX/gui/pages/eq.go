@@ -8,6 +8,7 @@ import (
 	"obx/gui/components"
 	"obx/gui/controllers"
 	"obx/gui/services"
+	"obx/protocol/eq"
 )
 
 type EqPage struct {
@@ -35,27 +36,22 @@ func NewEqPage(
 	page.speakerController = speakerController
 	page.snackbar = snackbar
 
-	page.eqSlider = components.CreateEqSlider(page.speakerController.OnEqValuesChanged)
+	page.eqSlider = components.CreateEqSlider(page.speakerController.OnEqChanged)
 	// set currently active preset if it exists
 	activePreset := page.eqPresetService.GetActivePreset()
 	if activePreset != "" {
-		eqValues, _ := page.eqPresetService.GetPresetValues(activePreset)
-		err := page.eqSlider.SetSliderValues(eqValues)
+		curve, err := page.eqPresetService.GetPresetCurve(activePreset)
 		if err != nil {
 			log.Println(err)
 		}
+		page.eqSlider.SetCurve(curve)
 	}
 	page.eqPresetService.RegisterListener(page.eqSlider)
 
-	page.eqResetButton = components.CreateEqResetButton(func() {
-		err := page.eqSlider.ResetValues()
-		if err != nil {
-			log.Println(err)
-		}
-	})
+	page.eqResetButton = components.CreateEqResetButton(page.eqSlider.ResetValues)
 
 	page.eqSaveButton = components.CreateEqSaveButton(func(title string) {
-		err := page.eqPresetService.AddPreset(title, page.eqSlider.GetSliderValues())
+		err := page.eqPresetService.AddPreset(title, page.eqSlider.GetCurve())
 		if err != nil {
 			log.Println(err)
 			page.snackbar.ShowMessage(fmt.Sprintf("Error adding preset: %v", err))
@@ -68,6 +64,11 @@ func NewEqPage(
 	return page
 }
 
+// SetCurve shows the custom EQ the speaker is using.
+func (e *EqPage) SetCurve(curve eq.Curve) {
+	e.eqSlider.SetCurve(curve)
+}
+
 func (e *EqPage) Layout(gtx layout.Context) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
@@ -3,16 +3,19 @@ package pages
 import (
 	"gioui.org/layout"
 	"gioui.org/widget/material"
+	"log"
 	"obx/gui/components"
 	"obx/gui/controllers"
 	"obx/gui/routes"
 	"obx/gui/services"
+	"obx/protocol"
 )
 
 type HomePage struct {
 	theme              *material.Theme
 	buttonTheme        *material.Theme
 	topBar             *components.TopBar
+	controlAllButtons  *components.ControlAllButtons
 	snackbar           *components.Snackbar
 	speakerController  *controllers.SpeakerController
 	eqPresetService    *services.EqPresetService
@@ -40,18 +43,25 @@ func NewHomePage(
 	page.eqPresetService = eqPresetService
 	page.colorPresetService = colorPresetService
 	page.snackbar = components.CreateSnackbar()
-	page.currentRoute = routes.Oluv
 
-	page.topBar = components.CreateTopBar(page.theme, page.buttonTheme, func(route routes.AppRoute) {
+	available := availableRoutes(page.speakerController.Model().Capabilities)
+	page.currentRoute = available[0]
+	page.topBar = components.CreateTopBar(page.theme, page.buttonTheme, available, func(route routes.AppRoute) {
 		page.currentRoute = route
 	})
 
+	page.controlAllButtons = components.CreateControlAllButtons(page.speakerController.OnControlAllChanged)
+
 	page.oluvPage = NewOluvPage(page.buttonTheme, page.speakerController)
 	page.eqPage = NewEqPage(page.theme, page.buttonTheme, page.eqPresetService, page.speakerController, page.snackbar)
 	page.presetsPage = NewPresetsPage(page.buttonTheme, page.eqPresetService, page.snackbar)
 	page.lightsPage = NewLightsPage(page.theme, page.buttonTheme, page.speakerController, page.colorPresetService, page.snackbar)
-	page.miscPage = NewMiscPage(page.theme, page.buttonTheme, page.speakerController, page.speakerController.GetFirmwareName())
+	firmware, unknownFirmware := page.speakerController.GetFirmware()
+	page.miscPage = NewMiscPage(page.theme, page.buttonTheme, page.speakerController, firmware, unknownFirmware)
 
+	go page.watchSpeakerState()
+	go page.watchSpeakerEvents()
+	go page.speakerController.ReadSettings()
 	go page.speakerController.UpdateBattery(func(value int, err error) {
 		page.topBar.UpdateBatteryLevel(value)
 		if err != nil {
@@ -62,6 +72,93 @@ func NewHomePage(
 	return page
 }
 
+// availableRoutes returns the pages of the settings the speaker model supports, Misc with the firmware is always there.
+func availableRoutes(capabilities protocol.Capabilities) []routes.AppRoute {
+	var available []routes.AppRoute
+	if len(capabilities.OluvModes) > 0 {
+		available = append(available, routes.Oluv)
+	}
+	if capabilities.EQ != nil {
+		available = append(available, routes.Eq, routes.EqPresets)
+	}
+	if len(capabilities.LightModes) > 0 {
+		available = append(available, routes.Lights)
+	}
+	return append(available, routes.Misc)
+}
+
+// watchSpeakerState shows the last known speaker state and every change the speaker reports.
+// Changes made by this app are already shown by the page that made them.
+func (h *HomePage) watchSpeakerState() {
+	changes, unsubscribe := h.speakerController.SubscribeSpeakerState()
+	defer unsubscribe()
+
+	state := h.speakerController.SpeakerState()
+	for _, field := range []protocol.StateField{
+		protocol.FieldOluvMode,
+		protocol.FieldCustomEQ,
+		protocol.FieldLight,
+		protocol.FieldBeepVolume,
+		protocol.FieldVideoMode,
+		protocol.FieldShutdownTimeout,
+	} {
+		h.showSpeakerState(field, state)
+	}
+
+	for change := range changes {
+		if change.FromSpeaker {
+			h.showSpeakerState(change.Field, change.State)
+		}
+	}
+}
+
+// watchSpeakerEvents tells the user about changes made on the speaker, like pressing its video mode button.
+// The pages are updated by watchSpeakerState, which sees the same frames through the speaker state.
+func (h *HomePage) watchSpeakerEvents() {
+	events, unsubscribe := h.speakerController.SubscribeSpeakerEvents()
+	defer unsubscribe()
+
+	for event := range events {
+		if event.Raw {
+			log.Printf("Unknown frame from speaker %s: %s", event.Frame, event.Description)
+			continue
+		}
+		if message, ok := h.speakerController.EventMessage(event); ok {
+			h.snackbar.ShowMessage(message)
+		}
+	}
+}
+
+func (h *HomePage) showSpeakerState(field protocol.StateField, state protocol.SpeakerState) {
+	switch field {
+	case protocol.FieldOluvMode:
+		if state.OluvMode != nil {
+			h.oluvPage.SetMode(state.OluvMode.String())
+		}
+	case protocol.FieldCustomEQ:
+		if state.CustomEQ != nil {
+			h.oluvPage.SetMode("")
+			h.eqPage.SetCurve(*state.CustomEQ)
+		}
+	case protocol.FieldLight:
+		if state.Light != nil {
+			h.lightsPage.SetLight(*state.Light)
+		}
+	case protocol.FieldBeepVolume:
+		if state.BeepVolume != nil {
+			h.miscPage.SetBeepStep(h.speakerController.BeepStep(*state.BeepVolume))
+		}
+	case protocol.FieldVideoMode:
+		if state.VideoMode != nil {
+			h.miscPage.SetVideoModeEnabled(*state.VideoMode == protocol.VideoModeOn)
+		}
+	case protocol.FieldShutdownTimeout:
+		if state.ShutdownTimeout != nil {
+			h.miscPage.SetShutdownStep(h.speakerController.ShutdownStep(*state.ShutdownTimeout))
+		}
+	}
+}
+
 func (h *HomePage) Update(gtx layout.Context) {
 	h.miscPage.Update(gtx)
 }
@@ -73,6 +170,14 @@ func (h *HomePage) Layout(gtx layout.Context) layout.Dimensions {
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					return h.topBar.Layout(gtx)
 				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					// more speakers may still be connecting, so the buttons appear once the second one is there
+					speakerCount := h.speakerController.SpeakerCount()
+					if speakerCount < 2 {
+						return layout.Dimensions{}
+					}
+					return h.controlAllButtons.Layout(h.buttonTheme, gtx, speakerCount)
+				}),
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
 						layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
@@ -101,6 +206,19 @@ func (h *HomePage) Layout(gtx layout.Context) layout.Dimensions {
 	)
 }
 
+func (h *HomePage) OnConnectionStateChanged(state protocol.ConnectionState) {
+	switch state {
+	case protocol.StateLost:
+		h.topBar.UpdateConnectionStatus("Connection lost")
+		h.snackbar.ShowMessage("Speaker connection lost, reconnecting...")
+	case protocol.StateConnecting:
+		h.topBar.UpdateConnectionStatus("Reconnecting...")
+	case protocol.StateConnected:
+		h.topBar.UpdateConnectionStatus("")
+		h.snackbar.ShowMessage("Reconnected to speaker")
+	}
+}
+
 func (h *HomePage) OnMessage(msg string) {
 	h.snackbar.ShowMessage(msg)
 }
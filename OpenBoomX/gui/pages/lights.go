@@ -9,6 +9,7 @@ import (
 	"obx/gui/components"
 	"obx/gui/controllers"
 	"obx/gui/services"
+	"obx/protocol"
 )
 
 type LightsPage struct {
@@ -75,6 +76,16 @@ func NewLightsPage(
 	return page
 }
 
+// SetLight shows the light color the speaker is using, the default and off lights have no color to show.
+func (l *LightsPage) SetLight(light protocol.LightState) {
+	if light.Mode == protocol.LightModeDefault || light.Color == [3]byte{} {
+		return
+	}
+	c := color.NRGBA{R: light.Color[0], G: light.Color[1], B: light.Color[2], A: 255}
+	l.lightPicker.SetState(c, light.Mode == protocol.LightModeSolid)
+	l.gradientSelector.OnColorSelected(c)
+}
+
 func (l *LightsPage) Layout(gtx layout.Context) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
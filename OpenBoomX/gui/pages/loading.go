@@ -2,28 +2,40 @@ package pages
 
 import (
 	"gioui.org/layout"
+	"gioui.org/unit"
 	"gioui.org/widget"
 	"gioui.org/widget/material"
+	"strings"
 )
 
 type LoadingPage struct {
 	buttonTheme       *material.Theme
 	retryConnection   widget.Clickable
-	onRetryConnection func()
+	findSpeakers      widget.Clickable
+	device            widget.Editor
+	onRetryConnection func(device string)
+	onFindSpeakers    func()
 	appError          error
 }
 
-func NewLoadingPage(buttonTheme *material.Theme, onRetryConnection func()) *LoadingPage {
-	return &LoadingPage{
+func NewLoadingPage(buttonTheme *material.Theme, device string, onRetryConnection func(device string), onFindSpeakers func()) *LoadingPage {
+	page := &LoadingPage{
 		buttonTheme:       buttonTheme,
 		onRetryConnection: onRetryConnection,
+		onFindSpeakers:    onFindSpeakers,
 	}
+	page.device.SingleLine = true
+	page.device.SetText(device)
+	return page
 }
 
 func (l *LoadingPage) Layout(gtx layout.Context) layout.Dimensions {
 	if l.retryConnection.Clicked(gtx) {
 		l.appError = nil
-		l.onRetryConnection()
+		l.onRetryConnection(strings.TrimSpace(l.device.Text()))
+	}
+	if l.findSpeakers.Clicked(gtx) {
+		l.onFindSpeakers()
 	}
 
 	return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
@@ -48,16 +60,37 @@ func (l *LoadingPage) Layout(gtx layout.Context) layout.Dimensions {
 				gtx.Constraints.Max.Y = gtx.Dp(32)
 				return material.Loader(l.buttonTheme).Layout(gtx)
 			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if l.appError == nil {
+					return layout.Dimensions{}
+				}
+				return layout.Inset{Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return material.Editor(l.buttonTheme, &l.device, "Device: MAC, nickname or URI like tcp://host:port, empty for the last used speaker").Layout(gtx)
+				})
+			}),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				if l.appError == nil {
 					return layout.Dimensions{}
 				}
 				return material.Button(l.buttonTheme, &l.retryConnection, "Retry").Layout(gtx)
 			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if l.appError == nil {
+					return layout.Dimensions{}
+				}
+				return layout.Inset{Top: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return material.Button(l.buttonTheme, &l.findSpeakers, "Find Speakers").Layout(gtx)
+				})
+			}),
 		)
 	})
 }
 
+// SetDevice shows device in the device editor.
+func (l *LoadingPage) SetDevice(device string) {
+	l.device.SetText(device)
+}
+
 func (l *LoadingPage) SetError(err error) {
 	l.appError = err
 }
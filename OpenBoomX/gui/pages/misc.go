@@ -6,6 +6,7 @@ import (
 	"gioui.org/widget/material"
 	"obx/gui/components"
 	"obx/gui/controllers"
+	"obx/gui/theme"
 	"obx/protocol"
 	"obx/utils"
 )
@@ -19,13 +20,15 @@ type MiscPage struct {
 	offButton         *components.OffButton
 	speakerController *controllers.SpeakerController
 	firmwareName      widget.Editor
+	unknownFirmware   bool
 }
 
 func NewMiscPage(
 	theme *material.Theme,
 	buttonTheme *material.Theme,
 	speakerController *controllers.SpeakerController,
-	firmwareName string,
+	firmware protocol.FirmwareInfo,
+	unknownFirmware bool,
 ) *MiscPage {
 	page := &MiscPage{}
 	page.theme = theme
@@ -34,35 +37,80 @@ func NewMiscPage(
 
 	page.firmwareName.ReadOnly = true
 	page.firmwareName.SingleLine = true
-	page.firmwareName.SetText(firmwareName)
+	page.firmwareName.SetText(firmware.String())
+	page.unknownFirmware = unknownFirmware
 
-	page.beepSlider = components.CreateBeepSlider(5, "Beep Volume", utils.SortedKeysByValueInt(protocol.BeepVolumes), page.speakerController.OnBeepStepChanged)
-	page.offButton = components.CreateOffButton(page.speakerController.OnOffButtonClicked)
-	page.shutdownSlider = components.CreateBeepSlider(7, "Shutdown Timeout", utils.SortedKeysByValue(protocol.ShutdownTimeouts), page.speakerController.OnShutdownStepChanged)
-	page.videoModeButtons = components.CreateVideoModeButtons(page.speakerController.OnVideoModeEnabled, page.speakerController.OnVideoModeDisabled)
+	// the controls of settings the speaker model doesn't support stay nil and aren't shown
+	capabilities := speakerController.Model().Capabilities
+	if len(capabilities.BeepVolumes) > 1 {
+		page.beepSlider = components.CreateBeepSlider(len(capabilities.BeepVolumes), "Beep Volume", utils.Names(capabilities.BeepVolumes), page.speakerController.OnBeepStepChanged)
+	}
+	if capabilities.PowerOff {
+		page.offButton = components.CreateOffButton(page.speakerController.OnOffButtonClicked)
+	}
+	if len(capabilities.ShutdownTimeouts) > 1 {
+		page.shutdownSlider = components.CreateBeepSlider(len(capabilities.ShutdownTimeouts), "Shutdown Timeout", utils.Names(capabilities.ShutdownTimeouts), page.speakerController.OnShutdownStepChanged)
+	}
+	if capabilities.VideoMode {
+		page.videoModeButtons = components.CreateVideoModeButtons(page.speakerController.OnVideoModeEnabled, page.speakerController.OnVideoModeDisabled)
+	}
 	return page
 }
 
+func (m *MiscPage) SetBeepStep(step int) {
+	if m.beepSlider != nil {
+		m.beepSlider.SetStep(step)
+	}
+}
+
+func (m *MiscPage) SetVideoModeEnabled(enabled bool) {
+	if m.videoModeButtons != nil {
+		m.videoModeButtons.SetEnabled(enabled)
+	}
+}
+
+func (m *MiscPage) SetShutdownStep(step int) {
+	if m.shutdownSlider != nil {
+		m.shutdownSlider.SetStep(step)
+	}
+}
+
 func (m *MiscPage) Update(gtx layout.Context) {
-	m.beepSlider.Update(gtx)
-	m.shutdownSlider.Update(gtx)
+	if m.beepSlider != nil {
+		m.beepSlider.Update(gtx)
+	}
+	if m.shutdownSlider != nil {
+		m.shutdownSlider.Update(gtx)
+	}
 }
 
 func (m *MiscPage) Layout(gtx layout.Context) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if m.beepSlider == nil {
+				return layout.Dimensions{}
+			}
 			return m.beepSlider.Layout(m.theme, gtx)
 		}),
 
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if m.videoModeButtons == nil {
+				return layout.Dimensions{}
+			}
 			return m.videoModeButtons.Layout(m.buttonTheme, gtx)
 		}),
 
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if m.shutdownSlider == nil {
+				return layout.Dimensions{}
+			}
 			return m.shutdownSlider.Layout(m.theme, gtx)
 		}),
 
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if m.offButton == nil {
+				return layout.Dimensions{}
+			}
 			return m.offButton.Layout(m.buttonTheme, gtx)
 		}),
 
@@ -78,5 +126,14 @@ func (m *MiscPage) Layout(gtx layout.Context) layout.Dimensions {
 				}),
 			)
 		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if !m.unknownFirmware {
+				return layout.Dimensions{}
+			}
+			label := material.Body2(m.theme, "Unknown firmware, some settings may not work as expected")
+			label.Color = theme.WarningColor
+			return label.Layout(gtx)
+		}),
 	)
 }
@@ -5,7 +5,6 @@ import (
 	"gioui.org/widget/material"
 	"obx/gui/components"
 	"obx/gui/controllers"
-	"obx/protocol"
 	"obx/utils"
 )
 
@@ -19,12 +18,17 @@ func NewOluvPage(buttonTheme *material.Theme, speakerController *controllers.Spe
 	page := &OluvPage{}
 	page.buttonTheme = buttonTheme
 	page.eqButtons = components.CreateEQButtons(
-		utils.SortedKeysByValue(protocol.EQModes),
+		utils.Names(speakerController.Model().Capabilities.OluvModes),
 		speakerController.OnModeClicked,
 	)
 	return page
 }
 
+// SetMode highlights the mode the speaker is using, an empty mode highlights none.
+func (o *OluvPage) SetMode(mode string) {
+	o.eqButtons.SetSelected(mode)
+}
+
 func (o *OluvPage) Layout(gtx layout.Context) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
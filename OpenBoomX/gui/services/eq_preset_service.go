@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"obx/gui/constants"
+	"obx/protocol/eq"
 	"os"
 	"path/filepath"
 	"sort"
@@ -14,7 +15,7 @@ import (
 )
 
 type PresetChangeListener interface {
-	OnPresetChanged(newPreset string, values []float32)
+	OnPresetChanged(newPreset string, curve eq.Curve)
 }
 
 type EqPresetService struct {
@@ -26,7 +27,9 @@ type EqPresetService struct {
 }
 
 type PresetDetails struct {
-	Values    []float32 `json:"values"`
+	Curve eq.Curve `json:"curve"`
+	// Values are the slider positions older versions saved instead of the curve, they are migrated on load
+	Values    []float32 `json:"values,omitempty"`
 	Timestamp int64     `json:"timestamp"`
 }
 
@@ -84,9 +87,38 @@ func (service *EqPresetService) loadPresets() error {
 	service.activePreset = configData.ActivePreset
 	service.presets = configData.Presets
 
+	if service.migratePresets() {
+		return service.savePresets()
+	}
 	return nil
 }
 
+// migratePresets converts the slider positions of older versions, which had +10 dB at 0, to curves.
+// It returns true if any preset was migrated.
+func (service *EqPresetService) migratePresets() bool {
+	migrated := false
+	for title, details := range service.presets {
+		if details.Values == nil {
+			continue
+		}
+		if len(details.Values) != eq.BandCount {
+			log.Printf("Preset '%s' has %d bands instead of %d, resetting it to flat", title, len(details.Values), eq.BandCount)
+		}
+		var curve eq.Curve
+		for i := 0; i < len(details.Values) && i < eq.BandCount; i++ {
+			curve[i] = eq.GainAt(1 - float64(details.Values[i]))
+		}
+		if len(details.Values) != eq.BandCount {
+			curve = eq.Flat()
+		}
+		details.Curve = curve.Quantize()
+		details.Values = nil
+		service.presets[title] = details
+		migrated = true
+	}
+	return migrated
+}
+
 func (service *EqPresetService) savePresets() error {
 	configData := PresetData{
 		ActivePreset: service.activePreset,
@@ -106,9 +138,9 @@ func (service *EqPresetService) savePresets() error {
 	return nil
 }
 
-func (service *EqPresetService) AddPreset(title string, values []float32) error {
+func (service *EqPresetService) AddPreset(title string, curve eq.Curve) error {
 	service.presets[title] = PresetDetails{
-		Values:    values,
+		Curve:     curve,
 		Timestamp: time.Now().Unix(),
 	}
 	service.activePreset = title
@@ -159,16 +191,12 @@ func (service *EqPresetService) SetActivePreset(title string) error {
 	return nil
 }
 
-func (service *EqPresetService) GetPresetValues(title string) ([]float32, error) {
+func (service *EqPresetService) GetPresetCurve(title string) (eq.Curve, error) {
 	presetDetails, exists := service.presets[title]
 	if !exists {
-		return nil, fmt.Errorf("preset with title '%s' not found", title)
+		return eq.Curve{}, fmt.Errorf("preset with title '%s' not found", title)
 	}
-
-	valuesCopy := make([]float32, len(presetDetails.Values))
-	copy(valuesCopy, presetDetails.Values)
-
-	return valuesCopy, nil
+	return presetDetails.Curve, nil
 }
 
 func (service *EqPresetService) ListPresets() []string {
@@ -195,8 +223,8 @@ func (service *EqPresetService) RemoveListener(listener PresetChangeListener) {
 }
 
 func (service *EqPresetService) notifyListeners() {
-	activePresetValues, _ := service.GetPresetValues(service.activePreset)
+	activePresetCurve, _ := service.GetPresetCurve(service.activePreset)
 	for _, listener := range service.listeners {
-		listener.OnPresetChanged(service.activePreset, activePresetValues)
+		listener.OnPresetChanged(service.activePreset, activePresetCurve)
 	}
 }
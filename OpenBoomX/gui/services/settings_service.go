@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"obx/gui/constants"
+	"os"
+	"path/filepath"
+)
+
+type SettingsService struct {
+	configDir        string
+	settingsFilePath string
+	settings         SettingsData
+}
+
+type SettingsData struct {
+	// Device is a MAC address or device URI, see protocol.Dial. Empty scans for the speaker.
+	Device string `json:"device"`
+	// Devices are more speakers that can be controlled together with Device, see protocol.SpeakerGroup.
+	Devices []string `json:"devices,omitempty"`
+	// Record is a JSONL session file every sent and received frame is written to. Empty disables recording.
+	Record string `json:"record"`
+}
+
+func NewSettingsService() *SettingsService {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		log.Fatalf("Error getting user config directory: %v", err)
+	}
+
+	service := &SettingsService{
+		configDir:        filepath.Join(configDir, constants.AppName),
+		settingsFilePath: filepath.Join(configDir, constants.AppName, "settings.json"),
+	}
+
+	if err := service.ensureConfigDir(); err != nil {
+		log.Fatalf("Error creating config directory: %v", err)
+	}
+
+	if err := service.loadSettings(); err != nil {
+		log.Fatalf("Error loading settings: %v", err)
+	}
+
+	return service
+}
+
+func (service *SettingsService) ensureConfigDir() error {
+	if _, err := os.Stat(service.configDir); os.IsNotExist(err) {
+		return os.MkdirAll(service.configDir, 0755)
+	}
+	return nil
+}
+
+func (service *SettingsService) loadSettings() error {
+	dataFile, err := os.ReadFile(service.settingsFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return service.saveSettings()
+		}
+		return fmt.Errorf("error reading settings file: %w", err)
+	}
+
+	err = json.Unmarshal(dataFile, &service.settings)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling JSON: %w", err)
+	}
+
+	return nil
+}
+
+func (service *SettingsService) saveSettings() error {
+	data, err := json.MarshalIndent(service.settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling JSON: %w", err)
+	}
+
+	err = os.WriteFile(service.settingsFilePath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing settings file: %w", err)
+	}
+
+	return nil
+}
+
+func (service *SettingsService) GetDevice() string {
+	return service.settings.Device
+}
+
+func (service *SettingsService) SetDevice(device string) error {
+	service.settings.Device = device
+	if err := service.saveSettings(); err != nil {
+		return fmt.Errorf("error saving settings after setting device: %w", err)
+	}
+	return nil
+}
+
+func (service *SettingsService) GetDevices() []string {
+	return service.settings.Devices
+}
+
+func (service *SettingsService) GetRecord() string {
+	return service.settings.Record
+}
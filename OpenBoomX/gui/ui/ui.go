@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"context"
+	"fmt"
 	"gioui.org/app"
 	"gioui.org/font/gofont"
 	"gioui.org/layout"
@@ -13,24 +15,33 @@ import (
 	"obx/gui/controllers"
 	"obx/gui/pages"
 	"obx/gui/services"
-	"obx/gui/testing"
 	"obx/gui/theme"
 	"obx/protocol"
+	"obx/protocol/emulator"
 	"obx/utils/bluetooth"
+	"slices"
+	"time"
 )
 
 var defaultMargin = unit.Dp(10)
 
+const connectTimeout = 30 * time.Second
+
 type UI struct {
 	theme              *material.Theme
 	buttonTheme        *material.Theme
 	eqPresetService    *services.EqPresetService
 	colorPresetService *services.ColorPresetService
+	settingsService    *services.SettingsService
 	speakerController  *controllers.SpeakerController
 	speakerClient      protocol.ISpeakerClient
+	speakerGroup       *protocol.SpeakerGroup
 	homePage           *pages.HomePage
 	loadingPage        *pages.LoadingPage
-	loaded             bool
+	devicePickerPage   *pages.DevicePickerPage
+	// picking is set while the device picker is shown instead of the loading page
+	picking bool
+	loaded  bool
 }
 
 func NewUI() *UI {
@@ -41,34 +52,139 @@ func NewUI() *UI {
 	ui.theme = &th
 	btnTheme := _th.WithPalette(theme.ButtonPalette)
 	ui.buttonTheme = &btnTheme
-	ui.loadingPage = pages.NewLoadingPage(ui.buttonTheme, func() {
+	ui.settingsService = services.NewSettingsService()
+	ui.loadingPage = pages.NewLoadingPage(ui.buttonTheme, ui.settingsService.GetDevice(), func(device string) {
+		err := ui.settingsService.SetDevice(device)
+		if err != nil {
+			log.Println(err)
+		}
 		go ui.connectSpeaker()
+	}, func() {
+		ui.picking = true
+		ui.devicePickerPage.StartScan()
+	})
+	ui.devicePickerPage = pages.NewDevicePickerPage(ui.buttonTheme, func(device string) {
+		if err := ui.settingsService.SetDevice(device); err != nil {
+			log.Println(err)
+		}
+		ui.loadingPage.SetDevice(device)
+		ui.loadingPage.SetError(nil)
+		ui.picking = false
+		go ui.connectSpeaker()
+	}, func() {
+		ui.picking = false
 	})
 
 	go ui.connectSpeaker()
 	// add comments to line above and uncomment below
-	// to connect a mock speaker for GUI development
+	// to connect an emulated speaker for GUI development
 	// go ui.connectTestSpeaker()
 	return ui
 }
 
 func (ui *UI) connectTestSpeaker() {
-	client := &testing.MockSpeakerClient{}
-	ui.initialize(client)
+	speaker := emulator.New()
+	speaker.SetBatteryDrain(time.Minute)
+	client := protocol.NewSpeakerClient(speaker, protocol.UBoomX)
+	group := protocol.NewSpeakerGroup()
+	_ = group.Add("emulator", client)
+	ui.initialize(client, group)
 }
 
 func (ui *UI) connectSpeaker() {
-	client, err := bluetooth.ConnectUBoomX()
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	supervisor, device, err := bluetooth.SuperviseUBoomX(ctx, ui.settingsService.GetDevice())
 	if err != nil {
 		ui.loadingPage.SetError(err)
 		return
 	}
-	ui.initialize(client)
+	var rfcomm protocol.RfcommClient = supervisor
+	if record := ui.settingsService.GetRecord(); record != "" {
+		rfcomm, err = protocol.NewSessionRecorder(supervisor, record)
+		if err != nil {
+			_ = supervisor.CloseSocket()
+			ui.loadingPage.SetError(err)
+			return
+		}
+	}
+
+	client := protocol.NewSpeakerClient(rfcomm, bluetooth.ModelOf(device))
+	if err := bluetooth.PersistState(client, device); err != nil {
+		log.Println(err)
+	}
+	// the firmware is read before the pages are created, so they only offer what the firmware's quirks allow
+	firmwareCtx, cancelFirmware := context.WithTimeout(context.Background(), connectTimeout)
+	if firmware, err := client.ReadFirmwarePackageName(firmwareCtx); err != nil {
+		log.Println(err)
+	} else if err := bluetooth.RecordFirmware(device, firmware); err != nil {
+		log.Println(err)
+	}
+	cancelFirmware()
+	group := protocol.NewSpeakerGroup()
+	_ = group.Add(device, client)
+	ui.initialize(client, group)
+	go ui.watchConnection(supervisor)
+	go ui.connectMoreSpeakers(group)
+}
+
+// connectMoreSpeakers adds the other speakers of the settings to group, for the "control all" mode.
+// The first speaker is usable meanwhile, a speaker that can't be reached is only reported.
+func (ui *UI) connectMoreSpeakers(group *protocol.SpeakerGroup) {
+	for _, device := range ui.settingsService.GetDevices() {
+		if device == "" {
+			continue
+		}
+		selected, _, err := bluetooth.SelectUBoomX(device)
+		if err == nil && slices.Contains(group.Devices(), selected) {
+			continue
+		}
+		var client protocol.ISpeakerClient
+		if err == nil {
+			client, err = ui.connectMoreSpeaker(selected)
+		}
+		if err != nil {
+			log.Printf("Error connecting speaker %s: %v", device, err)
+			ui.homePage.OnMessage(fmt.Sprintf("Could not connect speaker %s", device))
+			continue
+		}
+		if err := group.Add(selected, client); err != nil {
+			log.Println(err)
+			_ = client.CloseConnection()
+		}
+	}
 }
 
-func (ui *UI) initialize(client protocol.ISpeakerClient) {
+func (ui *UI) connectMoreSpeaker(device string) (protocol.ISpeakerClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	supervisor, _, err := bluetooth.SuperviseUBoomX(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	client := protocol.NewSpeakerClient(supervisor, bluetooth.ModelOf(device))
+	if err := bluetooth.PersistState(client, device); err != nil {
+		log.Println(err)
+	}
+	return client, nil
+}
+
+// watchConnection shows connection drops and reconnects while the supervisor is reconnecting in the background
+func (ui *UI) watchConnection(supervisor *protocol.Supervisor) {
+	states, unsubscribe := supervisor.Subscribe()
+	defer unsubscribe()
+
+	for state := range states {
+		ui.homePage.OnConnectionStateChanged(state)
+	}
+}
+
+func (ui *UI) initialize(client protocol.ISpeakerClient, group *protocol.SpeakerGroup) {
 	ui.speakerClient = client
-	ui.speakerController = controllers.NewSpeakerController(client)
+	ui.speakerGroup = group
+	ui.speakerController = controllers.NewSpeakerController(client, group)
 	ui.eqPresetService = services.NewEqPresetService()
 	ui.colorPresetService = services.NewColorPresetService()
 
@@ -131,6 +247,9 @@ func (ui *UI) layout(gtx layout.Context) layout.Dimensions {
 		}),
 		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
 			return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				if !ui.loaded && ui.picking {
+					return ui.devicePickerPage.Layout(gtx)
+				}
 				if !ui.loaded {
 					return ui.loadingPage.Layout(gtx)
 				}
@@ -141,8 +260,9 @@ func (ui *UI) layout(gtx layout.Context) layout.Dimensions {
 }
 
 func (ui *UI) Dispose() {
-	if ui.speakerClient != nil {
-		err := ui.speakerClient.CloseConnection()
+	if ui.speakerGroup != nil {
+		// the group also closes the first speaker
+		err := ui.speakerGroup.CloseConnection()
 		if err != nil {
 			log.Printf("Error closing speaker connection: %v", err)
 		}
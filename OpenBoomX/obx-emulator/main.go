@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"obx/protocol"
+	"obx/protocol/emulator"
+	"obx/utils"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// speakerState is shared by all connections, so settings survive reconnects like on a real speaker
+type speakerState struct {
+	mutex sync.Mutex
+	state emulator.State
+}
+
+func main() {
+	listen := flag.String("listen", "tcp://127.0.0.1:9000", "Address to serve on: tcp://host:port or unix:///path/to/socket")
+	battery := flag.Int("battery", emulator.DefaultState.Battery, "Initial battery level in percent")
+	drain := flag.Duration("drain", 0, "Lose 1% battery every interval, e.g. 1m. 0 disables draining")
+	firmware := flag.String("firmware", emulator.DefaultFirmware, "Firmware package name reported to clients")
+	delay := flag.Duration("delay", 0, "Delay every reply by this duration")
+	malformed := flag.Bool("malformed", false, "Send malformed replies")
+
+	flag.Parse()
+
+	network, address, err := parseListenAddress(*listen)
+	utils.Must("parse listen address", err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	listener, err := (&net.ListenConfig{}).Listen(ctx, network, address)
+	utils.Must("listen", err)
+	context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+	})
+	log.Printf("Emulating %s on %s", protocol.UBoomXName, *listen)
+
+	initial := emulator.DefaultState
+	initial.Battery = *battery
+	initial.Firmware = *firmware
+	shared := &speakerState{state: initial}
+	faults := emulator.Faults{ReplyDelay: *delay, MalformedReplies: *malformed}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Accept failed: %v", err)
+			continue
+		}
+		go serve(ctx, conn, shared, faults, *drain)
+	}
+}
+
+func serve(ctx context.Context, conn net.Conn, shared *speakerState, faults emulator.Faults, drain time.Duration) {
+	remote := conn.RemoteAddr().String()
+	log.Printf("[%s] connected", remote)
+
+	shared.mutex.Lock()
+	state := shared.state
+	shared.mutex.Unlock()
+	// connecting powers the speaker back on
+	state.PoweredOff = false
+
+	speaker := emulator.NewFromState(state)
+	speaker.SetFaults(faults)
+	speaker.SetBatteryDrain(drain)
+	speaker.OnFrame(func(frame protocol.Frame) {
+		log.Printf("[%s] rx %s", remote, frame)
+	})
+
+	err := speaker.Serve(ctx, conn)
+	if err != nil {
+		log.Printf("[%s] %v", remote, err)
+	}
+
+	shared.mutex.Lock()
+	shared.state = speaker.State()
+	shared.mutex.Unlock()
+	log.Printf("[%s] disconnected", remote)
+}
+
+func parseListenAddress(listen string) (string, string, error) {
+	u, err := url.Parse(listen)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return "tcp", u.Host, nil
+	case "unix":
+		return "unix", u.Path, nil
+	default:
+		return "", "", fmt.Errorf("unsupported listen address %s, use tcp://host:port or unix:///path", listen)
+	}
+}
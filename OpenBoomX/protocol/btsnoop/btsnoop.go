@@ -0,0 +1,125 @@
+// Package btsnoop reads btsnoop HCI logs, like the btsnoop_hci.log Android writes with Bluetooth HCI snoop logging enabled.
+package btsnoop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrNotBtsnoop = errors.New("not a btsnoop file")
+
+// Datalink types of the HCI packets in a btsnoop file
+const (
+	DatalinkH1 uint32 = 1001 // un-encapsulated HCI, the packet type is given by the record flags
+	DatalinkH4 uint32 = 1002 // HCI UART, every packet starts with its type
+)
+
+// HCI packet types, as used by H4
+const (
+	PacketCommand byte = 0x01
+	PacketACL     byte = 0x02
+	PacketSCO     byte = 0x03
+	PacketEvent   byte = 0x04
+)
+
+var magic = []byte("btsnoop\x00")
+
+// epoch is the btsnoop timestamp of 1970-01-01, timestamps are microseconds since midnight January 1st 0 AD
+const epoch = 0x00dcddb30f2f8000
+
+const (
+	headerSize       = 16
+	recordHeaderSize = 24
+	flagReceived     = 1 << 0
+	flagCommand      = 1 << 1
+	// maxRecordSize is the size of the longest HCI packet, an H4 ACL packet with the most data an ACL header allows
+	maxRecordSize = 1 + 4 + 0xffff
+)
+
+// Record is a single HCI packet of a btsnoop file.
+type Record struct {
+	Timestamp time.Time
+	// Received is true for packets from the controller to the host, false for packets the host sent
+	Received bool
+	Type     byte
+	Data     []byte
+}
+
+// Reader reads the records of a btsnoop file.
+type Reader struct {
+	reader   *bufio.Reader
+	datalink uint32
+}
+
+// NewReader reads the file header, only H1 and H4 datalinks are supported.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotBtsnoop, err)
+	}
+	if !bytes.Equal(header[:8], magic) {
+		return nil, ErrNotBtsnoop
+	}
+	if version := binary.BigEndian.Uint32(header[8:]); version != 1 {
+		return nil, fmt.Errorf("unsupported btsnoop version %d", version)
+	}
+
+	datalink := binary.BigEndian.Uint32(header[12:])
+	if datalink != DatalinkH1 && datalink != DatalinkH4 {
+		return nil, fmt.Errorf("unsupported btsnoop datalink %d", datalink)
+	}
+	return &Reader{reader: reader, datalink: datalink}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the file.
+func (r *Reader) Next() (Record, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Record{}, fmt.Errorf("truncated btsnoop record header: %w", err)
+		}
+		return Record{}, err
+	}
+
+	includedLength := binary.BigEndian.Uint32(header[4:])
+	flags := binary.BigEndian.Uint32(header[8:])
+	timestamp := int64(binary.BigEndian.Uint64(header[16:]))
+	if includedLength > maxRecordSize {
+		return Record{}, fmt.Errorf("invalid btsnoop record of %d bytes, longer than any HCI packet", includedLength)
+	}
+
+	data := make([]byte, includedLength)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return Record{}, fmt.Errorf("truncated btsnoop record: %w", err)
+	}
+
+	record := Record{
+		Timestamp: time.UnixMicro(timestamp - epoch),
+		Received:  flags&flagReceived != 0,
+	}
+
+	if r.datalink == DatalinkH4 {
+		if len(data) == 0 {
+			return Record{}, fmt.Errorf("empty H4 packet")
+		}
+		record.Type, record.Data = data[0], data[1:]
+		return record, nil
+	}
+
+	record.Data = data
+	switch {
+	case flags&flagCommand == 0:
+		record.Type = PacketACL
+	case record.Received:
+		record.Type = PacketEvent
+	default:
+		record.Type = PacketCommand
+	}
+	return record, nil
+}
@@ -0,0 +1,359 @@
+package btsnoop
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"obx/protocol"
+	"testing"
+	"time"
+)
+
+// capture builds a btsnoop file with the H4 datalink.
+type capture struct {
+	bytes.Buffer
+	elapsed time.Duration
+}
+
+func newCapture() *capture {
+	c := &capture{}
+	c.Write(magic)
+	c.Write(binary.BigEndian.AppendUint32(nil, 1))
+	c.Write(binary.BigEndian.AppendUint32(nil, DatalinkH4))
+	return c
+}
+
+// record adds an H4 packet, 10 ms after the previous one.
+func (c *capture) record(received bool, packetType byte, data []byte) {
+	packet := append([]byte{packetType}, data...)
+	flags := uint32(0)
+	if received {
+		flags |= flagReceived
+	}
+	if packetType == PacketCommand || packetType == PacketEvent {
+		flags |= flagCommand
+	}
+	c.elapsed += 10 * time.Millisecond
+
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(packet)))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(packet)))
+	header = binary.BigEndian.AppendUint32(header, flags)
+	header = binary.BigEndian.AppendUint32(header, 0)
+	header = binary.BigEndian.AppendUint64(header, uint64(epoch+c.elapsed.Microseconds()))
+	c.Write(header)
+	c.Write(packet)
+}
+
+// connectionComplete adds the event of a new ACL connection to address, given as in the MAC address.
+func (c *capture) connectionComplete(handle uint16, address [6]byte) {
+	event := []byte{eventConnectionComplete, connectionCompleteEventSize, 0x00}
+	event = binary.LittleEndian.AppendUint16(event, handle)
+	for i := len(address) - 1; i >= 0; i-- {
+		event = append(event, address[i])
+	}
+	event = append(event, 0x01, 0x00)
+	c.record(true, PacketEvent, event)
+}
+
+// acl adds an ACL packet with the packet boundary flag of a start or continuing fragment.
+func (c *capture) acl(received bool, handle uint16, continuing bool, payload []byte) {
+	boundary := uint16(0x2)
+	if continuing {
+		boundary = aclContinuingFragment
+	}
+	data := binary.LittleEndian.AppendUint16(nil, handle|boundary<<12)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(payload)))
+	c.record(received, PacketACL, append(data, payload...))
+}
+
+func l2cap(cid uint16, payload []byte) []byte {
+	packet := binary.LittleEndian.AppendUint16(nil, uint16(len(payload)))
+	packet = binary.LittleEndian.AppendUint16(packet, cid)
+	return append(packet, payload...)
+}
+
+// connectRfcomm adds the L2CAP connection to PSM 3 with the host's CID 0x40 and the device's CID 0x41.
+func (c *capture) connectRfcomm(handle uint16, identifier byte) {
+	request := []byte{signalConnectionRequest, identifier, 4, 0}
+	request = binary.LittleEndian.AppendUint16(request, psmRfcomm)
+	request = binary.LittleEndian.AppendUint16(request, 0x40)
+	c.acl(false, handle, false, l2cap(cidSignaling, request))
+
+	response := []byte{signalConnectionResponse, identifier, 8, 0}
+	response = binary.LittleEndian.AppendUint16(response, 0x41)
+	response = binary.LittleEndian.AppendUint16(response, 0x40)
+	response = binary.LittleEndian.AppendUint16(response, connectionResultSuccess)
+	response = binary.LittleEndian.AppendUint16(response, 0)
+	c.acl(true, handle, false, l2cap(cidSignaling, response))
+}
+
+// uih options
+const (
+	withCredit = 1 << iota
+	longLength
+)
+
+// uih returns an RFCOMM UIH frame of the server channel carrying payload.
+func uih(channel uint8, options int, payload []byte) []byte {
+	dlci := channel << 1
+	control := rfcommUIH
+	if options&withCredit != 0 {
+		control |= rfcommPollFinal
+	}
+	frame := []byte{dlci<<2 | 0x03, control}
+	if options&longLength != 0 {
+		frame = append(frame, byte(len(payload)&0x7f)<<1, byte(len(payload)>>7))
+	} else {
+		frame = append(frame, byte(len(payload))<<1|0x01)
+	}
+	if options&withCredit != 0 {
+		frame = append(frame, 0x21)
+	}
+	frame = append(frame, payload...)
+	// the FCS isn't checked
+	return append(frame, 0x00)
+}
+
+// rfcommPacket is the L2CAP packet of a UIH frame on the RFCOMM channel, the CID is the receiver's.
+func rfcommPacket(received bool, channel uint8, options int, payload []byte) []byte {
+	cid := uint16(0x41)
+	if received {
+		cid = 0x40
+	}
+	return l2cap(cid, uih(channel, options, payload))
+}
+
+func encode(t *testing.T, frame protocol.Frame) []byte {
+	t.Helper()
+	data, err := frame.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+var speakerAddress = [6]byte{0xf8, 0xab, 0xe5, 0x12, 0x34, 0x56}
+
+type wantEntry struct {
+	direction protocol.Direction
+	hex       string
+}
+
+func checkEntries(t *testing.T, entries []protocol.SessionEntry, want []wantEntry) {
+	t.Helper()
+	if len(entries) != len(want) {
+		t.Fatalf("ExtractSession() = %+v, want %d entries", entries, len(want))
+	}
+	for i, entry := range entries {
+		if entry.Direction != want[i].direction || entry.Hex != want[i].hex {
+			t.Errorf("entry %d = %s %s, want %s %s", i, entry.Direction, entry.Hex, want[i].direction, want[i].hex)
+		}
+	}
+}
+
+func TestExtractSession(t *testing.T) {
+	request := encode(t, protocol.NewBatteryLevelRequestFrame())
+	reply := encode(t, protocol.NewFrame(protocol.ClassRead, protocol.OpBatteryLevel, 95))
+	write := encode(t, protocol.NewFrame(protocol.ClassWrite, protocol.OpOluvMode, byte(protocol.OluvBoom)))
+
+	tests := []struct {
+		name    string
+		build   func(c *capture)
+		options Options
+		want    []wantEntry
+	}{
+		{
+			name: "request and reply",
+			build: func(c *capture) {
+				c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, request))
+				c.acl(true, 1, false, rfcommPacket(true, protocol.RfcommChannel, 0, reply))
+			},
+			want: []wantEntry{{protocol.DirectionTX, "efa0140000fe"}, {protocol.DirectionRX, "efa014015f60fe"}},
+		},
+		{
+			name: "ACL fragments",
+			build: func(c *capture) {
+				packet := rfcommPacket(true, protocol.RfcommChannel, 0, reply)
+				c.acl(true, 1, false, packet[:3])
+				c.acl(true, 1, true, packet[3:9])
+				c.acl(true, 1, true, packet[9:])
+			},
+			want: []wantEntry{{protocol.DirectionRX, "efa014015f60fe"}},
+		},
+		{
+			name: "continuing fragment without a start",
+			build: func(c *capture) {
+				packet := rfcommPacket(true, protocol.RfcommChannel, 0, reply)
+				c.acl(true, 1, true, packet[3:])
+				c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, request))
+			},
+			want: []wantEntry{{protocol.DirectionTX, "efa0140000fe"}},
+		},
+		{
+			name: "UIH with a credit byte",
+			build: func(c *capture) {
+				c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, withCredit, write))
+			},
+			want: []wantEntry{{protocol.DirectionTX, "efb046010607fe"}},
+		},
+		{
+			name: "2 byte length",
+			build: func(c *capture) {
+				c.acl(true, 1, false, rfcommPacket(true, protocol.RfcommChannel, longLength, reply))
+				c.acl(true, 1, false, rfcommPacket(true, protocol.RfcommChannel, longLength|withCredit, reply))
+			},
+			want: []wantEntry{{protocol.DirectionRX, "efa014015f60fe"}, {protocol.DirectionRX, "efa014015f60fe"}},
+		},
+		{
+			name: "frame split over UIH frames",
+			build: func(c *capture) {
+				c.acl(true, 1, false, rfcommPacket(true, protocol.RfcommChannel, 0, reply[:4]))
+				c.acl(true, 1, false, rfcommPacket(true, protocol.RfcommChannel, 0, reply[4:]))
+			},
+			want: []wantEntry{{protocol.DirectionRX, "efa014015f60fe"}},
+		},
+		{
+			name: "other channel",
+			build: func(c *capture) {
+				c.acl(false, 1, false, rfcommPacket(false, 5, 0, request))
+				c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, write))
+			},
+			options: Options{Channel: 5},
+			want:    []wantEntry{{protocol.DirectionTX, "efa0140000fe"}},
+		},
+		{
+			name: "default channel",
+			build: func(c *capture) {
+				c.acl(false, 1, false, rfcommPacket(false, 5, 0, request))
+				c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, write))
+			},
+			want: []wantEntry{{protocol.DirectionTX, "efb046010607fe"}},
+		},
+		{
+			name: "address",
+			build: func(c *capture) {
+				c.connectionComplete(2, [6]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})
+				c.connectRfcomm(2, 1)
+				c.acl(false, 2, false, rfcommPacket(false, protocol.RfcommChannel, 0, write))
+				c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, request))
+			},
+			options: Options{Address: "f8:ab:e5:12:34:56"},
+			want:    []wantEntry{{protocol.DirectionTX, "efa0140000fe"}},
+		},
+		{
+			name: "not RFCOMM",
+			build: func(c *capture) {
+				// an L2CAP channel without a connection to PSM 3
+				c.acl(false, 1, false, l2cap(0x50, uih(protocol.RfcommChannel, 0, write)))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCapture()
+			c.connectionComplete(1, speakerAddress)
+			c.connectRfcomm(1, 1)
+			tt.build(c)
+
+			entries, err := ExtractSession(c, tt.options)
+			if err != nil {
+				t.Fatalf("ExtractSession() error = %v", err)
+			}
+			checkEntries(t, entries, tt.want)
+		})
+	}
+}
+
+func TestExtractSessionElapsed(t *testing.T) {
+	c := newCapture()
+	c.connectRfcomm(1, 1)
+	c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, encode(t, protocol.NewBatteryLevelRequestFrame())))
+
+	entries, err := ExtractSession(c, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first record is the start of the session, the frame is two records later
+	if len(entries) != 1 || entries[0].Elapsed != 20*time.Millisecond {
+		t.Errorf("ExtractSession() = %+v, want one entry after 20ms", entries)
+	}
+}
+
+func TestExtractSessionErrors(t *testing.T) {
+	valid := newCapture()
+	valid.connectRfcomm(1, 1)
+	data := valid.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotBtsnoop},
+		{"wrong magic", append([]byte("btsnoot\x00"), data[8:]...), ErrNotBtsnoop},
+		{"truncated header", data[:10], ErrNotBtsnoop},
+		{"truncated record header", data[:headerSize+10], nil},
+		{"truncated record", data[:len(data)-3], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExtractSession(bytes.NewReader(tt.data), Options{})
+			if err == nil {
+				t.Fatal("ExtractSession() error = nil")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ExtractSession() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	long := bytes.Clone(data)
+	binary.BigEndian.PutUint32(long[headerSize+4:], maxRecordSize+1)
+	if _, err := ExtractSession(bytes.NewReader(long), Options{}); err == nil {
+		t.Error("ExtractSession() of a record longer than any HCI packet succeeded")
+	}
+
+	version := bytes.Clone(data)
+	version[11] = 2
+	if _, err := ExtractSession(bytes.NewReader(version), Options{}); err == nil {
+		t.Error("ExtractSession() of btsnoop version 2 succeeded")
+	}
+}
+
+func TestExtractSessionIgnoresGarbage(t *testing.T) {
+	c := newCapture()
+	c.connectRfcomm(1, 1)
+	c.record(false, PacketACL, []byte{0x01})
+	c.record(true, PacketEvent, []byte{eventConnectionComplete, 0x01})
+	c.record(false, PacketACL, nil)
+	// an L2CAP length longer than the ACL packet, the rest never arrives
+	c.acl(false, 1, false, []byte{0xff, 0xff, 0x41, 0x00, 0x01})
+	// signaling with a command longer than the packet
+	c.acl(false, 1, false, l2cap(cidSignaling, []byte{signalConnectionRequest, 2, 0xff, 0x00, 0x03}))
+	// RFCOMM frames that are too short or longer than their packet
+	c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, nil)[:l2capHeaderSize+2])
+	c.acl(false, 1, false, l2cap(0x41, []byte{protocol.RfcommChannel<<3 | 0x03, rfcommUIH, 0xfe}))
+	c.acl(false, 1, false, l2cap(0x41, []byte{protocol.RfcommChannel<<3 | 0x03, rfcommUIH, 0x21, 0x01}))
+	// bytes between frames are garbage
+	c.acl(false, 1, false, rfcommPacket(false, protocol.RfcommChannel, 0, append([]byte{0x12, 0x34}, encode(t, protocol.NewBatteryLevelRequestFrame())...)))
+
+	entries, err := ExtractSession(c, Options{})
+	if err != nil {
+		t.Fatalf("ExtractSession() error = %v", err)
+	}
+	checkEntries(t, entries, []wantEntry{{protocol.DirectionTX, "1234"}, {protocol.DirectionTX, "efa0140000fe"}})
+}
+
+func FuzzExtractSession(f *testing.F) {
+	c := newCapture()
+	c.connectionComplete(1, speakerAddress)
+	c.connectRfcomm(1, 1)
+	c.acl(true, 1, false, rfcommPacket(true, protocol.RfcommChannel, withCredit|longLength, []byte{0xef, 0xa0, 0x14, 0x01, 0x5f, 0x60, 0xfe}))
+	f.Add(c.Bytes())
+	f.Add(newCapture().Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// must not panic, errors are fine
+		_, _ = ExtractSession(bytes.NewReader(data), Options{})
+	})
+}
@@ -0,0 +1,283 @@
+package btsnoop
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"obx/protocol"
+	"strings"
+	"time"
+)
+
+// Options select the RFCOMM traffic to extract.
+type Options struct {
+	// Channel is the RFCOMM server channel, protocol.RfcommChannel if zero
+	Channel uint8
+	// Address only keeps connections to this device, e.g. F8:AB:E5:12:34:56. All devices are kept if empty.
+	Address string
+}
+
+const (
+	eventConnectionComplete byte = 0x03
+
+	cidSignaling uint16 = 0x0001
+	psmRfcomm    uint16 = 0x0003
+
+	signalConnectionRequest     byte = 0x02
+	signalConnectionResponse    byte = 0x03
+	signalDisconnectionRequest  byte = 0x06
+	connectionResultSuccess          = 0x0000
+	connectionResultPending          = 0x0001
+	rfcommUIH                   byte = 0xef
+	rfcommPollFinal             byte = 0x10
+	aclContinuingFragment            = 0x1
+	aclHeaderSize                    = 4
+	l2capHeaderSize                  = 4
+	connectionCompleteEventSize      = 11
+)
+
+type linkKey struct {
+	handle   uint16
+	received bool
+}
+
+type channelKey struct {
+	handle uint16
+	cid    uint16
+}
+
+type signalKey struct {
+	handle     uint16
+	identifier byte
+}
+
+type pendingConnection struct {
+	psm  uint16
+	scid uint16
+}
+
+// extractor walks HCI ACL -> L2CAP -> RFCOMM and turns the payloads of one RFCOMM channel into session entries.
+type extractor struct {
+	options   Options
+	start     time.Time
+	addresses map[uint16]string
+	fragments map[linkKey][]byte
+	pending   map[signalKey]pendingConnection
+	rfcomm    map[channelKey]bool
+	frames    map[linkKey]*protocol.FrameBuffer
+	entries   []protocol.SessionEntry
+}
+
+// ExtractSession reads a btsnoop file and returns the payloads of an RFCOMM channel as a session.
+// Sent packets become TX entries and received packets RX entries, split into frames and described where possible.
+// RFCOMM channels are found by following the L2CAP connections to PSM 3, so the capture must include the connection setup.
+func ExtractSession(r io.Reader, options Options) ([]protocol.SessionEntry, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Channel == 0 {
+		options.Channel = protocol.RfcommChannel
+	}
+	options.Address = strings.ToUpper(options.Address)
+
+	e := &extractor{
+		options:   options,
+		addresses: map[uint16]string{},
+		fragments: map[linkKey][]byte{},
+		pending:   map[signalKey]pendingConnection{},
+		rfcomm:    map[channelKey]bool{},
+		frames:    map[linkKey]*protocol.FrameBuffer{},
+	}
+
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return e.entries, nil
+		}
+		if err != nil {
+			return e.entries, err
+		}
+
+		if e.start.IsZero() {
+			e.start = record.Timestamp
+		}
+		switch record.Type {
+		case PacketEvent:
+			e.handleEvent(record.Data)
+		case PacketACL:
+			e.handleACL(record)
+		}
+	}
+}
+
+// handleEvent remembers the device address of new connections.
+func (e *extractor) handleEvent(data []byte) {
+	if len(data) < 2+connectionCompleteEventSize || data[0] != eventConnectionComplete || data[2] != 0 {
+		return
+	}
+	handle := binary.LittleEndian.Uint16(data[3:]) & 0x0fff
+	e.addresses[handle] = formatAddress(data[5:11])
+}
+
+// formatAddress formats a little endian BD_ADDR as a MAC address.
+func formatAddress(addr []byte) string {
+	parts := make([]string, len(addr))
+	for i, b := range addr {
+		parts[len(addr)-1-i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// handleACL reassembles L2CAP packets from ACL fragments.
+func (e *extractor) handleACL(record Record) {
+	data := record.Data
+	if len(data) < aclHeaderSize {
+		return
+	}
+	handleAndFlags := binary.LittleEndian.Uint16(data)
+	handle := handleAndFlags & 0x0fff
+	boundary := (handleAndFlags >> 12) & 0x3
+	length := int(binary.LittleEndian.Uint16(data[2:]))
+	payload := data[aclHeaderSize:min(aclHeaderSize+length, len(data))]
+
+	key := linkKey{handle: handle, received: record.Received}
+	if boundary == aclContinuingFragment {
+		if _, ok := e.fragments[key]; !ok {
+			// the start of this packet is not in the capture
+			return
+		}
+		e.fragments[key] = append(e.fragments[key], payload...)
+	} else {
+		e.fragments[key] = append([]byte(nil), payload...)
+	}
+
+	packet := e.fragments[key]
+	if len(packet) < l2capHeaderSize {
+		return
+	}
+	size := l2capHeaderSize + int(binary.LittleEndian.Uint16(packet))
+	if len(packet) < size {
+		return
+	}
+	delete(e.fragments, key)
+
+	cid := binary.LittleEndian.Uint16(packet[2:])
+	switch {
+	case cid == cidSignaling:
+		e.handleSignaling(handle, packet[l2capHeaderSize:size])
+	case e.rfcomm[channelKey{handle: handle, cid: cid}]:
+		e.handleRfcomm(record, handle, packet[l2capHeaderSize:size])
+	}
+}
+
+// handleSignaling tracks which L2CAP channels carry RFCOMM.
+func (e *extractor) handleSignaling(handle uint16, data []byte) {
+	for len(data) >= 4 {
+		code, identifier := data[0], data[1]
+		length := int(binary.LittleEndian.Uint16(data[2:]))
+		if len(data) < 4+length {
+			return
+		}
+		command := data[4 : 4+length]
+		data = data[4+length:]
+		key := signalKey{handle: handle, identifier: identifier}
+
+		switch {
+		case code == signalConnectionRequest && len(command) >= 4:
+			e.pending[key] = pendingConnection{
+				psm:  binary.LittleEndian.Uint16(command),
+				scid: binary.LittleEndian.Uint16(command[2:]),
+			}
+		case code == signalConnectionResponse && len(command) >= 6:
+			dcid := binary.LittleEndian.Uint16(command)
+			scid := binary.LittleEndian.Uint16(command[2:])
+			result := binary.LittleEndian.Uint16(command[4:])
+			request, ok := e.pending[key]
+			if !ok || request.scid != scid || result == connectionResultPending {
+				continue
+			}
+			delete(e.pending, key)
+			if result == connectionResultSuccess && request.psm == psmRfcomm {
+				e.rfcomm[channelKey{handle: handle, cid: scid}] = true
+				e.rfcomm[channelKey{handle: handle, cid: dcid}] = true
+			}
+		case code == signalDisconnectionRequest && len(command) >= 4:
+			delete(e.rfcomm, channelKey{handle: handle, cid: binary.LittleEndian.Uint16(command)})
+			delete(e.rfcomm, channelKey{handle: handle, cid: binary.LittleEndian.Uint16(command[2:])})
+		}
+	}
+}
+
+// handleRfcomm keeps the UIH payloads of the selected server channel.
+func (e *extractor) handleRfcomm(record Record, handle uint16, data []byte) {
+	if len(data) < 3 {
+		return
+	}
+	if e.options.Address != "" && e.addresses[handle] != e.options.Address {
+		return
+	}
+
+	dlci := data[0] >> 2
+	control := data[1]
+	if control&^rfcommPollFinal != rfcommUIH || dlci == 0 || dlci>>1 != e.options.Channel {
+		return
+	}
+
+	length, offset := int(data[2]>>1), 3
+	if data[2]&0x01 == 0 {
+		if len(data) < 4 {
+			return
+		}
+		length, offset = length|int(data[3])<<7, 4
+	}
+	if control&rfcommPollFinal != 0 {
+		// with credit based flow control a UIH frame with the P/F bit carries a credit byte
+		offset++
+	}
+	if length == 0 || len(data) < offset+length {
+		return
+	}
+
+	e.handlePayload(record, handle, data[offset:offset+length])
+}
+
+// handlePayload splits a payload into frames, a frame may span several RFCOMM packets.
+func (e *extractor) handlePayload(record Record, handle uint16, payload []byte) {
+	key := linkKey{handle: handle, received: record.Received}
+	buffer, ok := e.frames[key]
+	if !ok {
+		buffer = &protocol.FrameBuffer{}
+		e.frames[key] = buffer
+	}
+
+	direction := protocol.DirectionTX
+	if record.Received {
+		direction = protocol.DirectionRX
+	}
+
+	buffer.Write(payload)
+	for {
+		frame, err := buffer.Next()
+		if errors.Is(err, protocol.ErrIncompleteFrame) {
+			return
+		}
+
+		entry := protocol.SessionEntry{
+			Elapsed:   record.Timestamp.Sub(e.start),
+			Direction: direction,
+		}
+		var garbage *protocol.GarbageError
+		if errors.As(err, &garbage) {
+			entry.Hex = hex.EncodeToString(garbage.Data)
+			entry.Description = "garbage"
+		} else {
+			entry.Hex = frame.String()
+			entry.Description = protocol.Describe(frame)
+		}
+		e.entries = append(e.entries, entry)
+	}
+}
@@ -0,0 +1,85 @@
+//go:build unix
+
+package protocol
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"syscall"
+	"time"
+)
+
+// connectContext connects the socket fd to address and returns it as a non-blocking file.
+// The connection is started non-blocking and waited for by the runtime poller, so it is bounded by ctx
+// like the reads and writes. fd is closed if connecting fails.
+func connectContext(ctx context.Context, fd int, address unix.Sockaddr, name string) (*os.File, error) {
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	err := unix.Connect(fd, address)
+	if err != nil && !errors.Is(err, unix.EINPROGRESS) && !errors.Is(err, unix.EINTR) {
+		unix.Close(fd)
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), name)
+	if err == nil {
+		return file, nil
+	}
+
+	if err := waitConnected(ctx, file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// waitConnected waits until the connection started on file is established or has failed.
+func waitConnected(ctx context.Context, file *os.File) error {
+	raw, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := file.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = file.SetWriteDeadline(time.Now())
+	})
+	defer stop()
+
+	// the socket becomes writable once it is connected, a poll tells a spurious wake up apart
+	// since Bluetooth sockets already have a peer while connecting
+	var connectErr error
+	err = raw.Write(func(fd uintptr) bool {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLOUT}}
+		if _, err := unix.Poll(fds, 0); err != nil {
+			if errors.Is(err, unix.EINTR) {
+				return false
+			}
+			connectErr = err
+			return true
+		}
+		revents := fds[0].Revents
+		if revents&(unix.POLLOUT|unix.POLLERR|unix.POLLHUP) == 0 {
+			return false
+		}
+		value, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ERROR)
+		switch {
+		case err != nil:
+			connectErr = err
+		case value != 0:
+			connectErr = syscall.Errno(value)
+		case revents&unix.POLLOUT == 0:
+			connectErr = unix.ENOTCONN
+		}
+		return true
+	})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	return connectErr
+}
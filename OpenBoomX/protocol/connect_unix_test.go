@@ -0,0 +1,101 @@
+//go:build unix
+
+package protocol
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"testing"
+	"time"
+)
+
+// tcpSocket returns a TCP socket and the address of a listener on the loopback interface.
+func tcpSocket(t *testing.T, listen bool) (int, *unix.SockaddrInet4) {
+	t.Helper()
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback network: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if listen {
+		t.Cleanup(func() { _ = listener.Close() })
+	} else {
+		// nothing listens on the port anymore
+		_ = listener.Close()
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd, &unix.SockaddrInet4{Port: port, Addr: [4]byte{127, 0, 0, 1}}
+}
+
+func TestConnectContext(t *testing.T) {
+	fd, address := tcpSocket(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	file, err := connectContext(ctx, fd, address, "test")
+	if err != nil {
+		t.Fatalf("connectContext() error = %v", err)
+	}
+	defer file.Close()
+	if err := writeContext(ctx, file, []byte("hello")); err != nil {
+		t.Errorf("write after connecting error = %v", err)
+	}
+}
+
+func TestConnectContextRefused(t *testing.T) {
+	fd, address := tcpSocket(t, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := connectContext(ctx, fd, address, "test"); !errors.Is(err, unix.ECONNREFUSED) {
+		t.Errorf("connectContext() error = %v, want ECONNREFUSED", err)
+	}
+}
+
+func TestConnectContextTimeout(t *testing.T) {
+	// a listener that never accepts stops answering once its backlog is full
+	listener, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(listener)
+	if err := unix.Bind(listener, &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Skipf("no loopback network: %v", err)
+	}
+	if err := unix.Listen(listener, 0); err != nil {
+		t.Fatal(err)
+	}
+	bound, err := unix.Getsockname(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 8 {
+		fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		file, err := connectContext(ctx, fd, bound, "test")
+		cancel()
+		if err == nil {
+			defer file.Close()
+			continue
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("connectContext() error = %v, want the context deadline", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("connectContext() returned after %s, the context ended after 200ms", elapsed)
+		}
+		return
+	}
+	t.Skip("the listener's backlog never filled up")
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// deadlineReadWriter is a stream with read and write deadlines, like *os.File and net.Conn.
+type deadlineReadWriter interface {
+	io.Reader
+	io.Writer
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// writeContext writes the message, cancelling ctx interrupts the write by moving the deadline to now.
+func writeContext(ctx context.Context, rw deadlineReadWriter, message []byte) error {
+	deadline, _ := ctx.Deadline()
+	err := rw.SetWriteDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = rw.SetWriteDeadline(time.Now())
+	})
+	defer stop()
+
+	_, err = rw.Write(message)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+// readContext reads once, cancelling ctx interrupts the read by moving the deadline to now.
+func readContext(ctx context.Context, rw deadlineReadWriter, bufferSize int) ([]byte, int, error) {
+	deadline, _ := ctx.Deadline()
+	err := rw.SetReadDeadline(deadline)
+	if err != nil {
+		return nil, 0, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = rw.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, bufferSize)
+	n, err := rw.Read(buf)
+	if err != nil {
+		return nil, n, contextError(ctx, err)
+	}
+	return buf, n, nil
+}
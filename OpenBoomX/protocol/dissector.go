@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"fmt"
+	"obx/protocol/eq"
+	"strings"
+)
+
+// Describe explains a frame in words, e.g. "Oluv EQ mode = studio" for efb046010102fe.
+// Unknown opcodes and unexpected payloads are called out with their raw fields.
+func Describe(frame Frame) string {
+	var description string
+	switch frame.Class {
+	case ClassWrite:
+		description = describeWrite(frame)
+	case ClassRead:
+		description = describeRead(frame)
+	default:
+		description = describeUnknown(frame)
+	}
+
+	// the app sends 00 as the light and EQ checksum, so it is only worth mentioning for the other known frames
+	_, known := opcodeNames[frame.Opcode]
+	if known && !frame.HasValidChecksum() && !frame.Is(ClassWrite, OpLight) && !frame.Is(ClassWrite, OpCustomEQ) {
+		description += fmt.Sprintf(" (invalid checksum %02x, expected %02x)", frame.Checksum, Checksum(frame.Payload))
+	}
+	return description
+}
+
+func describeWrite(frame Frame) string {
+	if _, known := opcodeNames[frame.Opcode]; !known {
+		return describeUnknown(frame)
+	}
+	if frame.Opcode == OpPowerOff && len(frame.Payload) == 1 && frame.Payload[0] == 0x01 {
+		return OpcodeName(frame.Opcode)
+	}
+	if value, ok := describeSetting(frame.Opcode, frame.Payload); ok {
+		return fmt.Sprintf("%s = %s", settingName(frame.Opcode), value)
+	}
+	return describeUnexpected(frame)
+}
+
+func describeRead(frame Frame) string {
+	payload := frame.Payload
+	name := OpcodeName(frame.Opcode)
+
+	if _, known := opcodeNames[frame.Opcode]; !known {
+		return describeUnknown(frame)
+	}
+	if len(payload) == 0 {
+		return name + " request"
+	}
+
+	switch frame.Opcode {
+	case OpBatteryLevel:
+		if len(payload) == 1 {
+			return fmt.Sprintf("battery reply %d%%", payload[0])
+		}
+	case OpFirmwarePackage:
+		return fmt.Sprintf("%s reply %q", name, payload)
+	case OpCustomEQ:
+		if len(payload) == 1+EQBandCount && payload[0] == 0x00 {
+			return name + " reply off"
+		}
+	}
+	if value, ok := describeSetting(frame.Opcode, payload); ok {
+		return fmt.Sprintf("%s reply %s", settingName(frame.Opcode), value)
+	}
+	return describeUnexpected(frame)
+}
+
+func settingName(opcode byte) string {
+	if opcode == OpCustomEQ {
+		return OpcodeName(opcode) + " bands"
+	}
+	return OpcodeName(opcode)
+}
+
+// describeSetting returns the value of a setting payload, which is the same for writes and read replies.
+func describeSetting(opcode byte, payload []byte) (string, bool) {
+	switch opcode {
+	case OpOluvMode:
+		if len(payload) == 1 {
+			return OluvMode(payload[0]).String(), true
+		}
+	case OpCustomEQ:
+		if len(payload) == 1+EQBandCount && payload[0] == 0x01 {
+			bands := make([]string, EQBandCount)
+			for i, band := range payload[1:] {
+				bands[i] = fmt.Sprintf("%+.1f dB", eq.GainOf(band))
+			}
+			return fmt.Sprintf("[%s]", strings.Join(bands, ", ")), true
+		}
+	case OpLight:
+		if len(payload) == 4 {
+			return describeLight(LightMode(payload[0]), payload[1], payload[2], payload[3]), true
+		}
+	case OpShutdownTimeout:
+		if len(payload) == 1 {
+			return ShutdownTimeout(payload[0]).String(), true
+		}
+	case OpVideoMode:
+		if len(payload) == 1 {
+			return VideoMode(payload[0]).String(), true
+		}
+	case OpBeepVolume:
+		if len(payload) == 1 {
+			volume := BeepVolume(payload[0])
+			if beepVolumes.check(volume) == nil {
+				return fmt.Sprintf("%d%%", volume.Percent()), true
+			}
+			return volume.String(), true
+		}
+	}
+	return "", false
+}
+
+func describeLight(mode LightMode, r, g, b byte) string {
+	switch {
+	case mode == LightModeDefault:
+		return "default"
+	case mode == LightModeSolid && r == 0 && g == 0 && b == 0:
+		return "off"
+	case mode == LightModeSolid:
+		return fmt.Sprintf("solid #%02x%02x%02x", r, g, b)
+	case mode == LightModeDancing:
+		return fmt.Sprintf("dancing #%02x%02x%02x", r, g, b)
+	default:
+		return fmt.Sprintf("unknown mode %02x #%02x%02x%02x", mode, r, g, b)
+	}
+}
+
+func describeUnexpected(frame Frame) string {
+	return fmt.Sprintf("%s %s with unexpected payload %x (length %d)",
+		ClassName(frame.Class), OpcodeName(frame.Opcode), frame.Payload, len(frame.Payload))
+}
+
+func describeUnknown(frame Frame) string {
+	return fmt.Sprintf("unknown %s opcode %02x, length %d, payload %x, checksum %02x",
+		ClassName(frame.Class), frame.Opcode, len(frame.Payload), frame.Payload, frame.Checksum)
+}
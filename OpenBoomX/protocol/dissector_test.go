@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"obx/protocol/eq"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	flatOff := append([]byte{0x00}, eq.Flat().Bytes()...)
+	battery := NewFrame(ClassRead, OpBatteryLevel, 95)
+	battery.Checksum++
+
+	tests := []struct {
+		name  string
+		frame Frame
+		want  string
+	}{
+		{"Oluv mode", NewFrame(ClassWrite, OpOluvMode, 0x01), "Oluv EQ mode = studio"},
+		{"custom EQ", NewCustomEQFrame(eq.Curve{2}), "custom EQ bands = [+2.0 dB, +0.0 dB, +0.0 dB, +0.0 dB, +0.0 dB, +0.0 dB, +0.0 dB, +0.0 dB, +0.0 dB, +0.0 dB]"},
+		{"light", NewFrame(ClassWrite, OpLight, 0x02, 0xff, 0xff, 0xff), "light = dancing #ffffff"},
+		{"battery request", NewBatteryLevelRequestFrame(), "battery level request"},
+		{"battery reply", NewFrame(ClassRead, OpBatteryLevel, 95), "battery reply 95%"},
+		{"full battery reply", NewFrame(ClassRead, OpBatteryLevel, 100), "battery reply 100%"},
+		{"battery reply with invalid checksum", battery, "battery reply 95% (invalid checksum 61, expected 60)"},
+		{"custom EQ reply while Oluv's EQ is on", NewFrame(ClassRead, OpCustomEQ, flatOff...), "custom EQ reply off"},
+		{"unknown opcode", NewFrame(ClassWrite, 0x77, 0x02), "unknown write opcode 77, length 1, payload 02, checksum 03"},
+		{"unexpected payload", NewFrame(ClassWrite, OpOluvMode, 0x01, 0x02), "write Oluv EQ mode with unexpected payload 0102 (length 2)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Describe(tt.frame); got != tt.want {
+				t.Errorf("Describe() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
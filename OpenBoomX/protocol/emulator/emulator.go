@@ -0,0 +1,351 @@
+// Package emulator is a software UBoom X that speaks the protocol over an in-memory protocol.RfcommClient.
+package emulator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"obx/protocol"
+	"sync"
+	"time"
+)
+
+var ErrDisconnected = errors.New("emulated speaker disconnected")
+
+const DefaultFirmware = "SP500_20240912_v0.39_ota.bin"
+
+// State is everything the emulated speaker can be set to.
+type State struct {
+	OluvMode        byte
+	CustomEQ        []byte // band values from 0 to 120, nil while an Oluv mode is active
+	LightMode       byte
+	LightColor      [3]byte
+	BeepVolume      byte
+	VideoMode       byte
+	ShutdownTimeout byte
+	Battery         int
+	Firmware        string
+	PoweredOff      bool
+}
+
+// Faults make the emulated speaker misbehave the way a real one sometimes does.
+type Faults struct {
+	ReplyDelay       time.Duration
+	DropReplies      bool
+	MalformedReplies bool
+}
+
+type outgoing struct {
+	data []byte
+	at   time.Time
+}
+
+// Speaker implements protocol.RfcommClient.
+// Frames written with SendMessage are applied to its state, replies are read with ReceiveMessage.
+type Speaker struct {
+	mutex         sync.Mutex
+	state         State
+	faults        Faults
+	input         protocol.FrameBuffer
+	output        chan outgoing
+	next          *outgoing
+	pending       []byte
+	closed        chan struct{}
+	closeOnce     sync.Once
+	batterySince  time.Time
+	drainInterval time.Duration
+	onFrame       func(frame protocol.Frame)
+}
+
+// DefaultState is the state a UBoom X is in after a factory reset, with a 95% battery.
+var DefaultState = State{
+	OluvMode:        0x01,
+	LightMode:       byte(protocol.LightModeDefault),
+	BeepVolume:      0x03,
+	VideoMode:       0x00,
+	ShutdownTimeout: 0x03,
+	Battery:         95,
+	Firmware:        DefaultFirmware,
+}
+
+func New() *Speaker {
+	return NewFromState(DefaultState)
+}
+
+// NewFromState creates a speaker that starts out in the given state.
+func NewFromState(state State) *Speaker {
+	if state.CustomEQ != nil {
+		state.CustomEQ = append([]byte(nil), state.CustomEQ...)
+	}
+	return &Speaker{
+		state:        state,
+		output:       make(chan outgoing, 64),
+		closed:       make(chan struct{}),
+		batterySince: time.Now(),
+	}
+}
+
+// State returns a copy of the current state.
+func (s *Speaker) State() State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.state
+	state.Battery = s.batteryLevel()
+	if s.state.CustomEQ != nil {
+		state.CustomEQ = append([]byte(nil), s.state.CustomEQ...)
+	}
+	return state
+}
+
+func (s *Speaker) SetBattery(level int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state.Battery = level
+	s.batterySince = time.Now()
+}
+
+// SetBatteryDrain makes the battery lose 1% every interval, zero stops draining.
+func (s *Speaker) SetBatteryDrain(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state.Battery = s.batteryLevel()
+	s.batterySince = time.Now()
+	s.drainInterval = interval
+}
+
+func (s *Speaker) SetFirmware(firmware string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state.Firmware = firmware
+}
+
+func (s *Speaker) SetFaults(faults Faults) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = faults
+}
+
+// OnFrame sets a function that is called with every valid frame the speaker receives.
+func (s *Speaker) OnFrame(onFrame func(frame protocol.Frame)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onFrame = onFrame
+}
+
+// Disconnect drops the connection, like the speaker going out of range.
+func (s *Speaker) Disconnect() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// Push sends a frame the client didn't ask for.
+func (s *Speaker) Push(frame protocol.Frame) error {
+	data, err := frame.Encode()
+	if err != nil {
+		return err
+	}
+	s.send(data, 0)
+	return nil
+}
+
+// batteryLevel must be called with the mutex held.
+func (s *Speaker) batteryLevel() int {
+	if s.drainInterval <= 0 {
+		return s.state.Battery
+	}
+	drained := int(time.Since(s.batterySince) / s.drainInterval)
+	return max(s.state.Battery-drained, 0)
+}
+
+func (s *Speaker) send(data []byte, delay time.Duration) {
+	select {
+	case s.output <- outgoing{data: data, at: time.Now().Add(delay)}:
+	default:
+		log.Printf("Emulator output is full, dropping %x", data)
+	}
+}
+
+func (s *Speaker) SendMessage(ctx context.Context, message []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-s.closed:
+		return ErrDisconnected
+	default:
+	}
+
+	s.mutex.Lock()
+	s.input.Write(message)
+	var frames []protocol.Frame
+	for {
+		frame, err := s.input.Next()
+		if errors.Is(err, protocol.ErrIncompleteFrame) {
+			break
+		}
+		if err != nil {
+			log.Printf("Emulator ignoring input: %v", err)
+			continue
+		}
+		frames = append(frames, frame)
+	}
+	onFrame := s.onFrame
+	s.mutex.Unlock()
+
+	for _, frame := range frames {
+		if onFrame != nil {
+			onFrame(frame)
+		}
+		s.handle(frame)
+	}
+	return nil
+}
+
+func (s *Speaker) handle(frame protocol.Frame) {
+	s.mutex.Lock()
+	reply, ok := s.apply(frame)
+	faults := s.faults
+	poweredOff := s.state.PoweredOff
+	s.mutex.Unlock()
+
+	if poweredOff {
+		s.Disconnect()
+		return
+	}
+	if !ok || faults.DropReplies {
+		return
+	}
+
+	data, err := reply.Encode()
+	if err != nil {
+		log.Printf("Emulator failed encoding reply: %v", err)
+		return
+	}
+	if faults.MalformedReplies {
+		// a wrong end byte and a missing checksum
+		data = append(data[:len(data)-2], 0x00)
+	}
+	s.send(data, faults.ReplyDelay)
+}
+
+// apply updates the state from a frame and returns the reply, if the frame has one.
+// It must be called with the mutex held. Invalid values are ignored, like the speaker does.
+func (s *Speaker) apply(frame protocol.Frame) (protocol.Frame, bool) {
+	if frame.Class == protocol.ClassRead {
+		switch frame.Opcode {
+		case protocol.OpBatteryLevel:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpBatteryLevel, byte(s.batteryLevel())), true
+		case protocol.OpFirmwarePackage:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpFirmwarePackage, []byte(s.state.Firmware)...), true
+		case protocol.OpOluvMode:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpOluvMode, s.state.OluvMode), true
+		case protocol.OpCustomEQ:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpCustomEQ, s.customEQPayload()...), true
+		case protocol.OpLight:
+			color := s.state.LightColor
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpLight, s.state.LightMode, color[0], color[1], color[2]), true
+		case protocol.OpBeepVolume:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpBeepVolume, s.state.BeepVolume), true
+		case protocol.OpVideoMode:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpVideoMode, s.state.VideoMode), true
+		case protocol.OpShutdownTimeout:
+			return protocol.NewFrame(protocol.ClassRead, protocol.OpShutdownTimeout, s.state.ShutdownTimeout), true
+		}
+		return protocol.Frame{}, false
+	}
+	if frame.Class != protocol.ClassWrite {
+		return protocol.Frame{}, false
+	}
+
+	// a write carries the payload of its read reply, so it is checked by the reply parsers of the client
+	reply := frame
+	reply.Class = protocol.ClassRead
+	switch frame.Opcode {
+	case protocol.OpOluvMode:
+		if mode, err := protocol.ParseOluvModeReply(reply); err == nil {
+			s.state.OluvMode = byte(mode)
+			s.state.CustomEQ = nil
+		}
+	case protocol.OpCustomEQ:
+		// bands above the maximum are clamped, like the speaker does
+		if curve, active, err := protocol.ParseCustomEQReply(reply); err == nil && active {
+			s.state.CustomEQ = curve.Bytes()
+		}
+	case protocol.OpLight:
+		if light, err := protocol.ParseLightReply(reply); err == nil {
+			s.state.LightMode = byte(light.Mode)
+			s.state.LightColor = light.Color
+		}
+	case protocol.OpBeepVolume:
+		if volume, err := protocol.ParseBeepVolumeReply(reply); err == nil {
+			s.state.BeepVolume = byte(volume)
+		}
+	case protocol.OpVideoMode:
+		if mode, err := protocol.ParseVideoModeReply(reply); err == nil {
+			s.state.VideoMode = byte(mode)
+		}
+	case protocol.OpShutdownTimeout:
+		if timeout, err := protocol.ParseShutdownTimeoutReply(reply); err == nil {
+			s.state.ShutdownTimeout = byte(timeout)
+		}
+	case protocol.OpPowerOff:
+		s.state.PoweredOff = true
+	}
+	return protocol.Frame{}, false
+}
+
+// customEQPayload is 01 and the bands while the custom EQ is active, 00 and flat bands otherwise.
+// It must be called with the mutex held.
+func (s *Speaker) customEQPayload() []byte {
+	if s.state.CustomEQ == nil {
+		payload := make([]byte, 1+protocol.EQBandCount)
+		for i := range protocol.EQBandCount {
+			payload[1+i] = protocol.MaxBandValue / 2
+		}
+		return payload
+	}
+	return append([]byte{0x01}, s.state.CustomEQ...)
+}
+
+// ReceiveMessage blocks until the speaker has something to say.
+// Replies longer than bufferSize are returned over several reads. It must not be called concurrently.
+func (s *Speaker) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	if len(s.pending) == 0 {
+		if s.next == nil {
+			select {
+			case next := <-s.output:
+				s.next = &next
+			case <-s.closed:
+				return nil, 0, ErrDisconnected
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
+		}
+
+		if delay := time.Until(s.next.at); delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-s.closed:
+				return nil, 0, ErrDisconnected
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
+		}
+		s.pending = s.next.data
+		s.next = nil
+	}
+
+	buf := make([]byte, bufferSize)
+	n := copy(buf, s.pending)
+	s.pending = s.pending[n:]
+	return buf, n, nil
+}
+
+func (s *Speaker) CloseSocket() error {
+	s.Disconnect()
+	return nil
+}
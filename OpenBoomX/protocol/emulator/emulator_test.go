@@ -0,0 +1,56 @@
+package emulator
+
+import (
+	"context"
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+func TestSpeakerIgnoresInvalidWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		hex   string
+		check func(state State) bool
+	}{
+		{"unknown Oluv mode", "efb046010809fe", func(s State) bool { return s.OluvMode == DefaultState.OluvMode }},
+		{"Oluv mode without payload", "efb0460000fe", func(s State) bool { return s.OluvMode == DefaultState.OluvMode }},
+		{"unknown light mode", "efb0950403ffffff00fe", func(s State) bool { return s.LightMode == DefaultState.LightMode }},
+		{"short light", "efb09502010000fe", func(s State) bool { return s.LightMode == DefaultState.LightMode }},
+		{"beep volume 0", "efb065010001fe", func(s State) bool { return s.BeepVolume == DefaultState.BeepVolume }},
+		{"beep volume 6", "efb065010607fe", func(s State) bool { return s.BeepVolume == DefaultState.BeepVolume }},
+		{"video mode 2", "efb035010203fe", func(s State) bool { return s.VideoMode == DefaultState.VideoMode }},
+		{"shutdown timeout 7", "efb075010708fe", func(s State) bool { return s.ShutdownTimeout == DefaultState.ShutdownTimeout }},
+		{"custom EQ with 9 bands", "efb0450a013c3c3c3c3c3c3c3c3c00fe", func(s State) bool { return s.CustomEQ == nil }},
+		{"inactive custom EQ", "efb0450b003c3c3c3c3c3c3c3c3c3c00fe", func(s State) bool { return s.CustomEQ == nil }},
+		{"read class write", "efa046010405fe", func(s State) bool { return s.OluvMode == DefaultState.OluvMode }},
+		{"unknown class", "efc046010405fe", func(s State) bool { return s.OluvMode == DefaultState.OluvMode }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			speaker := New()
+			data, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := speaker.SendMessage(context.Background(), data); err != nil {
+				t.Fatal(err)
+			}
+			if state := speaker.State(); !tt.check(state) {
+				t.Errorf("state = %+v, want %s ignored", state, tt.hex)
+			}
+		})
+	}
+}
+
+func TestSpeakerClampsCustomEQ(t *testing.T) {
+	speaker := New()
+	data, _ := hex.DecodeString("efb0450b01ff783c0000000000000000fe")
+	if err := speaker.SendMessage(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x78, 0x78, 0x3c, 0, 0, 0, 0, 0, 0, 0}
+	if state := speaker.State(); !slices.Equal(state.CustomEQ, want) {
+		t.Errorf("custom EQ = %x, want %x", state.CustomEQ, want)
+	}
+}
@@ -0,0 +1,65 @@
+package emulator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"obx/protocol"
+)
+
+// Serve speaks the protocol over conn until either side disconnects or ctx is done.
+// The connection is closed when Serve returns.
+func (s *Speaker) Serve(ctx context.Context, conn io.ReadWriteCloser) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// unblocks the read below when the speaker disconnects or ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+	defer conn.Close()
+	defer s.Disconnect()
+
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- s.writeLoop(ctx, conn)
+		cancel()
+	}()
+
+	buf := make([]byte, protocol.MaxFrameSize)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if sendErr := s.SendMessage(ctx, buf[:n]); sendErr != nil {
+				return nonFatal(sendErr)
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nonFatal(<-writeErr)
+			}
+			return nonFatal(err)
+		}
+	}
+}
+
+func (s *Speaker) writeLoop(ctx context.Context, conn io.Writer) error {
+	for {
+		buf, n, err := s.ReceiveMessage(ctx, protocol.MaxFrameSize)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// nonFatal hides the errors that just mean one of the sides hung up.
+func nonFatal(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, ErrDisconnected) || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,254 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+)
+
+// enum names the payload values of a setting, in the order they are shown to users.
+type enum[T ~byte] struct {
+	setting string
+	values  []T
+	names   []string
+}
+
+func (e enum[T]) name(value T) (string, bool) {
+	if i := slices.Index(e.values, value); i >= 0 {
+		return e.names[i], true
+	}
+	return "", false
+}
+
+func (e enum[T]) string(value T) string {
+	if name, ok := e.name(value); ok {
+		return name
+	}
+	return fmt.Sprintf("unknown value %02x", byte(value))
+}
+
+func (e enum[T]) parse(name string) (T, error) {
+	if i := slices.Index(e.names, name); i >= 0 {
+		return e.values[i], nil
+	}
+	return 0, fmt.Errorf("invalid %s: %s", e.setting, name)
+}
+
+// check returns an error for values that aren't valid for the setting.
+func (e enum[T]) check(value T) error {
+	if _, ok := e.name(value); !ok {
+		return fmt.Errorf("invalid %s: %02x", e.setting, byte(value))
+	}
+	return nil
+}
+
+func (e enum[T]) marshal(value T) ([]byte, error) {
+	if err := e.check(value); err != nil {
+		return nil, err
+	}
+	name, _ := e.name(value)
+	return []byte(name), nil
+}
+
+// OluvMode is one of Oluv's EQ modes.
+type OluvMode byte
+
+const (
+	OluvStudio      OluvMode = 0x01
+	OluvIndoor      OluvMode = 0x02
+	OluvIndoorPlus  OluvMode = 0x03
+	OluvOutdoor     OluvMode = 0x04
+	OluvOutdoorPlus OluvMode = 0x05
+	OluvBoom        OluvMode = 0x06
+	OluvGround      OluvMode = 0x07
+)
+
+var oluvModes = enum[OluvMode]{
+	setting: "Oluv's EQ mode",
+	values:  []OluvMode{OluvStudio, OluvIndoor, OluvIndoorPlus, OluvOutdoor, OluvOutdoorPlus, OluvBoom, OluvGround},
+	names:   []string{"studio", "indoor", "indoor+", "outdoor", "outdoor+", "boom", "ground"},
+}
+
+// AllOluvModes returns the Oluv's EQ modes in the order of the app.
+func AllOluvModes() []OluvMode {
+	return slices.Clone(oluvModes.values)
+}
+
+// ParseOluvMode parses a mode name like "studio".
+func ParseOluvMode(name string) (OluvMode, error) {
+	return oluvModes.parse(name)
+}
+
+func (mode OluvMode) String() string {
+	return oluvModes.string(mode)
+}
+
+func (mode OluvMode) MarshalText() ([]byte, error) {
+	return oluvModes.marshal(mode)
+}
+
+func (mode *OluvMode) UnmarshalText(text []byte) (err error) {
+	*mode, err = ParseOluvMode(string(text))
+	return err
+}
+
+// ShutdownTimeout is the idle time after which the speaker turns itself off.
+type ShutdownTimeout byte
+
+const (
+	Shutdown5m    ShutdownTimeout = 0x01
+	Shutdown10m   ShutdownTimeout = 0x02
+	Shutdown30m   ShutdownTimeout = 0x03
+	Shutdown60m   ShutdownTimeout = 0x04
+	Shutdown90m   ShutdownTimeout = 0x05
+	Shutdown120m  ShutdownTimeout = 0x06
+	ShutdownNever ShutdownTimeout = 0xff
+)
+
+var shutdownTimeouts = enum[ShutdownTimeout]{
+	setting: "shutdown timeout",
+	values:  []ShutdownTimeout{Shutdown5m, Shutdown10m, Shutdown30m, Shutdown60m, Shutdown90m, Shutdown120m, ShutdownNever},
+	names:   []string{"5m", "10m", "30m", "60m", "90m", "120m", "no"},
+}
+
+// AllShutdownTimeouts returns the shutdown timeouts from the shortest to never.
+func AllShutdownTimeouts() []ShutdownTimeout {
+	return slices.Clone(shutdownTimeouts.values)
+}
+
+// ParseShutdownTimeout parses a timeout like "30m", or "no" to never shut down.
+func ParseShutdownTimeout(name string) (ShutdownTimeout, error) {
+	return shutdownTimeouts.parse(name)
+}
+
+func (timeout ShutdownTimeout) String() string {
+	return shutdownTimeouts.string(timeout)
+}
+
+func (timeout ShutdownTimeout) MarshalText() ([]byte, error) {
+	return shutdownTimeouts.marshal(timeout)
+}
+
+func (timeout *ShutdownTimeout) UnmarshalText(text []byte) (err error) {
+	*timeout, err = ParseShutdownTimeout(string(text))
+	return err
+}
+
+// BeepVolume is the volume of the speaker's beeps, in steps of 25%.
+type BeepVolume byte
+
+const (
+	BeepVolume0   BeepVolume = 0x01
+	BeepVolume25  BeepVolume = 0x02
+	BeepVolume50  BeepVolume = 0x03
+	BeepVolume75  BeepVolume = 0x04
+	BeepVolume100 BeepVolume = 0x05
+)
+
+var beepVolumes = enum[BeepVolume]{
+	setting: "beep volume",
+	values:  []BeepVolume{BeepVolume0, BeepVolume25, BeepVolume50, BeepVolume75, BeepVolume100},
+	names:   []string{"0", "25", "50", "75", "100"},
+}
+
+// AllBeepVolumes returns the beep volumes from silent to loudest.
+func AllBeepVolumes() []BeepVolume {
+	return slices.Clone(beepVolumes.values)
+}
+
+// ParseBeepVolume parses a volume in percent like "50".
+func ParseBeepVolume(name string) (BeepVolume, error) {
+	return beepVolumes.parse(name)
+}
+
+// Percent returns the volume from 0 to 100.
+func (volume BeepVolume) Percent() int {
+	return 25 * (int(volume) - int(BeepVolume0))
+}
+
+func (volume BeepVolume) String() string {
+	return beepVolumes.string(volume)
+}
+
+func (volume BeepVolume) MarshalText() ([]byte, error) {
+	return beepVolumes.marshal(volume)
+}
+
+func (volume *BeepVolume) UnmarshalText(text []byte) (err error) {
+	*volume, err = ParseBeepVolume(string(text))
+	return err
+}
+
+// VideoMode lowers the audio latency for watching videos.
+type VideoMode byte
+
+const (
+	VideoModeOff VideoMode = 0x00
+	VideoModeOn  VideoMode = 0x01
+)
+
+var videoModes = enum[VideoMode]{
+	setting: "video mode",
+	values:  []VideoMode{VideoModeOff, VideoModeOn},
+	names:   []string{"off", "on"},
+}
+
+// AllVideoModes returns off and on.
+func AllVideoModes() []VideoMode {
+	return slices.Clone(videoModes.values)
+}
+
+// ParseVideoMode parses "on" or "off".
+func ParseVideoMode(name string) (VideoMode, error) {
+	return videoModes.parse(name)
+}
+
+func (mode VideoMode) String() string {
+	return videoModes.string(mode)
+}
+
+func (mode VideoMode) MarshalText() ([]byte, error) {
+	return videoModes.marshal(mode)
+}
+
+func (mode *VideoMode) UnmarshalText(text []byte) (err error) {
+	*mode, err = ParseVideoMode(string(text))
+	return err
+}
+
+// LightMode is the first byte of the light payload.
+type LightMode byte
+
+const (
+	LightModeDefault LightMode = 0x00
+	LightModeSolid   LightMode = 0x01
+	LightModeDancing LightMode = 0x02
+)
+
+var lightModes = enum[LightMode]{
+	setting: "light mode",
+	values:  []LightMode{LightModeDefault, LightModeSolid, LightModeDancing},
+	names:   []string{"default", "solid", "dancing"},
+}
+
+// AllLightModes returns the default, solid and dancing light modes.
+func AllLightModes() []LightMode {
+	return slices.Clone(lightModes.values)
+}
+
+// ParseLightMode parses "default", "solid" or "dancing".
+func ParseLightMode(name string) (LightMode, error) {
+	return lightModes.parse(name)
+}
+
+func (mode LightMode) String() string {
+	return lightModes.string(mode)
+}
+
+func (mode LightMode) MarshalText() ([]byte, error) {
+	return lightModes.marshal(mode)
+}
+
+func (mode *LightMode) UnmarshalText(text []byte) (err error) {
+	*mode, err = ParseLightMode(string(text))
+	return err
+}
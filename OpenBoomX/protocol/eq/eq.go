@@ -0,0 +1,194 @@
+// Package eq describes the custom equalizer of the speaker in dB.
+// The speaker sets each band in 1/6 dB steps, sent as a byte from 0 (-10 dB) to 120 (+10 dB).
+package eq
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	BandCount = 10
+	// MinGain and MaxGain are the limits of a band in dB
+	MinGain = -10.0
+	MaxGain = 10.0
+	// StepsPerDB is the resolution of a band, each step is 1/6 dB
+	StepsPerDB = 6
+	// MaxValue is the byte sent for MaxGain, 0 is sent for MinGain
+	MaxValue byte = 120
+)
+
+// Frequencies are the centre frequencies of the bands in Hz.
+// They are the usual octave bands of a 10 band equalizer, the speaker doesn't report them, so they are approximate
+// and shown as such, see FormatBandFrequency.
+var Frequencies = [BandCount]float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// Band is a single band of a curve.
+type Band struct {
+	Frequency float64
+	Gain      float64
+}
+
+// String returns the band like "~1 kHz +1.5 dB".
+func (band Band) String() string {
+	return fmt.Sprintf("%s %+.1f dB", FormatBandFrequency(band.Frequency), band.Gain)
+}
+
+// Curve is the gain of every band in dB, from the lowest frequency to the highest.
+type Curve [BandCount]float64
+
+// Flat returns a curve with all bands at 0 dB.
+func Flat() Curve {
+	return Curve{}
+}
+
+// NewCurve returns the curve of BandCount gains in dB, quantized to the speaker's steps.
+func NewCurve(gains ...float64) (Curve, error) {
+	var curve Curve
+	if len(gains) != BandCount {
+		return curve, fmt.Errorf("invalid number of EQ bands, must be exactly %d bands", BandCount)
+	}
+	for i, gain := range gains {
+		if err := checkGain(gain); err != nil {
+			return curve, err
+		}
+		curve[i] = gain
+	}
+	return curve.Quantize(), nil
+}
+
+// FromBytes returns the curve of the band bytes the speaker uses, values above MaxValue are clamped like the speaker does.
+func FromBytes(values []byte) (Curve, error) {
+	var curve Curve
+	if len(values) != BandCount {
+		return curve, fmt.Errorf("invalid number of EQ bands, must be exactly %d bands", BandCount)
+	}
+	for i, value := range values {
+		curve[i] = GainOf(min(value, MaxValue))
+	}
+	return curve, nil
+}
+
+// Parse parses BandCount comma separated gains in dB, e.g. "-2,0,1.5,0,0,0,0,0,0,3".
+func Parse(text string) (Curve, error) {
+	fields := strings.Split(text, ",")
+	gains := make([]float64, len(fields))
+	for i, field := range fields {
+		gain, err := ParseGain(field)
+		if err != nil {
+			return Curve{}, err
+		}
+		gains[i] = gain
+	}
+	return NewCurve(gains...)
+}
+
+// ParseGain parses a single gain in dB, it isn't checked against the limits.
+func ParseGain(text string) (float64, error) {
+	gain, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "dB")), 64)
+	if err != nil || math.IsNaN(gain) || math.IsInf(gain, 0) {
+		return 0, fmt.Errorf("invalid EQ band gain: %s", text)
+	}
+	return gain, nil
+}
+
+func checkGain(gain float64) error {
+	if math.IsNaN(gain) || gain < MinGain || gain > MaxGain {
+		return fmt.Errorf("EQ band gain must be between %.0f dB and %+.0f dB: %g", MinGain, MaxGain, gain)
+	}
+	return nil
+}
+
+// Clamp limits a gain to MinGain and MaxGain.
+func Clamp(gain float64) float64 {
+	return min(max(gain, MinGain), MaxGain)
+}
+
+// Quantize rounds a gain to the closest step the speaker can set, within the limits.
+func Quantize(gain float64) float64 {
+	return math.Round(Clamp(gain)*StepsPerDB) / StepsPerDB
+}
+
+// GainOf returns the gain in dB of a band byte.
+func GainOf(value byte) float64 {
+	return float64(int(value)-int(MaxValue)/2) / StepsPerDB
+}
+
+// ValueOf returns the band byte of a gain, quantized and clamped.
+func ValueOf(gain float64) byte {
+	return byte(math.Round(Clamp(gain)*StepsPerDB) + float64(MaxValue/2))
+}
+
+// FormatGain formats a gain like the GUI shows it, e.g. "-1.5".
+func FormatGain(gain float64) string {
+	return strconv.FormatFloat(gain, 'f', 1, 64)
+}
+
+// FormatFrequency formats a frequency like "62 Hz" or "16 kHz".
+func FormatFrequency(frequency float64) string {
+	if frequency >= 1000 {
+		return strconv.FormatFloat(frequency/1000, 'f', -1, 64) + " kHz"
+	}
+	return strconv.FormatFloat(frequency, 'f', -1, 64) + " Hz"
+}
+
+// FormatBandFrequency formats the approximate centre frequency of a band like "~1 kHz", see Frequencies.
+func FormatBandFrequency(frequency float64) string {
+	return "~" + FormatFrequency(frequency)
+}
+
+// Position returns where a gain is on a scale from 0 at MinGain to 1 at MaxGain.
+func Position(gain float64) float64 {
+	return (Clamp(gain) - MinGain) / (MaxGain - MinGain)
+}
+
+// GainAt returns the gain at a position from 0 at MinGain to 1 at MaxGain.
+func GainAt(position float64) float64 {
+	return Clamp(MinGain + position*(MaxGain-MinGain))
+}
+
+// Quantize returns the curve rounded to the steps the speaker can set.
+func (curve Curve) Quantize() Curve {
+	for i, gain := range curve {
+		curve[i] = Quantize(gain)
+	}
+	return curve
+}
+
+// Bytes returns the band bytes the speaker uses.
+func (curve Curve) Bytes() []byte {
+	values := make([]byte, BandCount)
+	for i, gain := range curve {
+		values[i] = ValueOf(gain)
+	}
+	return values
+}
+
+// Bands returns every band with its centre frequency.
+func (curve Curve) Bands() []Band {
+	bands := make([]Band, BandCount)
+	for i, gain := range curve {
+		bands[i] = Band{Frequency: Frequencies[i], Gain: gain}
+	}
+	return bands
+}
+
+// String returns the comma separated gains in dB, which Parse reads back.
+func (curve Curve) String() string {
+	gains := make([]string, BandCount)
+	for i, gain := range curve {
+		gains[i] = FormatGain(gain)
+	}
+	return strings.Join(gains, ",")
+}
+
+func (curve Curve) MarshalText() ([]byte, error) {
+	return []byte(curve.String()), nil
+}
+
+func (curve *Curve) UnmarshalText(text []byte) (err error) {
+	*curve, err = Parse(string(text))
+	return err
+}
@@ -0,0 +1,154 @@
+package eq
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewCurve(t *testing.T) {
+	tests := []struct {
+		name    string
+		gains   []float64
+		want    Curve
+		wantErr bool
+	}{
+		{name: "flat", gains: []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, want: Flat()},
+		{name: "limits", gains: []float64{MinGain, MaxGain, 0, 0, 0, 0, 0, 0, 0, 0}, want: Curve{MinGain, MaxGain}},
+		{name: "quantized to 1/6 dB", gains: []float64{0.1, -0.1, 0.05, 1.24, 0, 0, 0, 0, 0, 0}, want: Curve{1.0 / 6, -1.0 / 6, 0, 7.0 / 6}},
+		{name: "too few bands", gains: []float64{0, 0, 0}, wantErr: true},
+		{name: "too many bands", gains: make([]float64, BandCount+1), wantErr: true},
+		{name: "above the limit", gains: []float64{10.1, 0, 0, 0, 0, 0, 0, 0, 0, 0}, wantErr: true},
+		{name: "below the limit", gains: []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, -10.1}, wantErr: true},
+		{name: "NaN", gains: []float64{math.NaN(), 0, 0, 0, 0, 0, 0, 0, 0, 0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCurve(tt.gains...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCurve(%v) error = %v, wantErr %v", tt.gains, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("NewCurve(%v) = %v, want %v", tt.gains, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Curve
+		wantErr bool
+	}{
+		{text: "0,0,0,0,0,0,0,0,0,0", want: Flat()},
+		{text: "-2, 0, 1.5dB, 0, 0, 0, 0, 0, 0, 3 dB", want: Curve{-2, 0, 1.5, 0, 0, 0, 0, 0, 0, 3}},
+		{text: "-10,10,0,0,0,0,0,0,0,0", want: Curve{MinGain, MaxGain}},
+		{text: "0,0,0,0,0,0,0,0,0", wantErr: true},
+		{text: "0,0,0,0,0,0,0,0,0,0,0", wantErr: true},
+		{text: "", wantErr: true},
+		{text: "11,0,0,0,0,0,0,0,0,0", wantErr: true},
+		{text: "0,0,0,0,0,0,0,0,0,-10.5", wantErr: true},
+		{text: "NaN,0,0,0,0,0,0,0,0,0", wantErr: true},
+		{text: "Inf,0,0,0,0,0,0,0,0,0", wantErr: true},
+		{text: "loud,0,0,0,0,0,0,0,0,0", wantErr: true},
+		// the old form of bytes from 0 to 120
+		{text: "60,60,60,60,60,60,60,60,60,60", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueOf(t *testing.T) {
+	tests := []struct {
+		gain float64
+		want byte
+	}{
+		{gain: MinGain, want: 0},
+		{gain: 0, want: 60},
+		{gain: MaxGain, want: MaxValue},
+		{gain: 1.0 / 6, want: 61},
+		{gain: -1.0 / 6, want: 59},
+		{gain: 0.08, want: 60},
+		{gain: 0.09, want: 61},
+		{gain: 1.5, want: 69},
+		{gain: -15, want: 0},
+		{gain: 15, want: MaxValue},
+	}
+	for _, tt := range tests {
+		if got := ValueOf(tt.gain); got != tt.want {
+			t.Errorf("ValueOf(%g) = %d, want %d", tt.gain, got, tt.want)
+		}
+	}
+}
+
+func TestGainOfValueOf(t *testing.T) {
+	for value := range int(MaxValue) + 1 {
+		if got := ValueOf(GainOf(byte(value))); got != byte(value) {
+			t.Errorf("ValueOf(GainOf(%d)) = %d", value, got)
+		}
+	}
+}
+
+func TestGainAt(t *testing.T) {
+	tests := []struct {
+		position float64
+		want     float64
+	}{
+		{position: 0, want: MinGain},
+		{position: 0.5, want: 0},
+		{position: 1, want: MaxGain},
+		{position: -0.5, want: MinGain},
+		{position: 1.5, want: MaxGain},
+		// a slider position between two steps sends the closest step
+		{position: 0.505, want: 1.0 / 6},
+		{position: 0.503, want: 0},
+	}
+	for _, tt := range tests {
+		if got := Quantize(GainAt(tt.position)); got != tt.want {
+			t.Errorf("Quantize(GainAt(%g)) = %g, want %g", tt.position, got, tt.want)
+		}
+		if position := Position(GainAt(tt.position)); position < 0 || position > 1 {
+			t.Errorf("Position(GainAt(%g)) = %g, want within 0 and 1", tt.position, position)
+		}
+	}
+}
+
+func TestCurveStringRoundTrip(t *testing.T) {
+	// every step of the speaker in every band, String only keeps one decimal
+	for value := range int(MaxValue) + 1 {
+		var curve Curve
+		for i := range curve {
+			curve[i] = GainOf(byte((value + i*13) % (int(MaxValue) + 1)))
+		}
+		got, err := Parse(curve.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", curve.String(), err)
+		}
+		if got != curve {
+			t.Fatalf("Parse(%q) = %v, want %v", curve.String(), got, curve)
+		}
+	}
+}
+
+func TestFromBytes(t *testing.T) {
+	curve, err := FromBytes([]byte{0, 60, 120, 121, 255, 61, 59, 69, 60, 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Curve{MinGain, 0, MaxGain, MaxGain, MaxGain, 1.0 / 6, -1.0 / 6, 1.5}
+	if curve != want {
+		t.Errorf("FromBytes() = %v, want %v", curve, want)
+	}
+	if _, err := FromBytes([]byte{60, 60}); err == nil {
+		t.Error("FromBytes() of 2 bands succeeded")
+	}
+}
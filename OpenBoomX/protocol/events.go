@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"log"
+	"obx/protocol/eq"
+)
+
+// Event is a frame the speaker sent without being asked, for example after a button press on the speaker.
+type Event struct {
+	Frame Frame
+	// Raw is true for frames that aren't a known setting, only Frame and Description are set then
+	Raw   bool
+	Field StateField
+	// Value is the decoded setting: an OluvMode, VideoMode, ShutdownTimeout, BeepVolume or LightState,
+	// an int for the battery, a string for the firmware and an eq.Curve for the custom EQ, which is nil
+	// while the custom EQ is off
+	Value       any
+	Description string
+}
+
+// EventFilter selects the events a subscriber receives, a nil filter receives all of them.
+type EventFilter func(event Event) bool
+
+// FieldEvents selects the events of the given fields.
+func FieldEvents(fields ...StateField) EventFilter {
+	return func(event Event) bool {
+		if event.Raw {
+			return false
+		}
+		for _, field := range fields {
+			if event.Field == field {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RawEvents selects the frames that couldn't be decoded.
+func RawEvents(event Event) bool {
+	return event.Raw
+}
+
+// DecodeEvent decodes an unsolicited frame, frames that aren't a known setting become raw events,
+// like frames of unknown classes.
+func DecodeEvent(frame Frame) Event {
+	event := Event{Frame: frame, Description: Describe(frame)}
+	if frame.Class != ClassWrite && frame.Class != ClassRead {
+		event.Raw = true
+		return event
+	}
+	field, value, ok := decodeSetting(frame)
+	if !ok {
+		event.Raw = true
+		return event
+	}
+	event.Field = field
+	event.Value = value
+	return event
+}
+
+// decodeSetting decodes a write or a read reply, both carry the same payload.
+// Frames that don't hold a valid value, like read requests, aren't decoded.
+func decodeSetting(frame Frame) (StateField, any, bool) {
+	// the parsers expect read replies
+	reply := frame
+	reply.Class = ClassRead
+
+	var field StateField
+	var value any
+	var err error
+	switch frame.Opcode {
+	case OpOluvMode:
+		field = FieldOluvMode
+		value, err = ParseOluvModeReply(reply)
+	case OpCustomEQ:
+		field = FieldCustomEQ
+		var curve eq.Curve
+		var active bool
+		curve, active, err = ParseCustomEQReply(reply)
+		if active {
+			value = curve
+		}
+	case OpLight:
+		field = FieldLight
+		value, err = ParseLightReply(reply)
+	case OpBeepVolume:
+		field = FieldBeepVolume
+		value, err = ParseBeepVolumeReply(reply)
+	case OpVideoMode:
+		field = FieldVideoMode
+		value, err = ParseVideoModeReply(reply)
+	case OpShutdownTimeout:
+		field = FieldShutdownTimeout
+		value, err = ParseShutdownTimeoutReply(reply)
+	case OpBatteryLevel:
+		field = FieldBattery
+		value, err = ParseBatteryLevelReply(reply)
+	case OpFirmwarePackage:
+		field = FieldFirmware
+		value, err = ParseFirmwarePackageReply(reply)
+	default:
+		return 0, nil, false
+	}
+	return field, value, err == nil
+}
+
+// Subscribe returns a channel of the unsolicited frames that pass filter, decoded into events.
+// Replies to requests of this client are not events. The channel is closed when the connection ends
+// or the returned function is called.
+func (client *SpeakerClient) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	frames, unsubscribe := client.mux.subscribe()
+	events := make(chan Event, subscriberBufferSize)
+
+	go func() {
+		defer close(events)
+		for frame := range frames {
+			event := DecodeEvent(frame)
+			if filter != nil && !filter(event) {
+				continue
+			}
+			select {
+			case events <- event:
+			default:
+				log.Printf("Event subscriber is not keeping up, dropping %s", event.Description)
+			}
+		}
+	}()
+	return events, unsubscribe
+}
@@ -0,0 +1,183 @@
+// Package explorer sweeps read requests over opcodes and payloads to find commands that aren't documented yet.
+package explorer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"obx/protocol"
+	"time"
+)
+
+// Denied opcodes are never sent, whatever the class or payload, because they are known to be destructive.
+var Denied = map[byte]string{
+	protocol.OpPowerOff: "powers the speaker off",
+}
+
+// MinInterval is the shortest time allowed between two probes, so a sweep can't flood the speaker.
+const MinInterval = 100 * time.Millisecond
+
+var ErrDenied = errors.New("opcode is denied")
+
+// Probe is a single request sent during a sweep.
+type Probe struct {
+	Opcode  byte
+	Payload []byte
+}
+
+// Frame returns the read request of the probe, with a valid checksum.
+func (p Probe) Frame() protocol.Frame {
+	return protocol.NewFrame(protocol.ClassRead, p.Opcode, p.Payload...)
+}
+
+// Probes returns a probe for every opcode and payload combination, sorted by opcode.
+func Probes(opcodes []byte, payloads [][]byte) []Probe {
+	probes := make([]Probe, 0, len(opcodes)*len(payloads))
+	for _, opcode := range opcodes {
+		for _, payload := range payloads {
+			probes = append(probes, Probe{Opcode: opcode, Payload: payload})
+		}
+	}
+	return probes
+}
+
+// Reply is a frame received while waiting after a probe.
+type Reply struct {
+	// Latency is the time between sending the probe and receiving the reply
+	Latency     time.Duration `json:"latency"`
+	Hex         string        `json:"hex"`
+	Description string        `json:"desc"`
+}
+
+// Result is one line of the JSONL report.
+type Result struct {
+	Request string    `json:"request"`
+	SentAt  time.Time `json:"sent_at"`
+	Replies []Reply   `json:"replies"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Explorer sends probes one at a time and collects everything the speaker sends back within the wait time.
+type Explorer struct {
+	client   *protocol.SpeakerClient
+	interval time.Duration
+	wait     time.Duration
+	deny     map[byte]bool
+}
+
+// NewExplorer creates an explorer that waits for replies for wait after each probe, and sends a probe at most every interval.
+// Opcodes in deny are skipped on top of the Denied ones.
+func NewExplorer(client *protocol.SpeakerClient, interval time.Duration, wait time.Duration, deny []byte) (*Explorer, error) {
+	if interval < MinInterval {
+		return nil, fmt.Errorf("probe interval %s is below the minimum of %s", interval, MinInterval)
+	}
+
+	explorer := &Explorer{
+		client:   client,
+		interval: interval,
+		wait:     wait,
+		deny:     map[byte]bool{},
+	}
+	for opcode := range Denied {
+		explorer.deny[opcode] = true
+	}
+	for _, opcode := range deny {
+		explorer.deny[opcode] = true
+	}
+	return explorer, nil
+}
+
+// Run sends the probes in order, skipping denied ones and the requests in done, which are the hex frames of a previous run.
+// Every result is passed to report before the next probe is sent.
+// Run stops at the first send or report error, the sweep can then be resumed by passing the reported requests as done.
+func (e *Explorer) Run(ctx context.Context, probes []Probe, done map[string]bool, report func(Result) error) error {
+	frames, unsubscribe := e.client.SubscribeUnsolicited()
+	defer unsubscribe()
+
+	var last time.Time
+	skipped := map[byte]bool{}
+	for _, probe := range probes {
+		frame := probe.Frame()
+		request := frame.String()
+		if e.deny[probe.Opcode] {
+			if !skipped[probe.Opcode] {
+				log.Printf("Skipping opcode %02x: %v", probe.Opcode, ErrDenied)
+				skipped[probe.Opcode] = true
+			}
+			continue
+		}
+		if done[request] {
+			continue
+		}
+
+		if wait := e.interval - time.Since(last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		drainLate(frames)
+
+		last = time.Now()
+		result := Result{Request: request, SentAt: last, Replies: []Reply{}}
+		if err := e.client.SendFrame(ctx, frame); err != nil {
+			return fmt.Errorf("error sending %s: %w", request, err)
+		}
+
+		err := e.collect(ctx, frames, &result)
+		if errors.Is(err, protocol.ErrConnectionClosed) {
+			result.Error = err.Error()
+		} else if err != nil {
+			return err
+		}
+
+		if err := report(result); err != nil {
+			return err
+		}
+		if result.Error != "" {
+			return fmt.Errorf("connection closed after %s", request)
+		}
+	}
+	return nil
+}
+
+// collect adds every frame received within the wait time to the result.
+func (e *Explorer) collect(ctx context.Context, frames <-chan protocol.Frame, result *Result) error {
+	timer := time.NewTimer(e.wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return protocol.ErrConnectionClosed
+			}
+			result.Replies = append(result.Replies, Reply{
+				Latency:     time.Since(result.SentAt),
+				Hex:         frame.String(),
+				Description: protocol.Describe(frame),
+			})
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// drainLate logs frames that arrived after the wait time of the previous probe, so they aren't attributed to the next one.
+func drainLate(frames <-chan protocol.Frame) {
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+			log.Printf("Late reply %s: %s", frame, protocol.Describe(frame))
+		default:
+			return
+		}
+	}
+}
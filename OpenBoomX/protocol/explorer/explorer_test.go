@@ -0,0 +1,104 @@
+package explorer
+
+import (
+	"context"
+	"obx/protocol"
+	"obx/protocol/emulator"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newEmulatedExplorer returns an explorer of an emulated speaker and a function returning the frames it received.
+func newEmulatedExplorer(t *testing.T, interval time.Duration) (*Explorer, func() []protocol.Frame) {
+	t.Helper()
+	speaker := emulator.New()
+	var mutex sync.Mutex
+	var received []protocol.Frame
+	speaker.OnFrame(func(frame protocol.Frame) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, frame)
+	})
+	client := protocol.NewSpeakerClient(speaker, nil)
+	t.Cleanup(func() { _ = client.CloseConnection() })
+
+	explorer, err := NewExplorer(client, interval, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return explorer, func() []protocol.Frame {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]protocol.Frame(nil), received...)
+	}
+}
+
+func run(t *testing.T, explorer *Explorer, probes []Probe, done map[string]bool) []Result {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var results []Result
+	err := explorer.Run(ctx, probes, done, func(result Result) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	return results
+}
+
+func TestNewExplorerRejectsShortInterval(t *testing.T) {
+	if _, err := NewExplorer(nil, MinInterval-time.Millisecond, 0, nil); err == nil {
+		t.Error("NewExplorer() accepted an interval below MinInterval")
+	}
+}
+
+func TestRunNeverSendsDeniedOpcodes(t *testing.T) {
+	explorer, received := newEmulatedExplorer(t, MinInterval)
+	probes := Probes([]byte{protocol.OpBatteryLevel, protocol.OpPowerOff, protocol.OpOluvMode}, [][]byte{nil, {0x01}})
+
+	results := run(t, explorer, probes, nil)
+	if len(results) != 4 {
+		t.Errorf("Run() reported %d probes, want the 4 that aren't denied", len(results))
+	}
+	for _, frame := range received() {
+		if frame.Opcode == protocol.OpPowerOff {
+			t.Errorf("the speaker received %s", frame)
+		}
+	}
+}
+
+func TestRunKeepsMinInterval(t *testing.T) {
+	explorer, received := newEmulatedExplorer(t, MinInterval)
+	probes := Probes([]byte{protocol.OpBatteryLevel, protocol.OpFirmwarePackage, protocol.OpOluvMode}, [][]byte{nil})
+
+	results := run(t, explorer, probes, nil)
+	if len(results) != len(probes) || len(received()) != len(probes) {
+		t.Fatalf("Run() reported %d and sent %d probes, want %d", len(results), len(received()), len(probes))
+	}
+	for i := 1; i < len(results); i++ {
+		if gap := results[i].SentAt.Sub(results[i-1].SentAt); gap < MinInterval {
+			t.Errorf("probe %d was sent %s after the previous one, want at least %s", i, gap, MinInterval)
+		}
+	}
+}
+
+func TestRunResumesAfterDoneProbes(t *testing.T) {
+	explorer, received := newEmulatedExplorer(t, MinInterval)
+	probes := Probes([]byte{protocol.OpBatteryLevel, protocol.OpFirmwarePackage, protocol.OpOluvMode}, [][]byte{nil})
+	done := map[string]bool{probes[0].Frame().String(): true, probes[1].Frame().String(): true}
+
+	results := run(t, explorer, probes, done)
+	if len(results) != 1 || results[0].Request != probes[2].Frame().String() {
+		t.Fatalf("Run() reported %+v, want only %s", results, probes[2].Frame())
+	}
+	if len(results[0].Replies) == 0 {
+		t.Error("the resumed probe got no reply")
+	}
+	frames := received()
+	if len(frames) != 1 || frames[0].Opcode != protocol.OpOluvMode {
+		t.Errorf("the speaker received %v, want the Oluv mode probe only", frames)
+	}
+}
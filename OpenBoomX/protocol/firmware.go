@@ -0,0 +1,253 @@
+package protocol
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is a semantic version like 0.39.0, firmware versions like v0.39 have a zero patch.
+type Version struct {
+	Major, Minor, Patch int
+	// Prerelease is the part after the hyphen, like "beta.2", a prerelease comes before its release
+	Prerelease string
+}
+
+// ParseVersion parses a version like "v0.39", "1.2.3" or "1.2.3-beta.2".
+func ParseVersion(text string) (Version, error) {
+	core, prerelease, hasPrerelease := strings.Cut(strings.TrimPrefix(text, "v"), "-")
+	if hasPrerelease && prerelease == "" {
+		return Version{}, fmt.Errorf("invalid version %q: empty prerelease", text)
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q: more than 3 numbers", text)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || part[0] == '+' {
+			return Version{}, fmt.Errorf("invalid version %q", text)
+		}
+		numbers[i] = number
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease}, nil
+}
+
+func (v Version) String() string {
+	text := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		text += "-" + v.Prerelease
+	}
+	return text
+}
+
+// IsZero reports whether the version is 0.0.0.
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Compare returns -1, 0 or +1 if v comes before, is the same as or comes after other, following semantic versioning.
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff != 0 {
+			return sign(diff)
+		}
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// comparePrerelease compares the dot separated identifiers, numbers numerically and before names.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// VersionRange is the versions from Min to Max, both included. A zero Max has no upper limit.
+type VersionRange struct {
+	Min, Max Version
+}
+
+// Contains reports whether version is in the range.
+func (r VersionRange) Contains(version Version) bool {
+	return version.Compare(r.Min) >= 0 && (r.Max.IsZero() || version.Compare(r.Max) <= 0)
+}
+
+func (r VersionRange) String() string {
+	switch {
+	case r.Max.IsZero():
+		return fmt.Sprintf(">= %s", r.Min)
+	case r.Min == r.Max:
+		return r.Min.String()
+	}
+	return fmt.Sprintf("%s - %s", r.Min, r.Max)
+}
+
+// FirmwareInfo is a firmware package name like SP500_20240912_v0.39_ota.bin taken apart.
+type FirmwareInfo struct {
+	// Package is the name the speaker reported
+	Package string `json:"package"`
+	// Platform is the chip or board the firmware is built for, like SP500, it is empty if Package couldn't be parsed
+	Platform  string    `json:"platform,omitempty"`
+	BuildDate time.Time `json:"buildDate,omitzero"`
+	Version   Version   `json:"version"`
+}
+
+// firmwarePattern matches <platform>_<yyyymmdd>_v<version>, optionally followed by _ota or other parts and .bin
+var firmwarePattern = regexp.MustCompile(`^([0-9A-Za-z-]+)_(\d{8})_(v\d+(?:\.\d+){0,2}(?:-[0-9A-Za-z.-]+)?)(?:_[^.]*)?(?:\.bin)?$`)
+
+// ParseFirmware parses a firmware package name, see ParseFirmwarePackageReply.
+// The returned info keeps the package name even if it can't be parsed.
+func ParseFirmware(name string) (FirmwareInfo, error) {
+	info := FirmwareInfo{Package: name}
+	match := firmwarePattern.FindStringSubmatch(name)
+	if match == nil {
+		return info, fmt.Errorf("unknown firmware package name format: %q", name)
+	}
+	buildDate, err := time.Parse("20060102", match[2])
+	if err != nil {
+		return info, fmt.Errorf("invalid build date in firmware package name %q: %w", name, err)
+	}
+	version, err := ParseVersion(match[3])
+	if err != nil {
+		return info, fmt.Errorf("invalid version in firmware package name %q: %w", name, err)
+	}
+	info.Platform = match[1]
+	info.BuildDate = buildDate
+	info.Version = version
+	return info, nil
+}
+
+// Parsed reports whether the package name could be taken apart.
+func (info FirmwareInfo) Parsed() bool {
+	return info.Platform != ""
+}
+
+// String returns the firmware like "SP500 v0.39.0 built 2024-09-12", or the package name if it couldn't be parsed.
+func (info FirmwareInfo) String() string {
+	if !info.Parsed() {
+		return info.Package
+	}
+	return fmt.Sprintf("%s v%s built %s", info.Platform, info.Version, info.BuildDate.Format(time.DateOnly))
+}
+
+// FirmwareRange is the firmware of a platform within a version range.
+type FirmwareRange struct {
+	// Platform is the platform of the firmware, empty for any platform
+	Platform string
+	Versions VersionRange
+}
+
+// Contains reports whether the firmware is in the range, firmware that couldn't be parsed never is.
+func (r FirmwareRange) Contains(firmware FirmwareInfo) bool {
+	if !firmware.Parsed() || (r.Platform != "" && !strings.EqualFold(r.Platform, firmware.Platform)) {
+		return false
+	}
+	return r.Versions.Contains(firmware.Version)
+}
+
+func (r FirmwareRange) String() string {
+	if r.Platform == "" {
+		return r.Versions.String()
+	}
+	return fmt.Sprintf("%s %s", r.Platform, r.Versions)
+}
+
+// Quirk is a difference of some firmware of a model, like a setting that came with an update or a changed frame layout.
+type Quirk struct {
+	// Model is the name of the model, see Model.Name
+	Model       string
+	Firmware    FirmwareRange
+	Description string
+	// Apply changes a copy of the model for the firmware, like turning off a capability or replacing its Frames
+	Apply func(model *Model)
+}
+
+var (
+	quirksMutex sync.RWMutex
+	// quirks are the known firmware differences. No UBoom X firmware is known to differ from protocol.md yet.
+	quirks []Quirk
+)
+
+// RegisterQuirk adds a quirk, quirks are applied in the order they were registered.
+func RegisterQuirk(quirk Quirk) {
+	quirksMutex.Lock()
+	defer quirksMutex.Unlock()
+	quirks = append(quirks, quirk)
+}
+
+// Quirks returns the quirks of the model on the firmware.
+func Quirks(model string, firmware FirmwareInfo) []Quirk {
+	quirksMutex.RLock()
+	defer quirksMutex.RUnlock()
+
+	var matching []Quirk
+	for _, quirk := range quirks {
+		if strings.EqualFold(quirk.Model, model) && quirk.Firmware.Contains(firmware) {
+			matching = append(matching, quirk)
+		}
+	}
+	return matching
+}
+
+// ForFirmware returns the model as it behaves on the firmware, a copy with its quirks applied.
+// The model itself is returned if no quirk matches.
+func (model *Model) ForFirmware(firmware FirmwareInfo) *Model {
+	matching := Quirks(model.Name, firmware)
+	if len(matching) == 0 {
+		return model
+	}
+	changed := model.clone()
+	for _, quirk := range matching {
+		quirk.Apply(changed)
+	}
+	return changed
+}
+
+// IsKnownFirmware reports whether the model profile was confirmed with the firmware, see Model.KnownFirmware.
+// Settings may not work as expected on other firmware.
+func (model *Model) IsKnownFirmware(firmware FirmwareInfo) bool {
+	return slices.ContainsFunc(model.KnownFirmware, func(known FirmwareRange) bool {
+		return known.Contains(firmware)
+	})
+}
@@ -0,0 +1,191 @@
+package protocol
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFirmware(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		date     string
+		version  Version
+		wantErr  bool
+	}{
+		{name: "SP500_20240912_v0.39_ota.bin", platform: "SP500", date: "2024-09-12", version: Version{Minor: 39}},
+		{name: "SP500_20240912_v0.39", platform: "SP500", date: "2024-09-12", version: Version{Minor: 39}},
+		{name: "SP500_20250101_v1.2.3.bin", platform: "SP500", date: "2025-01-01", version: Version{Major: 1, Minor: 2, Patch: 3}},
+		{name: "SP-600_20250101_v1.0-beta.2_ota.bin", platform: "SP-600", date: "2025-01-01", version: Version{Major: 1, Prerelease: "beta.2"}},
+		{name: "", wantErr: true},
+		{name: "SP500", wantErr: true},
+		{name: "SP500_2024091_v0.39_ota.bin", wantErr: true},
+		{name: "SP500_20241312_v0.39_ota.bin", wantErr: true},
+		{name: "SP500_20240912_0.39_ota.bin", wantErr: true},
+		{name: "SP500_20240912_v0.39.1.2_ota.bin", wantErr: true},
+		{name: "SP500_20240912_v0.39-_ota.bin", wantErr: true},
+		{name: "SP500_20240912_v99999999999999999999_ota.bin", wantErr: true},
+		{name: "SP500 20240912 v0.39", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseFirmware(tt.name)
+			if info.Package != tt.name {
+				t.Errorf("Package = %q, want the package name", info.Package)
+			}
+			if tt.wantErr {
+				if err == nil || info.Parsed() {
+					t.Errorf("ParseFirmware() = %+v, %v, want an error", info, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFirmware() error = %v", err)
+			}
+			if info.Platform != tt.platform || info.BuildDate.Format(time.DateOnly) != tt.date || info.Version != tt.version {
+				t.Errorf("ParseFirmware() = %+v, want %s %s %s", info, tt.platform, tt.date, tt.version)
+			}
+		})
+	}
+}
+
+func TestFirmwareInfoJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		wantBuildDate bool
+	}{
+		{name: "SP500_20240912_v0.39_ota.bin", wantBuildDate: true},
+		// an unknown name has no build date, which is left out instead of showing 0001-01-01
+		{name: "firmware.bin", wantBuildDate: false},
+	}
+	for _, tt := range tests {
+		info, _ := ParseFirmware(tt.name)
+		data, err := json.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(string(data), `"buildDate"`); got != tt.wantBuildDate {
+			t.Errorf("json.Marshal(%s) = %s, want buildDate %v", tt.name, data, tt.wantBuildDate)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// ascending, following the precedence example of semver.org
+	versions := []string{
+		"0.9.0", "0.39", "0.39.1", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2", "v1.10", "2",
+	}
+	for i, a := range versions {
+		for j, b := range versions {
+			va, err := ParseVersion(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vb, err := ParseVersion(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := va.Compare(vb), sign(i-j); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestFirmwareRangeContains(t *testing.T) {
+	firmware := func(name string) FirmwareInfo {
+		info, _ := ParseFirmware(name)
+		return info
+	}
+	tests := []struct {
+		name     string
+		r        FirmwareRange
+		firmware FirmwareInfo
+		want     bool
+	}{
+		{"single version", FirmwareRange{"SP500", VersionRange{Version{Minor: 39}, Version{Minor: 39}}}, firmware("SP500_20240912_v0.39_ota.bin"), true},
+		{"newer version", FirmwareRange{"SP500", VersionRange{Version{Minor: 39}, Version{Minor: 39}}}, firmware("SP500_20250101_v0.40_ota.bin"), false},
+		{"no upper limit", FirmwareRange{"SP500", VersionRange{Min: Version{Minor: 39}}}, firmware("SP500_20250101_v2.0_ota.bin"), true},
+		{"prerelease before the minimum", FirmwareRange{"SP500", VersionRange{Min: Version{Major: 1}}}, firmware("SP500_20250101_v1.0-rc.1_ota.bin"), false},
+		{"other platform", FirmwareRange{"SP500", VersionRange{}}, firmware("SP600_20250101_v0.39_ota.bin"), false},
+		{"platform ignoring case", FirmwareRange{"sp500", VersionRange{}}, firmware("SP500_20250101_v0.39_ota.bin"), true},
+		{"any platform", FirmwareRange{"", VersionRange{}}, firmware("SP600_20250101_v0.39_ota.bin"), true},
+		{"unparsed firmware", FirmwareRange{"", VersionRange{}}, firmware("unknown"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.Contains(tt.firmware); got != tt.want {
+				t.Errorf("%s Contains(%s) = %v, want %v", tt.r, tt.firmware, got, tt.want)
+			}
+		})
+	}
+}
+
+// registerTestQuirk registers quirk until the test ends.
+func registerTestQuirk(t *testing.T, quirk Quirk) {
+	quirksMutex.Lock()
+	registered := slices.Clone(quirks)
+	quirksMutex.Unlock()
+	t.Cleanup(func() {
+		quirksMutex.Lock()
+		defer quirksMutex.Unlock()
+		quirks = registered
+	})
+	RegisterQuirk(quirk)
+}
+
+func TestForFirmware(t *testing.T) {
+	registerTestQuirk(t, Quirk{
+		Model:       UBoomXName,
+		Firmware:    FirmwareRange{Platform: "SP500", Versions: VersionRange{Min: Version{Minor: 40}}},
+		Description: "test firmware without video mode and with fewer beep volumes",
+		Apply: func(model *Model) {
+			model.Capabilities.VideoMode = false
+			model.Capabilities.BeepVolumes = model.Capabilities.BeepVolumes[:2]
+		},
+	})
+
+	tests := []struct {
+		firmware  string
+		quirks    int
+		videoMode bool
+		known     bool
+	}{
+		{firmware: "SP500_20240912_v0.39_ota.bin", videoMode: true, known: true},
+		{firmware: "SP500_20250101_v0.40_ota.bin", quirks: 1},
+		{firmware: "SP600_20250101_v0.40_ota.bin", videoMode: true},
+		{firmware: "unknown", videoMode: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.firmware, func(t *testing.T) {
+			info, _ := ParseFirmware(tt.firmware)
+			if got := len(Quirks(UBoomXName, info)); got != tt.quirks {
+				t.Errorf("Quirks() has %d quirks, want %d", got, tt.quirks)
+			}
+			model := UBoomX.ForFirmware(info)
+			if tt.quirks == 0 && model != UBoomX {
+				t.Error("ForFirmware() copied the model without a quirk")
+			}
+			if model.Capabilities.VideoMode != tt.videoMode {
+				t.Errorf("video mode = %v, want %v", model.Capabilities.VideoMode, tt.videoMode)
+			}
+			if known := UBoomX.IsKnownFirmware(info); known != tt.known {
+				t.Errorf("IsKnownFirmware() = %v, want %v", known, tt.known)
+			}
+		})
+	}
+
+	// the quirk changes a copy only
+	info, _ := ParseFirmware("SP500_20250101_v0.40_ota.bin")
+	model := UBoomX.ForFirmware(info)
+	if len(model.Capabilities.BeepVolumes) != 2 || len(UBoomX.Capabilities.BeepVolumes) == 2 || !UBoomX.Capabilities.VideoMode {
+		t.Errorf("beep volumes = %v, UBoomX beep volumes = %v, want the quirk on the copy only", model.Capabilities.BeepVolumes, UBoomX.Capabilities.BeepVolumes)
+	}
+	if err := checkSupported(model, videoModes, model.videoModes(), VideoModeOn); err == nil {
+		t.Error("the video mode is still supported with the quirk")
+	}
+}
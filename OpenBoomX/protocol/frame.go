@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Frame is a single UBoom X protocol packet:
+//
+//	start(ef) class opcode length payload[length] checksum end(fe)
+type Frame struct {
+	Class    byte
+	Opcode   byte
+	Payload  []byte
+	Checksum byte
+}
+
+const (
+	FrameStart byte = 0xef
+	FrameEnd   byte = 0xfe
+
+	// frameOverhead is the number of bytes in a frame besides the payload
+	frameOverhead  = 6
+	MaxPayloadSize = 0xff
+	MaxFrameSize   = frameOverhead + MaxPayloadSize
+)
+
+var (
+	ErrFrameTooShort   = errors.New("frame is too short")
+	ErrFrameStart      = errors.New("frame does not start with 0xef")
+	ErrFrameEnd        = errors.New("frame does not end with 0xfe")
+	ErrFrameLength     = errors.New("frame length byte does not match payload")
+	ErrPayloadTooLong  = errors.New("frame payload is longer than 255 bytes")
+	ErrUnknownClass    = errors.New("unknown frame class")
+	ErrUnexpectedReply = errors.New("unexpected reply frame")
+)
+
+// NewFrame creates a frame with the checksum calculated from the payload.
+func NewFrame(class byte, opcode byte, payload ...byte) Frame {
+	return Frame{
+		Class:    class,
+		Opcode:   opcode,
+		Payload:  payload,
+		Checksum: Checksum(payload),
+	}
+}
+
+// Checksum is the sum of the length byte and the payload bytes, truncated to a byte.
+func Checksum(payload []byte) byte {
+	sum := byte(len(payload))
+	for _, b := range payload {
+		sum += b
+	}
+	return sum
+}
+
+// HasValidChecksum reports whether the checksum matches the payload.
+// The speaker ignores the checksum of some writes (lights, custom EQ), so this is not enforced when decoding.
+func (f Frame) HasValidChecksum() bool {
+	return f.Checksum == Checksum(f.Payload)
+}
+
+func (f Frame) Validate() error {
+	if f.Class != ClassWrite && f.Class != ClassRead {
+		return fmt.Errorf("%w: %02x", ErrUnknownClass, f.Class)
+	}
+	if len(f.Payload) > MaxPayloadSize {
+		return ErrPayloadTooLong
+	}
+	return nil
+}
+
+func (f Frame) Encode() ([]byte, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f.encode(), nil
+}
+
+// encode returns the frame as it is sent on the wire without validating the class,
+// frames of unknown classes are kept as they were read. The payload must not be longer than MaxPayloadSize.
+func (f Frame) encode() []byte {
+	buf := make([]byte, 0, frameOverhead+len(f.Payload))
+	buf = append(buf, FrameStart, f.Class, f.Opcode, byte(len(f.Payload)))
+	buf = append(buf, f.Payload...)
+	buf = append(buf, f.Checksum, FrameEnd)
+	return buf
+}
+
+// Decode parses exactly one frame from data.
+func Decode(data []byte) (Frame, error) {
+	frame, err := decode(data)
+	if err != nil {
+		return Frame{}, err
+	}
+	if err := frame.Validate(); err != nil {
+		return Frame{}, err
+	}
+	return frame, nil
+}
+
+// decode parses exactly one frame from data, only the start byte, the length and the end byte are checked.
+func decode(data []byte) (Frame, error) {
+	if len(data) < frameOverhead {
+		return Frame{}, ErrFrameTooShort
+	}
+	if data[0] != FrameStart {
+		return Frame{}, ErrFrameStart
+	}
+	if data[len(data)-1] != FrameEnd {
+		return Frame{}, ErrFrameEnd
+	}
+
+	length := int(data[3])
+	if len(data) != frameOverhead+length {
+		return Frame{}, fmt.Errorf("%w: length %d, got %d payload bytes", ErrFrameLength, length, len(data)-frameOverhead)
+	}
+
+	payload := make([]byte, length)
+	copy(payload, data[4:4+length])
+
+	return Frame{
+		Class:    data[1],
+		Opcode:   data[2],
+		Payload:  payload,
+		Checksum: data[4+length],
+	}, nil
+}
+
+// DecodeHex parses a frame from its hex string representation, e.g. "efa0140000fe".
+func DecodeHex(hexMsg string) (Frame, error) {
+	data, err := hex.DecodeString(hexMsg)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to decode hex message: %w", err)
+	}
+	return Decode(data)
+}
+
+// String returns the hex representation of the frame as it is sent on the wire, including frames of unknown classes.
+func (f Frame) String() string {
+	if len(f.Payload) > MaxPayloadSize {
+		return fmt.Sprintf("invalid frame (%v)", ErrPayloadTooLong)
+	}
+	return hex.EncodeToString(f.encode())
+}
+
+// Is reports whether the frame has the given class and opcode.
+func (f Frame) Is(class byte, opcode byte) bool {
+	return f.Class == class && f.Opcode == opcode
+}
@@ -0,0 +1,208 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrConnectionClosed = errors.New("speaker connection closed")
+
+// subscriberBufferSize is how many unsolicited frames a subscriber can lag behind before frames are dropped
+const subscriberBufferSize = 16
+
+// lateReplyWindow is how long after a request gave up its reply is still taken for a late reply and not for an event
+const lateReplyWindow = 10 * time.Second
+
+// frameMux owns the read side of a connection. A single goroutine reads frames
+// and delivers each one to the oldest waiter registered for its class and opcode.
+// Frames nobody waits for are handed to the unsolicited frame subscribers,
+// except late replies to requests that gave up waiting.
+type frameMux struct {
+	rfcomm      RfcommClient
+	onFrame     func(frame Frame)
+	cancelRead  context.CancelFunc
+	mutex       sync.Mutex
+	waiters     map[uint16][]chan Frame
+	abandoned   map[uint16][]time.Time
+	subscribers []chan Frame
+	err         error
+	done        chan struct{}
+}
+
+// newFrameMux starts reading from rfcomm, onFrame is called with every frame before it is delivered.
+func newFrameMux(rfcomm RfcommClient, onFrame func(frame Frame)) *frameMux {
+	mux := &frameMux{
+		rfcomm:    rfcomm,
+		onFrame:   onFrame,
+		waiters:   make(map[uint16][]chan Frame),
+		abandoned: make(map[uint16][]time.Time),
+		done:      make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	mux.cancelRead = cancel
+	go mux.readLoop(ctx)
+	return mux
+}
+
+func waiterKey(class byte, opcode byte) uint16 {
+	return uint16(class)<<8 | uint16(opcode)
+}
+
+func (mux *frameMux) readLoop(ctx context.Context) {
+	scanner := NewFrameScanner(mux.rfcomm)
+	for {
+		frame, err := scanner.Next(ctx)
+		var garbage *GarbageError
+		if errors.As(err, &garbage) {
+			log.Println(garbage)
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			mux.stop(ErrConnectionClosed)
+			return
+		}
+		if err != nil {
+			// keeps the cause, but callers only need to check for ErrConnectionClosed
+			mux.stop(fmt.Errorf("%w: %w", ErrConnectionClosed, err))
+			return
+		}
+		mux.onFrame(frame)
+		mux.dispatch(frame)
+	}
+}
+
+func (mux *frameMux) dispatch(frame Frame) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	key := waiterKey(frame.Class, frame.Opcode)
+	if waiters := mux.waiters[key]; len(waiters) > 0 {
+		waiters[0] <- frame
+		mux.waiters[key] = waiters[1:]
+		return
+	}
+	if mux.takeAbandoned(key) {
+		log.Printf("Dropping late reply %s", frame)
+		return
+	}
+
+	for _, subscriber := range mux.subscribers {
+		select {
+		case subscriber <- frame:
+		default:
+			log.Printf("Subscriber is not keeping up, dropping frame %s", frame)
+		}
+	}
+}
+
+// stop fails all pending and future waiters with err and closes the subscriber channels.
+func (mux *frameMux) stop(err error) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	mux.err = err
+	close(mux.done)
+	mux.waiters = make(map[uint16][]chan Frame)
+	for _, subscriber := range mux.subscribers {
+		close(subscriber)
+	}
+	mux.subscribers = nil
+}
+
+// expect registers a waiter for the next frame with the given class and opcode.
+// It must be called before sending the request, so the reply can't slip past.
+func (mux *frameMux) expect(class byte, opcode byte) (<-chan Frame, error) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	if mux.err != nil {
+		return nil, mux.err
+	}
+
+	waiter := make(chan Frame, 1)
+	key := waiterKey(class, opcode)
+	mux.waiters[key] = append(mux.waiters[key], waiter)
+	return waiter, nil
+}
+
+// cancel removes a waiter whose request was never sent.
+func (mux *frameMux) cancel(class byte, opcode byte, waiter <-chan Frame) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	mux.removeWaiter(waiterKey(class, opcode), waiter)
+}
+
+// abandon removes a waiter whose request was sent but that stopped waiting,
+// so its reply is dropped when it still arrives within lateReplyWindow.
+func (mux *frameMux) abandon(class byte, opcode byte, waiter <-chan Frame) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	key := waiterKey(class, opcode)
+	if mux.removeWaiter(key, waiter) {
+		mux.abandoned[key] = append(mux.abandoned[key], time.Now().Add(lateReplyWindow))
+	}
+}
+
+// removeWaiter reports whether the waiter was still registered, it isn't once it got its frame.
+func (mux *frameMux) removeWaiter(key uint16, waiter <-chan Frame) bool {
+	waiters := mux.waiters[key]
+	for i, w := range waiters {
+		if w == waiter {
+			mux.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// takeAbandoned reports whether a request that gave up on key within lateReplyWindow is left, and forgets it.
+func (mux *frameMux) takeAbandoned(key uint16) bool {
+	expiries := mux.abandoned[key]
+	for len(expiries) > 0 && time.Now().After(expiries[0]) {
+		expiries = expiries[1:]
+	}
+	if len(expiries) == 0 {
+		delete(mux.abandoned, key)
+		return false
+	}
+	mux.abandoned[key] = expiries[1:]
+	return true
+}
+
+// subscribe returns a channel of frames that no waiter was registered for.
+// The channel is closed when the connection ends or the returned function is called.
+func (mux *frameMux) subscribe() (<-chan Frame, func()) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	subscriber := make(chan Frame, subscriberBufferSize)
+	if mux.err != nil {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+	mux.subscribers = append(mux.subscribers, subscriber)
+
+	return subscriber, func() {
+		mux.mutex.Lock()
+		defer mux.mutex.Unlock()
+
+		for i, s := range mux.subscribers {
+			if s == subscriber {
+				mux.subscribers = append(mux.subscribers[:i], mux.subscribers[i+1:]...)
+				close(subscriber)
+				return
+			}
+		}
+	}
+}
+
+// close stops the read loop, pending and future requests fail with ErrConnectionClosed.
+func (mux *frameMux) close() {
+	mux.cancelRead()
+}
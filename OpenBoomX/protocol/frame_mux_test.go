@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLateReplyIsNotAnEvent(t *testing.T) {
+	conn := newFakeConn()
+	client := NewSpeakerClient(conn, nil)
+	t.Cleanup(func() { _ = client.CloseConnection() })
+	events, unsubscribe := client.SubscribeUnsolicited()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.ReadOluvMode(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ReadOluvMode() = %v, want the deadline to pass", err)
+	}
+
+	// the reply to the request that gave up, then the speaker switching the mode itself
+	conn.rx <- mustEncode(t, NewFrame(ClassRead, OpOluvMode, byte(OluvIndoor)))
+	conn.rx <- mustEncode(t, NewFrame(ClassRead, OpOluvMode, byte(OluvOutdoor)))
+
+	select {
+	case event := <-events:
+		if want := NewFrame(ClassRead, OpOluvMode, byte(OluvOutdoor)); event.Opcode != want.Opcode || event.Payload[0] != want.Payload[0] {
+			t.Errorf("event = %s, want %s", event, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event after the late reply was never delivered")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %s", event)
+	default:
+	}
+}
+
+func TestAbandonedRequestIsForgotten(t *testing.T) {
+	mux := &frameMux{waiters: make(map[uint16][]chan Frame), abandoned: make(map[uint16][]time.Time)}
+	key := waiterKey(ClassRead, OpOluvMode)
+	mux.abandoned[key] = []time.Time{time.Now().Add(-time.Second)}
+
+	if mux.takeAbandoned(key) {
+		t.Error("a reply after lateReplyWindow was taken for a late reply")
+	}
+	if _, ok := mux.abandoned[key]; ok {
+		t.Error("the expired request is still kept")
+	}
+}
@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrIncompleteFrame is returned by FrameBuffer.Next when more bytes are needed to complete a frame
+var ErrIncompleteFrame = errors.New("incomplete frame")
+
+// GarbageError reports bytes that were discarded because they aren't part of a valid frame.
+// The stream is resynchronised on the next 0xef, so reading can continue after it.
+type GarbageError struct {
+	Data []byte
+}
+
+func (e *GarbageError) Error() string {
+	return fmt.Sprintf("discarded %d bytes of garbage: %x", len(e.Data), e.Data)
+}
+
+// FrameBuffer reassembles frames from a byte stream.
+// Reads may contain partial frames, several frames or bytes that aren't frames at all.
+// Frames are found by their start byte, length and end byte only, frames of unknown classes are returned as well,
+// it is up to the reader to check the class.
+type FrameBuffer struct {
+	buf []byte
+}
+
+func (b *FrameBuffer) Write(p []byte) {
+	b.buf = append(b.buf, p...)
+}
+
+// Reset drops the buffered bytes, like a partial frame of a lost connection.
+func (b *FrameBuffer) Reset() {
+	b.buf = b.buf[:0]
+}
+
+// Len returns the number of buffered bytes that weren't returned as a frame yet.
+func (b *FrameBuffer) Len() int {
+	return len(b.buf)
+}
+
+// Next returns the next complete frame in the buffer.
+// It returns ErrIncompleteFrame if more data is needed or a *GarbageError if bytes were discarded.
+func (b *FrameBuffer) Next() (Frame, error) {
+	if len(b.buf) == 0 {
+		return Frame{}, ErrIncompleteFrame
+	}
+
+	if b.buf[0] != FrameStart {
+		start := bytes.IndexByte(b.buf, FrameStart)
+		if start == -1 {
+			start = len(b.buf)
+		}
+		return Frame{}, b.discard(start)
+	}
+
+	if len(b.buf) < 4 {
+		return Frame{}, ErrIncompleteFrame
+	}
+
+	size := frameOverhead + int(b.buf[3])
+	if len(b.buf) < size {
+		return Frame{}, ErrIncompleteFrame
+	}
+
+	frame, err := decode(b.buf[:size])
+	if err != nil {
+		// not a frame after all, skip the start byte and look for the next one
+		return Frame{}, b.discard(1)
+	}
+
+	b.consume(size)
+	return frame, nil
+}
+
+func (b *FrameBuffer) discard(n int) error {
+	garbage := make([]byte, n)
+	copy(garbage, b.buf[:n])
+	b.consume(n)
+	return &GarbageError{Data: garbage}
+}
+
+func (b *FrameBuffer) consume(n int) {
+	b.buf = append(b.buf[:0], b.buf[n:]...)
+}
+
+// FrameScanner reads frames from an RfcommClient.
+type FrameScanner struct {
+	rfcomm RfcommClient
+	buffer FrameBuffer
+}
+
+func NewFrameScanner(rfcomm RfcommClient) *FrameScanner {
+	return &FrameScanner{rfcomm: rfcomm}
+}
+
+// Next blocks until a complete frame has been read.
+// A *GarbageError is not fatal, Next can be called again to continue with the rest of the stream.
+func (s *FrameScanner) Next(ctx context.Context) (Frame, error) {
+	for {
+		frame, err := s.buffer.Next()
+		if !errors.Is(err, ErrIncompleteFrame) {
+			return frame, err
+		}
+
+		buf, n, err := s.rfcomm.ReceiveMessage(ctx, MaxFrameSize)
+		if errors.Is(err, ErrReconnected) {
+			// a partial frame of the lost connection would be completed with bytes of the new one
+			s.buffer.Reset()
+			continue
+		}
+		if err != nil {
+			return Frame{}, err
+		}
+		if n == 0 {
+			return Frame{}, io.EOF
+		}
+		s.buffer.Write(buf[:n])
+	}
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var scannerTests = []struct {
+	name    string
+	reads   []string
+	frames  []string
+	garbage []string
+}{
+	{
+		name:   "one frame",
+		reads:  []string{"efa014015f60fe"},
+		frames: []string{"efa014015f60fe"},
+	},
+	{
+		name:   "split across reads",
+		reads:  []string{"ef", "a014", "015f60", "fe"},
+		frames: []string{"efa014015f60fe"},
+	},
+	{
+		name:   "split in the payload",
+		reads:  []string{"efa0101c53503530305f323032", "34303931325f76302e33395f6f74612e62696ef0fe"},
+		frames: []string{"efa0101c53503530305f32303234303931325f76302e33395f6f74612e62696ef0fe"},
+	},
+	{
+		name:   "several frames in one read",
+		reads:  []string{"efa014015f60feefb046010102feefa0460000fe"},
+		frames: []string{"efa014015f60fe", "efb046010102fe", "efa0460000fe"},
+	},
+	{
+		name:   "several frames split across reads",
+		reads:  []string{"efa014015f60feefb0", "46010102feef", "a0460000fe"},
+		frames: []string{"efa014015f60fe", "efb046010102fe", "efa0460000fe"},
+	},
+	{
+		name:    "leading garbage",
+		reads:   []string{"0102fe03efa014015f60fe"},
+		frames:  []string{"efa014015f60fe"},
+		garbage: []string{"0102fe03"},
+	},
+	{
+		name:    "garbage between frames",
+		reads:   []string{"efa014015f60fe", "0000", "efb046010102fe"},
+		frames:  []string{"efa014015f60fe", "efb046010102fe"},
+		garbage: []string{"0000"},
+	},
+	{
+		name:   "stray 0xef inside a payload",
+		reads:  []string{"efb0950401ef00ef00fe", "efa014015f60fe"},
+		frames: []string{"efb0950401ef00ef00fe", "efa014015f60fe"},
+	},
+	{
+		name:    "start byte without a frame",
+		reads:   []string{"efa0140100fe", "efa014015f60fe"},
+		frames:  []string{"efa014015f60fe"},
+		garbage: []string{"ef", "a0140100fe"},
+	},
+	{
+		name:   "unknown class",
+		reads:  []string{"efc0140000fe", "efa014015f60fe"},
+		frames: []string{"efc0140000fe", "efa014015f60fe"},
+	},
+}
+
+func decodeReads(t *testing.T, reads []string) [][]byte {
+	t.Helper()
+	var data [][]byte
+	for _, read := range reads {
+		b, err := hex.DecodeString(read)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b)
+	}
+	return data
+}
+
+func TestFrameBuffer(t *testing.T) {
+	for _, tt := range scannerTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer FrameBuffer
+			var frames, garbage []string
+			for _, read := range decodeReads(t, tt.reads) {
+				buffer.Write(read)
+				for {
+					frame, err := buffer.Next()
+					if errors.Is(err, ErrIncompleteFrame) {
+						break
+					}
+					var garbageErr *GarbageError
+					if errors.As(err, &garbageErr) {
+						garbage = append(garbage, hex.EncodeToString(garbageErr.Data))
+						continue
+					}
+					if err != nil {
+						t.Fatalf("Next() error = %v", err)
+					}
+					frames = append(frames, frame.String())
+				}
+			}
+
+			if !slices.Equal(frames, tt.frames) {
+				t.Errorf("frames = %v, want %v", frames, tt.frames)
+			}
+			if !slices.Equal(garbage, tt.garbage) {
+				t.Errorf("garbage = %v, want %v", garbage, tt.garbage)
+			}
+			if buffer.Len() != 0 {
+				t.Errorf("%d bytes left in the buffer", buffer.Len())
+			}
+		})
+	}
+}
+
+func TestFrameScanner(t *testing.T) {
+	for _, tt := range scannerTests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newFakeConn()
+			for _, read := range decodeReads(t, tt.reads) {
+				conn.rx <- read
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			scanner := NewFrameScanner(conn)
+			var frames []string
+			for len(frames) < len(tt.frames) {
+				frame, err := scanner.Next(ctx)
+				var garbage *GarbageError
+				if errors.As(err, &garbage) {
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				frames = append(frames, frame.String())
+			}
+
+			if !slices.Equal(frames, tt.frames) {
+				t.Errorf("frames = %v, want %v", frames, tt.frames)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"obx/protocol/eq"
+	"testing"
+)
+
+// documentedFrames are the frames of protocol.md and the frames the client builds for them.
+var documentedFrames = []struct {
+	name  string
+	hex   string
+	frame Frame
+}{
+	{"Oluv Studio", "efb046010102fe", NewOluvModeFrame(OluvStudio)},
+	{"Oluv Indoor", "efb046010203fe", NewOluvModeFrame(OluvIndoor)},
+	{"Oluv Indoor+", "efb046010304fe", NewOluvModeFrame(OluvIndoorPlus)},
+	{"Oluv Outdoor", "efb046010405fe", NewOluvModeFrame(OluvOutdoor)},
+	{"Oluv Outdoor+", "efb046010506fe", NewOluvModeFrame(OluvOutdoorPlus)},
+	{"Oluv Boom XXX", "efb046010607fe", NewOluvModeFrame(OluvBoom)},
+	{"Oluv Ground O", "efb046010708fe", NewOluvModeFrame(OluvGround)},
+	{"light default", "efb095040000000000fe", NewLightFrame(LightState{Mode: LightModeDefault})},
+	{"light off", "efb095040100000000fe", NewLightFrame(LightState{Mode: LightModeSolid})},
+	{"light dancing white", "efb0950402ffffff00fe", NewLightFrame(LightState{Mode: LightModeDancing, Color: [3]byte{0xff, 0xff, 0xff}})},
+	{"custom EQ flat", "efb0450b013c3c3c3c3c3c3c3c3c3c00fe", NewCustomEQFrame(eq.Flat())},
+	{"custom EQ limits", "efb0450b0178003c3c3c3c3c3c3c3c00fe", NewCustomEQFrame(mustCurve(10, -10, 0, 0, 0, 0, 0, 0, 0, 0))},
+	{"shutdown 5 minutes", "efb075010102fe", NewShutdownTimeoutFrame(Shutdown5m)},
+	{"shutdown 10 minutes", "efb075010203fe", NewShutdownTimeoutFrame(Shutdown10m)},
+	{"shutdown 30 minutes", "efb075010304fe", NewShutdownTimeoutFrame(Shutdown30m)},
+	{"shutdown 60 minutes", "efb075010405fe", NewShutdownTimeoutFrame(Shutdown60m)},
+	{"shutdown 90 minutes", "efb075010506fe", NewShutdownTimeoutFrame(Shutdown90m)},
+	{"shutdown 120 minutes", "efb075010607fe", NewShutdownTimeoutFrame(Shutdown120m)},
+	{"no shutdown", "efb07501ff00fe", NewShutdownTimeoutFrame(ShutdownNever)},
+	{"power off", "efb025010102fe", NewPowerOffFrame()},
+	{"video mode off", "efb035010001fe", NewVideoModeFrame(VideoModeOff)},
+	{"video mode on", "efb035010102fe", NewVideoModeFrame(VideoModeOn)},
+	{"beep volume 0%", "efb065010102fe", NewBeepVolumeFrame(BeepVolume0)},
+	{"beep volume 25%", "efb065010203fe", NewBeepVolumeFrame(BeepVolume25)},
+	{"beep volume 50%", "efb065010304fe", NewBeepVolumeFrame(BeepVolume50)},
+	{"beep volume 75%", "efb065010405fe", NewBeepVolumeFrame(BeepVolume75)},
+	{"beep volume 100%", "efb065010506fe", NewBeepVolumeFrame(BeepVolume100)},
+	{"battery request", "efa0140000fe", NewBatteryLevelRequestFrame()},
+	{"battery reply", "efa014015f60fe", NewFrame(ClassRead, OpBatteryLevel, 0x5f)},
+	{"firmware request", "efa0100000fe", NewFirmwarePackageRequestFrame()},
+	{"firmware reply", "efa0101c53503530305f32303234303931325f76302e33395f6f74612e62696ef0fe", NewFrame(ClassRead, OpFirmwarePackage, []byte("SP500_20240912_v0.39_ota.bin")...)},
+	{"read Oluv mode", "efa0460000fe", NewReadRequestFrame(OpOluvMode)},
+	{"read custom EQ", "efa0450000fe", NewReadRequestFrame(OpCustomEQ)},
+	{"read light", "efa0950000fe", NewReadRequestFrame(OpLight)},
+	{"read beep volume", "efa0650000fe", NewReadRequestFrame(OpBeepVolume)},
+	{"read video mode", "efa0350000fe", NewReadRequestFrame(OpVideoMode)},
+	{"read shutdown timeout", "efa0750000fe", NewReadRequestFrame(OpShutdownTimeout)},
+}
+
+func mustCurve(gains ...float64) eq.Curve {
+	curve, err := eq.NewCurve(gains...)
+	if err != nil {
+		panic(err)
+	}
+	return curve
+}
+
+func TestDocumentedFrames(t *testing.T) {
+	for _, tt := range documentedFrames {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			frame, err := Decode(data)
+			if err != nil {
+				t.Fatalf("Decode(%s) error = %v", tt.hex, err)
+			}
+			if frame.Class != tt.frame.Class || frame.Opcode != tt.frame.Opcode ||
+				!bytes.Equal(frame.Payload, tt.frame.Payload) || frame.Checksum != tt.frame.Checksum {
+				t.Errorf("Decode(%s) = %+v, want %+v", tt.hex, frame, tt.frame)
+			}
+
+			encoded, err := frame.Encode()
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(encoded, data) {
+				t.Errorf("Encode(Decode(%s)) = %x", tt.hex, encoded)
+			}
+			if got := tt.frame.String(); got != tt.hex {
+				t.Errorf("built frame = %s, want %s", got, tt.hex)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want error
+	}{
+		{"too short", "efa000fe", ErrFrameTooShort},
+		{"no start byte", "00a0140000fe", ErrFrameStart},
+		{"no end byte", "efa014000000", ErrFrameEnd},
+		{"length too long", "efa0140100fe", ErrFrameLength},
+		{"length too short", "efa014005f60fe", ErrFrameLength},
+		{"unknown class", "efc0140000fe", ErrUnknownClass},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeHex(tt.hex); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeHex(%s) error = %v, want %v", tt.hex, err, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, tt := range documentedFrames {
+		data, _ := hex.DecodeString(tt.hex)
+		f.Add(data)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{FrameStart, ClassWrite, OpLight, 0xff, FrameEnd})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, err := Decode(data)
+		if err != nil {
+			return
+		}
+		encoded, err := frame.Encode()
+		if err != nil {
+			t.Fatalf("Encode() of decoded %x error = %v", data, err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("Encode(Decode(%x)) = %x", data, encoded)
+		}
+	})
+}
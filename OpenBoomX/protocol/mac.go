@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MAC is a Bluetooth device address in the usual order, F8:AB:E5:12:34:56 is {0xf8, 0xab, 0xe5, 0x12, 0x34, 0x56}.
+type MAC [6]byte
+
+// ParseMAC parses an address like F8:AB:E5:12:34:56, '-' is accepted as separator as well.
+func ParseMAC(text string) (MAC, error) {
+	var mac MAC
+	if len(text) != 3*len(mac)-1 || (text[2] != ':' && text[2] != '-') {
+		return mac, fmt.Errorf("invalid MAC address: %s", text)
+	}
+	for i := range mac {
+		if i > 0 && text[3*i-1] != text[2] {
+			return mac, fmt.Errorf("invalid MAC address: %s", text)
+		}
+		value, err := strconv.ParseUint(text[3*i:3*i+2], 16, 8)
+		if err != nil {
+			return mac, fmt.Errorf("invalid MAC address: %s", text)
+		}
+		mac[i] = byte(value)
+	}
+	return mac, nil
+}
+
+// DeviceMAC returns the address of a device given as a MAC address or an rfcomm:// URI, see Dial.
+func DeviceMAC(device string) (MAC, bool) {
+	if target, found := strings.CutPrefix(device, "rfcomm://"); found {
+		device, _, _ = strings.Cut(target, "/")
+	}
+	mac, err := ParseMAC(device)
+	return mac, err == nil
+}
+
+func (mac MAC) String() string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+}
+
+// OUI returns the manufacturer part of the address, like F8:AB:E5.
+func (mac MAC) OUI() string {
+	return mac.String()[:8]
+}
+
+// IsZero reports whether the address is 00:00:00:00:00:00.
+func (mac MAC) IsZero() bool {
+	return mac == MAC{}
+}
+
+// littleEndian returns the bytes in the order of the Linux bdaddr_t.
+func (mac MAC) littleEndian() [6]byte {
+	var b [6]byte
+	for i := range mac {
+		b[len(b)-1-i] = mac[i]
+	}
+	return b
+}
+
+// uint64 returns the address as the Windows BTH_ADDR.
+func (mac MAC) uint64() uint64 {
+	var value uint64
+	for _, b := range mac {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func (mac MAC) MarshalText() ([]byte, error) {
+	return []byte(mac.String()), nil
+}
+
+func (mac *MAC) UnmarshalText(text []byte) (err error) {
+	*mac, err = ParseMAC(string(text))
+	return err
+}
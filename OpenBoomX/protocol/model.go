@@ -0,0 +1,298 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"obx/protocol/eq"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Model is the profile of a speaker model: how it is recognized, what it supports and how its frames are built.
+type Model struct {
+	// Name is the name of the model, like "EarFun UBOOM X", it is kept in the device registry
+	Name string
+	// NamePatterns match the names the speaker advertises, ignoring case, see path.Match
+	NamePatterns []string
+	// OUIs are the manufacturer parts of the speaker's addresses, like F8:AB:E5
+	OUIs         []string
+	Capabilities Capabilities
+	Frames       FrameBuilder
+	// KnownFirmware is the firmware the profile was confirmed with, see IsKnownFirmware and Quirk for other firmware
+	KnownFirmware []FirmwareRange
+}
+
+// clone returns a copy of the model that can be changed without changing the model, see ForFirmware.
+func (model *Model) clone() *Model {
+	changed := *model
+	changed.NamePatterns = slices.Clone(model.NamePatterns)
+	changed.OUIs = slices.Clone(model.OUIs)
+	changed.KnownFirmware = slices.Clone(model.KnownFirmware)
+	if model.Capabilities.EQ != nil {
+		eqCapability := *model.Capabilities.EQ
+		eqCapability.Frequencies = slices.Clone(eqCapability.Frequencies)
+		changed.Capabilities.EQ = &eqCapability
+	}
+	changed.Capabilities.OluvModes = slices.Clone(model.Capabilities.OluvModes)
+	changed.Capabilities.LightModes = slices.Clone(model.Capabilities.LightModes)
+	changed.Capabilities.BeepVolumes = slices.Clone(model.Capabilities.BeepVolumes)
+	changed.Capabilities.ShutdownTimeouts = slices.Clone(model.Capabilities.ShutdownTimeouts)
+	return &changed
+}
+
+// Capabilities are the settings of a model, an empty list of values means the setting isn't supported.
+type Capabilities struct {
+	// EQ is the custom equalizer, nil if the model has none
+	EQ *EQCapability
+	// OluvModes are the Oluv's EQ modes in the order of the app
+	OluvModes        []OluvMode
+	LightModes       []LightMode
+	VideoMode        bool
+	BeepVolumes      []BeepVolume
+	ShutdownTimeouts []ShutdownTimeout
+	PowerOff         bool
+}
+
+// EQCapability is the custom equalizer of a model. The eq package only has curves of eq.BandCount bands,
+// a model with another band count needs its own curves.
+type EQCapability struct {
+	// Frequencies are the centre frequencies of the bands in Hz
+	Frequencies []float64
+	// MinGain and MaxGain are the limits of a band in dB
+	MinGain    float64
+	MaxGain    float64
+	StepsPerDB int
+}
+
+// Bands returns the number of EQ bands.
+func (capability *EQCapability) Bands() int {
+	return len(capability.Frequencies)
+}
+
+// FrameBuilder builds the frames of a model, the replies are parsed by the Parse*Reply functions.
+type FrameBuilder interface {
+	OluvMode(mode OluvMode) Frame
+	CustomEQ(curve eq.Curve) Frame
+	Light(light LightState) Frame
+	ShutdownTimeout(timeout ShutdownTimeout) Frame
+	PowerOff() Frame
+	VideoMode(mode VideoMode) Frame
+	BeepVolume(volume BeepVolume) Frame
+	ReadRequest(opcode byte) Frame
+	BatteryLevelRequest() Frame
+	FirmwarePackageRequest() Frame
+}
+
+// UnsupportedError is returned for settings, or values of a setting, the speaker model doesn't have.
+// It matches errors.ErrUnsupported.
+type UnsupportedError struct {
+	Model   string
+	Setting string
+	// Value is empty if the setting isn't supported at all
+	Value string
+}
+
+func (err *UnsupportedError) Error() string {
+	if err.Value == "" {
+		return fmt.Sprintf("%s doesn't support the %s", err.Model, err.Setting)
+	}
+	return fmt.Sprintf("%s doesn't support the %s %s", err.Model, err.Setting, err.Value)
+}
+
+func (err *UnsupportedError) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// uboomXFrames builds the frames described in protocol.md.
+type uboomXFrames struct{}
+
+func (uboomXFrames) OluvMode(mode OluvMode) Frame {
+	return NewOluvModeFrame(mode)
+}
+
+func (uboomXFrames) CustomEQ(curve eq.Curve) Frame {
+	return NewCustomEQFrame(curve)
+}
+
+func (uboomXFrames) Light(light LightState) Frame {
+	return NewLightFrame(light)
+}
+
+func (uboomXFrames) ShutdownTimeout(timeout ShutdownTimeout) Frame {
+	return NewShutdownTimeoutFrame(timeout)
+}
+
+func (uboomXFrames) PowerOff() Frame {
+	return NewPowerOffFrame()
+}
+
+func (uboomXFrames) VideoMode(mode VideoMode) Frame {
+	return NewVideoModeFrame(mode)
+}
+
+func (uboomXFrames) BeepVolume(volume BeepVolume) Frame {
+	return NewBeepVolumeFrame(volume)
+}
+
+func (uboomXFrames) ReadRequest(opcode byte) Frame {
+	return NewReadRequestFrame(opcode)
+}
+
+func (uboomXFrames) BatteryLevelRequest() Frame {
+	return NewBatteryLevelRequestFrame()
+}
+
+func (uboomXFrames) FirmwarePackageRequest() Frame {
+	return NewFirmwarePackageRequestFrame()
+}
+
+// UBoomX is the EarFun UBoom X, the model OpenBoomX was written for and the default for unknown speakers.
+var UBoomX = &Model{
+	Name:         UBoomXName,
+	NamePatterns: []string{UBoomXName, UBoomXName2},
+	OUIs:         []string{UBoomXOUI, UBoomXOUI2},
+	Capabilities: Capabilities{
+		EQ: &EQCapability{
+			Frequencies: eq.Frequencies[:],
+			MinGain:     eq.MinGain,
+			MaxGain:     eq.MaxGain,
+			StepsPerDB:  eq.StepsPerDB,
+		},
+		OluvModes:        AllOluvModes(),
+		LightModes:       AllLightModes(),
+		VideoMode:        true,
+		BeepVolumes:      AllBeepVolumes(),
+		ShutdownTimeouts: AllShutdownTimeouts(),
+		PowerOff:         true,
+	},
+	Frames: uboomXFrames{},
+	KnownFirmware: []FirmwareRange{
+		// the firmware protocol.md was written with
+		{Platform: "SP500", Versions: VersionRange{Min: Version{Minor: 39}, Max: Version{Minor: 39}}},
+	},
+}
+
+var (
+	modelsMutex sync.RWMutex
+	models      = []*Model{UBoomX}
+)
+
+// RegisterModel adds a model profile, a profile with the same name is replaced.
+// Models with a custom EQ must have eq.BandCount bands.
+func RegisterModel(model *Model) error {
+	if model.Name == "" || model.Frames == nil {
+		return errors.New("a speaker model needs a name and a frame builder")
+	}
+	if model.Capabilities.EQ != nil && model.Capabilities.EQ.Bands() != eq.BandCount {
+		return fmt.Errorf("%s has %d EQ bands, only %d are supported", model.Name, model.Capabilities.EQ.Bands(), eq.BandCount)
+	}
+
+	modelsMutex.Lock()
+	defer modelsMutex.Unlock()
+	i := slices.IndexFunc(models, func(known *Model) bool {
+		return known.Name == model.Name
+	})
+	if i < 0 {
+		models = append(models, model)
+	} else {
+		models[i] = model
+	}
+	return nil
+}
+
+// Models returns the registered model profiles, UBoomX first.
+func Models() []*Model {
+	modelsMutex.RLock()
+	defer modelsMutex.RUnlock()
+	return slices.Clone(models)
+}
+
+// ModelByName returns the profile with the given name, ignoring case.
+func ModelByName(name string) (*Model, bool) {
+	for _, model := range Models() {
+		if strings.EqualFold(model.Name, name) {
+			return model, true
+		}
+	}
+	return nil, false
+}
+
+// MatchModel returns the profile of a speaker advertising name, or if no name pattern matches,
+// the profile with the OUI of address. Either may be empty.
+func MatchModel(name string, address string) (*Model, bool) {
+	all := Models()
+	for _, model := range all {
+		if model.MatchesName(name) {
+			return model, true
+		}
+	}
+	for _, model := range all {
+		if model.MatchesAddress(address) {
+			return model, true
+		}
+	}
+	return nil, false
+}
+
+// MatchesName reports whether a speaker advertising name is this model.
+func (model *Model) MatchesName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, pattern := range model.NamePatterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesAddress reports whether a MAC address starts with one of the model's OUIs.
+func (model *Model) MatchesAddress(address string) bool {
+	mac, err := ParseMAC(address)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(model.OUIs, func(oui string) bool {
+		return strings.EqualFold(oui, mac.OUI())
+	})
+}
+
+// checkSupported returns an UnsupportedError if the model doesn't have the setting or the value, and the error of
+// values that aren't valid for the setting at all.
+func checkSupported[T ~byte](model *Model, setting enum[T], supported []T, value T) error {
+	if len(supported) == 0 {
+		return &UnsupportedError{Model: model.Name, Setting: setting.setting}
+	}
+	if err := setting.check(value); err != nil {
+		return err
+	}
+	if !slices.Contains(supported, value) {
+		return &UnsupportedError{Model: model.Name, Setting: setting.setting, Value: setting.string(value)}
+	}
+	return nil
+}
+
+// videoModes returns on and off if the model has a video mode.
+func (model *Model) videoModes() []VideoMode {
+	if !model.Capabilities.VideoMode {
+		return nil
+	}
+	return videoModes.values
+}
+
+// checkCurve returns an error if the model has no custom EQ or a gain is outside of its range.
+func (model *Model) checkCurve(curve eq.Curve) error {
+	capability := model.Capabilities.EQ
+	if capability == nil {
+		return &UnsupportedError{Model: model.Name, Setting: "custom EQ"}
+	}
+	for _, gain := range curve {
+		if !(gain >= capability.MinGain && gain <= capability.MaxGain) {
+			return fmt.Errorf("EQ band gain must be between %.0f dB and %+.0f dB on %s: %g", capability.MinGain, capability.MaxGain, model.Name, gain)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// NetClient talks to a speaker over a TCP or Unix socket, e.g. the obx-emulator.
+type NetClient struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+}
+
+// NewNetClient connects to address on the given network, "tcp" or "unix".
+func NewNetClient(ctx context.Context, network string, address string) (*NetClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &NetClient{conn: conn}, nil
+}
+
+func (client *NetClient) SendMessage(ctx context.Context, message []byte) error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	return writeContext(ctx, client.conn, message)
+}
+
+// ReceiveMessage must not be called concurrently.
+func (client *NetClient) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	return readContext(ctx, client.conn, bufferSize)
+}
+
+func (client *NetClient) CloseSocket() error {
+	return client.conn.Close()
+}
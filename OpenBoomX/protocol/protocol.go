@@ -1,19 +1,66 @@
 package protocol
 
+import (
+	"encoding/hex"
+	"fmt"
+	"obx/protocol/eq"
+)
+
 const UBoomXName = "EarFun UBOOM X"
 const UBoomXName2 = "EarFun Audio"
 const UBoomXOUI = "F8:AB:E5"
 const UBoomXOUI2 = "C7:AB:E5"
 
-// Oluv's EQ Modes
-var EQModes = map[string]string{
-	"studio":   "efb046010102fe",
-	"indoor":   "efb046010203fe",
-	"indoor+":  "efb046010304fe",
-	"outdoor":  "efb046010405fe",
-	"outdoor+": "efb046010506fe",
-	"boom":     "efb046010607fe",
-	"ground":   "efb046010708fe",
+// Frame classes
+const (
+	ClassWrite byte = 0xb0
+	ClassRead  byte = 0xa0
+)
+
+// Opcodes
+const (
+	OpFirmwarePackage byte = 0x10
+	OpBatteryLevel    byte = 0x14
+	OpPowerOff        byte = 0x25
+	OpVideoMode       byte = 0x35
+	OpCustomEQ        byte = 0x45
+	OpOluvMode        byte = 0x46
+	OpBeepVolume      byte = 0x65
+	OpShutdownTimeout byte = 0x75
+	OpLight           byte = 0x95
+)
+
+var opcodeNames = map[byte]string{
+	OpFirmwarePackage: "firmware package",
+	OpBatteryLevel:    "battery level",
+	OpPowerOff:        "power off",
+	OpVideoMode:       "video mode",
+	OpCustomEQ:        "custom EQ",
+	OpOluvMode:        "Oluv EQ mode",
+	OpBeepVolume:      "beep volume",
+	OpShutdownTimeout: "shutdown timeout",
+	OpLight:           "light",
+}
+
+// OpcodeName returns a readable name for a known opcode, unknown opcodes are returned as hex.
+func OpcodeName(opcode byte) string {
+	name, ok := opcodeNames[opcode]
+	if !ok {
+		return fmt.Sprintf("unknown opcode %02x", opcode)
+	}
+	return name
+}
+
+// ClassName returns "write" or "read" for known frame classes, unknown classes are returned as hex.
+func ClassName(class byte) string {
+	switch class {
+	case ClassWrite:
+		return "write"
+	case ClassRead:
+		return "read"
+	default:
+		return fmt.Sprintf("class %02x", class)
+	}
 }
 
 // Light Actions
@@ -22,51 +69,163 @@ const (
 	LightOff     = "off"
 )
 
-var LightActions = map[string]string{
-	LightDefault: "efb095040000000000fe",
-	LightOff:     "efb095040100000000fe",
+// EQ Band Values, see the eq package for the bands in dB
+const (
+	MaxBandValue = eq.MaxValue // +10 dB is the max
+	MinBandValue = 0           // -10 dB is the min
+	EQBandCount  = eq.BandCount
+)
+
+// RfcommChannel is the channel the speaker served its protocol on so far, it is used if the channel can't be
+// resolved from the speaker's SDP records, see ResolveRfcommChannel.
+const RfcommChannel = 2
+
+func NewOluvModeFrame(mode OluvMode) Frame {
+	return NewFrame(ClassWrite, OpOluvMode, byte(mode))
 }
 
-// Shutdown Timeout Modes
-var ShutdownTimeouts = map[string]string{
-	"5m":   "efb075010102fe",
-	"10m":  "efb075010203fe",
-	"30m":  "efb075010304fe",
-	"60m":  "efb075010405fe",
-	"90m":  "efb075010506fe",
-	"120m": "efb075010607fe",
-	"no":   "efb07501ff00fe",
+// NewCustomEQFrame creates a custom EQ frame, the gains are quantized to the speaker's 1/6 dB steps.
+func NewCustomEQFrame(curve eq.Curve) Frame {
+	payload := append([]byte{0x01}, curve.Bytes()...)
+
+	// the speaker ignores the checksum, the app always sends 00
+	return Frame{Class: ClassWrite, Opcode: OpCustomEQ, Payload: payload}
 }
 
-const SpeakerPowerOff = "efb025010102fe"
+func NewLightFrame(light LightState) Frame {
+	// the speaker ignores the checksum, the app always sends 00
+	return Frame{Class: ClassWrite, Opcode: OpLight, Payload: []byte{byte(light.Mode), light.Color[0], light.Color[1], light.Color[2]}}
+}
 
-const (
-	VideoModeOn  = "on"
-	VideoModeOff = "off"
-)
+func NewShutdownTimeoutFrame(timeout ShutdownTimeout) Frame {
+	return NewFrame(ClassWrite, OpShutdownTimeout, byte(timeout))
+}
 
-var VideoMode = map[string]string{
-	VideoModeOn:  "efb035010102fe",
-	VideoModeOff: "efb035010001fe",
+func NewPowerOffFrame() Frame {
+	return NewFrame(ClassWrite, OpPowerOff, 0x01)
 }
 
-// Beep Volume Levels
-var BeepVolumes = map[int]string{
-	0:   "efb065010102fe",
-	25:  "efb065010203fe",
-	50:  "efb065010304fe",
-	75:  "efb065010405fe",
-	100: "efb065010506fe",
+func NewVideoModeFrame(mode VideoMode) Frame {
+	return NewFrame(ClassWrite, OpVideoMode, byte(mode))
 }
 
-// EQ Band Values
-const (
-	MaxBandValue = 120 // +10 dB is the max
-	MinBandValue = 0   // -10 dB is the min
-)
+func NewBeepVolumeFrame(volume BeepVolume) Frame {
+	return NewFrame(ClassWrite, OpBeepVolume, byte(volume))
+}
 
-const RfcommChannel = 2
+// NewReadRequestFrame asks the speaker for the current value of opcode, e.g. efa0460000fe for the Oluv mode.
+// Only the battery and firmware reads are confirmed with a real speaker, the other settings are assumed to be
+// answered like the battery read, with a reply carrying the same payload as the write.
+func NewReadRequestFrame(opcode byte) Frame {
+	return NewFrame(ClassRead, opcode)
+}
 
-const BatteryLevelRequest = "efa0140000fe"
+func NewBatteryLevelRequestFrame() Frame {
+	return NewReadRequestFrame(OpBatteryLevel)
+}
 
-const FirmwarePackageRequest = "efa0100000fe"
+func NewFirmwarePackageRequestFrame() Frame {
+	return NewReadRequestFrame(OpFirmwarePackage)
+}
+
+// ParseBatteryLevelReply returns the battery level in percent from a battery reply, e.g. efa014015f60fe
+func ParseBatteryLevelReply(frame Frame) (int, error) {
+	if !frame.Is(ClassRead, OpBatteryLevel) || len(frame.Payload) != 1 {
+		return 0, fmt.Errorf("%w: %s", ErrUnexpectedReply, frame)
+	}
+	return int(frame.Payload[0]), nil
+}
+
+// ParseFirmwarePackageReply returns the firmware package name from a firmware reply, e.g. SP500_20240912_v0.39_ota.bin
+func ParseFirmwarePackageReply(frame Frame) (string, error) {
+	if !frame.Is(ClassRead, OpFirmwarePackage) || len(frame.Payload) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnexpectedReply, frame)
+	}
+	return string(frame.Payload), nil
+}
+
+// LightState is the light mode and color, a solid black light is off.
+type LightState struct {
+	Mode  LightMode `json:"mode"`
+	Color [3]byte   `json:"color"`
+}
+
+// ParseLightAction returns the light of a CLI light action: LightDefault, LightOff or an RGB hex color,
+// which is solid or dancing.
+func ParseLightAction(action string, solid bool) (LightState, error) {
+	switch action {
+	case LightDefault:
+		return LightState{Mode: LightModeDefault}, nil
+	case LightOff:
+		return LightState{Mode: LightModeSolid}, nil
+	}
+
+	rgb, err := hex.DecodeString(action)
+	if err != nil || len(rgb) != 3 {
+		return LightState{}, fmt.Errorf("invalid light action or RGB value: %s", action)
+	}
+
+	mode := LightModeDancing
+	if solid {
+		mode = LightModeSolid
+	}
+	return LightState{Mode: mode, Color: [3]byte(rgb)}, nil
+}
+
+// singleByteReply returns the payload of a one byte read reply.
+func singleByteReply(frame Frame, opcode byte) (byte, error) {
+	if !frame.Is(ClassRead, opcode) || len(frame.Payload) != 1 {
+		return 0, fmt.Errorf("%w: %s", ErrUnexpectedReply, frame)
+	}
+	return frame.Payload[0], nil
+}
+
+// parseEnumReply returns the setting value of a one byte read reply.
+func parseEnumReply[T ~byte](frame Frame, opcode byte, values enum[T]) (T, error) {
+	value, err := singleByteReply(frame, opcode)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := values.name(T(value)); !ok {
+		return 0, fmt.Errorf("%w: unknown %s %02x", ErrUnexpectedReply, OpcodeName(opcode), value)
+	}
+	return T(value), nil
+}
+
+// ParseOluvModeReply returns the Oluv's EQ mode from a reply like efa046010102fe.
+func ParseOluvModeReply(frame Frame) (OluvMode, error) {
+	return parseEnumReply(frame, OpOluvMode, oluvModes)
+}
+
+// ParseCustomEQReply returns the curve of a custom EQ reply, laid out like the write: 01 followed by the bands.
+// active is false if the first byte is 00, which means an Oluv's EQ mode is used instead of the custom EQ.
+func ParseCustomEQReply(frame Frame) (curve eq.Curve, active bool, err error) {
+	if !frame.Is(ClassRead, OpCustomEQ) || len(frame.Payload) != 1+EQBandCount || frame.Payload[0] > 0x01 {
+		return curve, false, fmt.Errorf("%w: %s", ErrUnexpectedReply, frame)
+	}
+	curve, err = eq.FromBytes(frame.Payload[1:])
+	return curve, frame.Payload[0] == 0x01, err
+}
+
+// ParseLightReply returns the light mode and color from a reply like efa0950402ffffff03fe.
+func ParseLightReply(frame Frame) (LightState, error) {
+	if !frame.Is(ClassRead, OpLight) || len(frame.Payload) != 4 || lightModes.check(LightMode(frame.Payload[0])) != nil {
+		return LightState{}, fmt.Errorf("%w: %s", ErrUnexpectedReply, frame)
+	}
+	return LightState{Mode: LightMode(frame.Payload[0]), Color: [3]byte(frame.Payload[1:])}, nil
+}
+
+// ParseBeepVolumeReply returns the beep volume from a reply like efa065010304fe.
+func ParseBeepVolumeReply(frame Frame) (BeepVolume, error) {
+	return parseEnumReply(frame, OpBeepVolume, beepVolumes)
+}
+
+// ParseVideoModeReply returns VideoModeOn or VideoModeOff from a reply like efa035010102fe.
+func ParseVideoModeReply(frame Frame) (VideoMode, error) {
+	return parseEnumReply(frame, OpVideoMode, videoModes)
+}
+
+// ParseShutdownTimeoutReply returns the shutdown timeout from a reply like efa075010304fe.
+func ParseShutdownTimeoutReply(frame Frame) (ShutdownTimeout, error) {
+	return parseEnumReply(frame, OpShutdownTimeout, shutdownTimeouts)
+}
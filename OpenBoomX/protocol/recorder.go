@@ -0,0 +1,131 @@
+package protocol
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Direction string
+
+const (
+	DirectionTX Direction = "tx"
+	DirectionRX Direction = "rx"
+)
+
+// SessionEntry is one line of a JSONL session file.
+type SessionEntry struct {
+	// Elapsed is the time since the session started, measured with the monotonic clock
+	Elapsed     time.Duration `json:"elapsed"`
+	Direction   Direction     `json:"dir"`
+	Hex         string        `json:"hex"`
+	Description string        `json:"desc,omitempty"`
+	// Error is set if sending a TX entry failed, the speaker may not have received it
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder is an RfcommClient decorator that writes every sent and received frame to a JSONL session.
+// Received bytes are split into frames first, so a frame is recorded once no matter how it was read.
+// A sent frame is recorded once the send is done, with its error if it failed.
+type Recorder struct {
+	rfcomm  RfcommClient
+	output  io.WriteCloser
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	start   time.Time
+	rx      FrameBuffer
+}
+
+func NewRecorder(rfcomm RfcommClient, output io.WriteCloser) *Recorder {
+	return &Recorder{
+		rfcomm:  rfcomm,
+		output:  output,
+		encoder: json.NewEncoder(output),
+		start:   time.Now(),
+	}
+}
+
+// NewSessionRecorder records to a session file at path, an existing file is appended to.
+func NewSessionRecorder(rfcomm RfcommClient, path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening session file: %w", err)
+	}
+	return NewRecorder(rfcomm, file), nil
+}
+
+// record must be called with the mutex held.
+func (r *Recorder) record(direction Direction, data []byte, description string, sendErr error) {
+	entry := SessionEntry{
+		Elapsed:     time.Since(r.start),
+		Direction:   direction,
+		Hex:         hex.EncodeToString(data),
+		Description: description,
+	}
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+	}
+	if err := r.encoder.Encode(entry); err != nil {
+		log.Printf("Error recording session entry: %v", err)
+	}
+}
+
+func (r *Recorder) SendMessage(ctx context.Context, message []byte) error {
+	// the mutex is held during the send, so a reply isn't recorded before the frame it answers
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sendErr := r.rfcomm.SendMessage(ctx, message)
+	frame, err := Decode(message)
+	if err != nil {
+		r.record(DirectionTX, message, fmt.Sprintf("invalid frame: %v", err), sendErr)
+	} else {
+		r.record(DirectionTX, message, Describe(frame), sendErr)
+	}
+	return sendErr
+}
+
+func (r *Recorder) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	buf, n, err := r.rfcomm.ReceiveMessage(ctx, bufferSize)
+	if errors.Is(err, ErrReconnected) {
+		r.mutex.Lock()
+		r.rx.Reset()
+		r.mutex.Unlock()
+	}
+	if n <= 0 {
+		return buf, n, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rx.Write(buf[:n])
+	for {
+		frame, frameErr := r.rx.Next()
+		if errors.Is(frameErr, ErrIncompleteFrame) {
+			break
+		}
+		var garbage *GarbageError
+		if errors.As(frameErr, &garbage) {
+			r.record(DirectionRX, garbage.Data, "garbage", nil)
+			continue
+		}
+		r.record(DirectionRX, frame.encode(), Describe(frame), nil)
+	}
+	return buf, n, err
+}
+
+func (r *Recorder) CloseSocket() error {
+	err := r.rfcomm.CloseSocket()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return errors.Join(err, r.output.Close())
+}
@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error {
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request := NewBatteryLevelRequestFrame()
+	reply := mustEncode(t, NewFrame(ClassRead, OpBatteryLevel, 95))
+	write := NewFrame(ClassWrite, OpOluvMode, byte(OluvBoom))
+	errSend := errors.New("send failed")
+
+	conn := newFakeConn()
+	conn.onSend = func(message []byte) error {
+		if bytes.Equal(message, mustEncode(t, write)) {
+			return errSend
+		}
+		// the reply is read before the send returns
+		conn.rx <- reply
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	output := &bufferCloser{}
+	recorder := NewRecorder(conn, output)
+	received := make(chan error, 1)
+	go func() {
+		_, _, err := recorder.ReceiveMessage(ctx, MaxFrameSize)
+		received <- err
+	}()
+
+	if err := recorder.SendMessage(ctx, mustEncode(t, request)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-received; err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.SendMessage(ctx, mustEncode(t, write)); !errors.Is(err, errSend) {
+		t.Fatalf("SendMessage() error = %v, want the send error", err)
+	}
+	if err := recorder.CloseSocket(); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []SessionEntry
+	scanner := bufio.NewScanner(&output.Buffer)
+	for scanner.Scan() {
+		var entry SessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	want := []struct {
+		direction Direction
+		error     string
+	}{{DirectionTX, ""}, {DirectionRX, ""}, {DirectionTX, errSend.Error()}}
+	if len(entries) != len(want) {
+		t.Fatalf("recorded %+v, want %d entries", entries, len(want))
+	}
+	for i, entry := range entries {
+		if entry.Direction != want[i].direction || entry.Error != want[i].error {
+			t.Errorf("entry %d = %+v, want %s with error %q", i, entry, want[i].direction, want[i].error)
+		}
+	}
+
+	// the replay fails the send like the recorded session
+	replay, err := NewReplayClient(entries, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.SendMessage(ctx, mustEncode(t, request)); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, err := replay.ReceiveMessage(ctx, MaxFrameSize); err != nil || n != len(reply) {
+		t.Fatalf("replayed reply = %d bytes, %v", n, err)
+	}
+	if err := replay.SendMessage(ctx, mustEncode(t, write)); err == nil {
+		t.Error("the replay of a failed send succeeded")
+	}
+	if err := replay.Verify(); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayMismatchError reports a sent message that doesn't match the recorded session.
+type ReplayMismatchError struct {
+	// Entry is the index of the recorded TX entry that was expected, -1 if the session had no TX entries left
+	Entry    int
+	Expected SessionEntry
+	Actual   []byte
+}
+
+func (e *ReplayMismatchError) Error() string {
+	actual := hex.EncodeToString(e.Actual)
+	if frame, err := Decode(e.Actual); err == nil {
+		actual += " (" + Describe(frame) + ")"
+	}
+	if e.Entry < 0 {
+		return fmt.Sprintf("replay mismatch: sent %s after the end of the recorded session", actual)
+	}
+
+	expected := e.Expected.Hex
+	if e.Expected.Description != "" {
+		expected += " (" + e.Expected.Description + ")"
+	}
+	return fmt.Sprintf("replay mismatch at entry %d: expected %s, sent %s", e.Entry, expected, actual)
+}
+
+type replayEntry struct {
+	SessionEntry
+	data []byte
+}
+
+// ReplayClient is an RfcommClient that plays back a recorded session.
+// Sent messages must match the recorded TX entries in order, the first mismatch is returned as a *ReplayMismatchError
+// and fails every later call. A TX entry recorded with an error fails with that error once it is sent.
+// A recorded RX entry can be read once all TX entries before it have been sent,
+// delayed by its recorded time after the preceding TX entry divided by the speed.
+type ReplayClient struct {
+	entries   []replayEntry
+	speed     float64
+	start     time.Time
+	mutex     sync.Mutex
+	txNext    int
+	sentAt    []time.Time
+	sent      chan struct{}
+	rxNext    int
+	pending   []byte
+	err       error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReplayClient replays entries, speed scales the recorded timing and 0 replays without any delays.
+func NewReplayClient(entries []SessionEntry, speed float64) (*ReplayClient, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("invalid replay speed %v, must not be negative", speed)
+	}
+
+	replay := &ReplayClient{
+		entries: make([]replayEntry, len(entries)),
+		speed:   speed,
+		start:   time.Now(),
+		sentAt:  make([]time.Time, len(entries)),
+		sent:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	for i, entry := range entries {
+		if entry.Direction != DirectionTX && entry.Direction != DirectionRX {
+			return nil, fmt.Errorf("session entry %d has an invalid direction %q", i, entry.Direction)
+		}
+		data, err := hex.DecodeString(entry.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("session entry %d has invalid hex: %w", i, err)
+		}
+		replay.entries[i] = replayEntry{SessionEntry: entry, data: data}
+	}
+	replay.txNext = replay.nextEntry(0, DirectionTX)
+	replay.rxNext = replay.nextEntry(0, DirectionRX)
+	return replay, nil
+}
+
+// ReadSession reads all entries of a JSONL session file.
+func ReadSession(path string) ([]SessionEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening session file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []SessionEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry SessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error parsing session file line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading session file: %w", err)
+	}
+	return entries, nil
+}
+
+// NewSessionReplay replays the session file at path.
+func NewSessionReplay(path string, speed float64) (*ReplayClient, error) {
+	entries, err := ReadSession(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayClient(entries, speed)
+}
+
+// dialReplay opens "path" or "path?speed=2" as a replay.
+func dialReplay(ctx context.Context, target string) (RfcommClient, error) {
+	path, rawQuery, _ := strings.Cut(target, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay options %q: %w", rawQuery, err)
+	}
+
+	speed := 1.0
+	if value := query.Get("speed"); value != "" {
+		speed, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replay speed %q: %w", value, err)
+		}
+	}
+
+	replay, err := NewSessionReplay(path, speed)
+	if err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+// nextEntry returns the index of the first entry from i on with the given direction, or len(entries).
+func (r *ReplayClient) nextEntry(i int, direction Direction) int {
+	for i < len(r.entries) && r.entries[i].Direction != direction {
+		i++
+	}
+	return i
+}
+
+// Verify returns the first mismatch, or an error if recorded TX entries weren't sent yet.
+func (r *ReplayClient) Verify() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.txNext < len(r.entries) {
+		entry := r.entries[r.txNext]
+		return fmt.Errorf("replay incomplete: entry %d (%s %s) was never sent", r.txNext, entry.Hex, entry.Description)
+	}
+	return nil
+}
+
+func (r *ReplayClient) SendMessage(ctx context.Context, message []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-r.closed:
+		return ErrConnectionClosed
+	default:
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.txNext == len(r.entries) {
+		r.err = &ReplayMismatchError{Entry: -1, Actual: append([]byte(nil), message...)}
+		return r.err
+	}
+
+	entry := r.entries[r.txNext]
+	if !bytes.Equal(entry.data, message) {
+		r.err = &ReplayMismatchError{Entry: r.txNext, Expected: entry.SessionEntry, Actual: append([]byte(nil), message...)}
+		return r.err
+	}
+
+	r.sentAt[r.txNext] = time.Now()
+	r.txNext = r.nextEntry(r.txNext+1, DirectionTX)
+	close(r.sent)
+	r.sent = make(chan struct{})
+	if entry.Error != "" {
+		return fmt.Errorf("recorded send error: %s", entry.Error)
+	}
+	return nil
+}
+
+// releaseTime returns when RX entry i can be read, ok is false while TX entries before it are unsent.
+// It must be called with the mutex held.
+func (r *ReplayClient) releaseTime(i int) (time.Time, bool) {
+	if r.txNext < i {
+		return time.Time{}, false
+	}
+
+	anchor, anchorElapsed := r.start, time.Duration(0)
+	for j := i - 1; j >= 0; j-- {
+		if r.entries[j].Direction == DirectionTX {
+			anchor, anchorElapsed = r.sentAt[j], r.entries[j].Elapsed
+			break
+		}
+	}
+	if r.speed == 0 {
+		return anchor, true
+	}
+	delay := time.Duration(float64(r.entries[i].Elapsed-anchorElapsed) / r.speed)
+	return anchor.Add(max(delay, 0)), true
+}
+
+// ReceiveMessage blocks until the next recorded RX entry is due.
+// Once the session has no RX entries left it blocks until the client is closed or ctx is done, so the connection
+// stays open for the TX entries after the last reply; use Verify to check that the whole session was sent.
+// It must not be called concurrently.
+func (r *ReplayClient) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	for len(r.pending) == 0 {
+		r.mutex.Lock()
+		err, i, sent := r.err, r.rxNext, r.sent
+		var at time.Time
+		var released bool
+		if i < len(r.entries) {
+			at, released = r.releaseTime(i)
+		}
+		r.mutex.Unlock()
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if released {
+			delay := time.Until(at)
+			if delay <= 0 {
+				r.mutex.Lock()
+				r.pending = r.entries[i].data
+				r.rxNext = r.nextEntry(i+1, DirectionRX)
+				r.mutex.Unlock()
+				break
+			}
+			timer = time.NewTimer(delay)
+			due = timer.C
+		}
+
+		err = nil
+		select {
+		case <-due:
+		case <-sent:
+		case <-r.closed:
+			err = ErrConnectionClosed
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	buf := make([]byte, bufferSize)
+	n := copy(buf, r.pending)
+	r.pending = r.pending[n:]
+	return buf, n, nil
+}
+
+func (r *ReplayClient) CloseSocket() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+	return nil
+}
@@ -0,0 +1,108 @@
+package protocol_test
+
+import (
+	"context"
+	"errors"
+	"obx/protocol"
+	"obx/protocol/eq"
+	"testing"
+)
+
+// newReplayClient returns a client of the session fixture at path, replayed without delays.
+func newReplayClient(t *testing.T, path string) (*protocol.ReplayClient, *protocol.SpeakerClient) {
+	t.Helper()
+	replay, err := protocol.NewSessionReplay(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := protocol.NewSpeakerClient(replay, nil)
+	t.Cleanup(func() { _ = client.CloseConnection() })
+	return replay, client
+}
+
+func TestSpeakerClientReplay(t *testing.T) {
+	curve, err := eq.NewCurve(-10, -5, 0, 1.5, 10, 0, 0, 0, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		run  func(ctx context.Context, client *protocol.SpeakerClient) error
+	}{
+		{
+			path: "testdata/read_status.jsonl",
+			run: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				if battery, err := c.ReadBatteryLevel(ctx); err != nil || battery != 95 {
+					return errors.Join(err, errors.New("battery level is not 95"))
+				}
+				if firmware, err := c.ReadFirmwarePackageName(ctx); err != nil || firmware != "SP500_20240912_v0.39_ota.bin" {
+					return errors.Join(err, errors.New("unexpected firmware "+firmware))
+				}
+				if mode, err := c.ReadOluvMode(ctx); err != nil || mode != protocol.OluvStudio {
+					return errors.Join(err, errors.New("Oluv mode is not studio"))
+				}
+				return nil
+			},
+		},
+		{
+			// the session ends with writes after the last reply
+			path: "testdata/settings.jsonl",
+			run: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				if err := c.SetOluvMode(ctx, protocol.OluvOutdoorPlus); err != nil {
+					return err
+				}
+				if err := c.SetEQ(ctx, curve); err != nil {
+					return err
+				}
+				if read, active, err := c.ReadCustomEQ(ctx); err != nil || !active || read != curve {
+					return errors.Join(err, errors.New("custom EQ was not read back"))
+				}
+				if err := c.SetLight(ctx, protocol.LightState{Mode: protocol.LightModeDancing, Color: [3]byte{0x12, 0x34, 0x56}}); err != nil {
+					return err
+				}
+				return c.SetShutdownTimeout(ctx, protocol.ShutdownNever)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			replay, client := newReplayClient(t, tt.path)
+			if err := tt.run(testContext(t), client); err != nil {
+				t.Fatal(err)
+			}
+			if err := replay.Verify(); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+			if state := client.State().State().Connection; state != protocol.StateConnected {
+				t.Errorf("connection state = %s after the session, want connected", state)
+			}
+		})
+	}
+}
+
+func TestSpeakerClientReplayMismatch(t *testing.T) {
+	ctx := testContext(t)
+	replay, client := newReplayClient(t, "testdata/settings.jsonl")
+
+	err := client.SetOluvMode(ctx, protocol.OluvBoom)
+	var mismatch *protocol.ReplayMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Entry != 0 {
+		t.Fatalf("SetOluvMode() error = %v, want a mismatch at entry 0", err)
+	}
+	if err := replay.Verify(); !errors.As(err, &mismatch) {
+		t.Errorf("Verify() = %v, want the mismatch", err)
+	}
+}
+
+func TestSpeakerClientReplayIncomplete(t *testing.T) {
+	ctx := testContext(t)
+	replay, client := newReplayClient(t, "testdata/read_status.jsonl")
+
+	if _, err := client.ReadBatteryLevel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.Verify(); err == nil {
+		t.Error("Verify() = nil, the firmware and Oluv mode requests were never sent")
+	}
+}
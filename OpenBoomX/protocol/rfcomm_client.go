@@ -1,7 +1,26 @@
 package protocol
 
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// RfcommClient is a byte stream to the speaker.
+// Cancelling the context passed to SendMessage or ReceiveMessage unblocks the call.
 type RfcommClient interface {
-	SendMessage(hexMsg string) error
-	ReceiveMessage(bufferSize int) ([]byte, int, error)
+	SendMessage(ctx context.Context, message []byte) error
+	ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error)
 	CloseSocket() error
 }
+
+// contextError prefers the context error over the error of an I/O call that was interrupted by the context.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
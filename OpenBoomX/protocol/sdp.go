@@ -0,0 +1,205 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// UUID is a Bluetooth service class or protocol UUID in its 128 bit form.
+type UUID [16]byte
+
+// bluetoothBaseUUID is 00000000-0000-1000-8000-00805F9B34FB, the short UUIDs replace its first 4 bytes.
+var bluetoothBaseUUID = UUID{0, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0x80, 0x5f, 0x9b, 0x34, 0xfb}
+
+// UUID16 returns the 128 bit form of a short UUID.
+func UUID16(short uint16) UUID {
+	uuid := bluetoothBaseUUID
+	binary.BigEndian.PutUint16(uuid[2:], short)
+	return uuid
+}
+
+func (uuid UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+var (
+	// SerialPortService is the Serial Port Profile service class the speaker serves its protocol on.
+	SerialPortService = UUID16(0x1101)
+	rfcommProtocol    = UUID16(0x0003)
+)
+
+// ErrNoRfcommChannel is returned if the SDP records of a device have no RFCOMM channel for the service.
+var ErrNoRfcommChannel = errors.New("no RFCOMM channel in the SDP records")
+
+const (
+	sdpErrorResponse                   = 0x01
+	sdpServiceSearchAttributeRequest   = 0x06
+	sdpServiceSearchAttributeResponse  = 0x07
+	sdpProtocolDescriptorListAttribute = 0x0004
+	// sdpPSM is the L2CAP channel SDP servers listen on
+	sdpPSM = 1
+	// sdpMaxAttributeBytes limits a single response, longer attribute lists come in several responses
+	sdpMaxAttributeBytes = 0x0400
+)
+
+// Data element types, see the Bluetooth Core Specification Vol 3, Part B, 3.2
+const (
+	sdpTypeNil      = 0
+	sdpTypeUint     = 1
+	sdpTypeUUID     = 3
+	sdpTypeSequence = 6
+)
+
+// sdpElement is a decoded SDP data element, a sequence has its elements in children.
+type sdpElement struct {
+	kind     byte
+	value    []byte
+	children []sdpElement
+}
+
+// newSDPRequest encodes a ServiceSearchAttributeRequest for the protocol descriptor list of service.
+func newSDPRequest(transaction uint16, service UUID, continuation []byte) []byte {
+	parameters := []byte{0x35, 0x11, 0x1c}
+	parameters = append(parameters, service[:]...)
+	parameters = binary.BigEndian.AppendUint16(parameters, sdpMaxAttributeBytes)
+	parameters = append(parameters, 0x35, 0x03, 0x09)
+	parameters = binary.BigEndian.AppendUint16(parameters, sdpProtocolDescriptorListAttribute)
+	parameters = append(parameters, byte(len(continuation)))
+	parameters = append(parameters, continuation...)
+
+	pdu := []byte{sdpServiceSearchAttributeRequest}
+	pdu = binary.BigEndian.AppendUint16(pdu, transaction)
+	pdu = binary.BigEndian.AppendUint16(pdu, uint16(len(parameters)))
+	return append(pdu, parameters...)
+}
+
+// parseSDPResponse returns the attribute list bytes of a ServiceSearchAttributeResponse and its continuation state,
+// which is empty in the last response.
+func parseSDPResponse(transaction uint16, pdu []byte) (attributes []byte, continuation []byte, err error) {
+	if len(pdu) < 5 {
+		return nil, nil, fmt.Errorf("SDP response too short: %x", pdu)
+	}
+	if got := binary.BigEndian.Uint16(pdu[1:3]); got != transaction {
+		return nil, nil, fmt.Errorf("SDP response for transaction %d, expected %d", got, transaction)
+	}
+	parameters := pdu[5:]
+	if int(binary.BigEndian.Uint16(pdu[3:5])) != len(parameters) {
+		return nil, nil, fmt.Errorf("SDP response length mismatch: %x", pdu)
+	}
+
+	switch pdu[0] {
+	case sdpErrorResponse:
+		if len(parameters) < 2 {
+			return nil, nil, fmt.Errorf("SDP error response too short: %x", pdu)
+		}
+		return nil, nil, fmt.Errorf("SDP error %04x", binary.BigEndian.Uint16(parameters))
+	case sdpServiceSearchAttributeResponse:
+	default:
+		return nil, nil, fmt.Errorf("unexpected SDP response %02x", pdu[0])
+	}
+
+	if len(parameters) < 3 {
+		return nil, nil, fmt.Errorf("SDP response too short: %x", pdu)
+	}
+	count := int(binary.BigEndian.Uint16(parameters))
+	if len(parameters) < 2+count+1 {
+		return nil, nil, fmt.Errorf("SDP attribute list truncated: %x", pdu)
+	}
+	attributes = parameters[2 : 2+count]
+	continuationLength := int(parameters[2+count])
+	continuation = parameters[2+count+1:]
+	if len(continuation) != continuationLength {
+		return nil, nil, fmt.Errorf("SDP continuation state truncated: %x", pdu)
+	}
+	return attributes, continuation, nil
+}
+
+// decodeSDPElement decodes the data element at the start of data and returns the bytes after it.
+func decodeSDPElement(data []byte) (sdpElement, []byte, error) {
+	if len(data) == 0 {
+		return sdpElement{}, nil, errors.New("SDP data element missing")
+	}
+	element := sdpElement{kind: data[0] >> 3}
+	sizeIndex := data[0] & 0x07
+	data = data[1:]
+
+	var size int
+	switch {
+	case element.kind == sdpTypeNil:
+		size = 0
+	case sizeIndex <= 4:
+		size = 1 << sizeIndex
+	default:
+		lengthBytes := 1 << (sizeIndex - 5)
+		if len(data) < lengthBytes {
+			return sdpElement{}, nil, errors.New("SDP data element length truncated")
+		}
+		for _, b := range data[:lengthBytes] {
+			size = size<<8 | int(b)
+		}
+		data = data[lengthBytes:]
+	}
+	if len(data) < size {
+		return sdpElement{}, nil, fmt.Errorf("SDP data element of %d bytes truncated", size)
+	}
+	element.value = data[:size]
+
+	if element.kind == sdpTypeSequence {
+		for rest := element.value; len(rest) > 0; {
+			child, next, err := decodeSDPElement(rest)
+			if err != nil {
+				return sdpElement{}, nil, err
+			}
+			element.children = append(element.children, child)
+			rest = next
+		}
+	}
+	return element, data[size:], nil
+}
+
+func (element sdpElement) uuid() (UUID, bool) {
+	if element.kind != sdpTypeUUID {
+		return UUID{}, false
+	}
+	switch len(element.value) {
+	case 2:
+		return UUID16(binary.BigEndian.Uint16(element.value)), true
+	case 4:
+		uuid := bluetoothBaseUUID
+		copy(uuid[:4], element.value)
+		return uuid, true
+	case 16:
+		return UUID(element.value), true
+	}
+	return UUID{}, false
+}
+
+// rfcommChannelOf returns the RFCOMM channel in the attribute lists of a ServiceSearchAttributeResponse,
+// which has an attribute ID and value pair for every matching service record.
+func rfcommChannelOf(attributeLists []byte) (uint8, error) {
+	lists, _, err := decodeSDPElement(attributeLists)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range lists.children {
+		for i := 0; i+1 < len(record.children); i += 2 {
+			id := record.children[i]
+			if id.kind != sdpTypeUint || len(id.value) != 2 || binary.BigEndian.Uint16(id.value) != sdpProtocolDescriptorListAttribute {
+				continue
+			}
+			// {{L2CAP}, {RFCOMM, channel}}
+			for _, descriptor := range record.children[i+1].children {
+				if len(descriptor.children) < 2 {
+					continue
+				}
+				uuid, ok := descriptor.children[0].uuid()
+				parameter := descriptor.children[1]
+				if ok && uuid == rfcommProtocol && parameter.kind == sdpTypeUint && len(parameter.value) == 1 {
+					return parameter.value[0], nil
+				}
+			}
+		}
+	}
+	return 0, ErrNoRfcommChannel
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+// sdpMaxResponses bounds the continuation requests of a single query
+const sdpMaxResponses = 16
+
+// ResolveRfcommChannel asks the SDP server of the device for the RFCOMM channel of service, e.g. SerialPortService.
+func ResolveRfcommChannel(ctx context.Context, address MAC, service UUID) (uint8, error) {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_SEQPACKET, unix.BTPROTO_L2CAP)
+	if err != nil {
+		return 0, fmt.Errorf("error opening SDP socket: %w", err)
+	}
+	file, err := connectContext(ctx, fd, &unix.SockaddrL2{PSM: sdpPSM, Addr: address}, "sdp:"+address.String())
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to SDP server of %s: %w", address, err)
+	}
+	defer file.Close()
+
+	var attributes, continuation []byte
+	for transaction := uint16(1); transaction <= sdpMaxResponses; transaction++ {
+		if err := writeContext(ctx, file, newSDPRequest(transaction, service, continuation)); err != nil {
+			return 0, fmt.Errorf("error sending SDP request: %w", err)
+		}
+		// a response holds at most sdpMaxAttributeBytes of attributes plus its header and continuation state
+		response, n, err := readContext(ctx, file, sdpMaxAttributeBytes+64)
+		if err != nil {
+			return 0, fmt.Errorf("error reading SDP response: %w", err)
+		}
+		var part []byte
+		part, continuation, err = parseSDPResponse(transaction, response[:n])
+		if err != nil {
+			return 0, err
+		}
+		attributes = append(attributes, part...)
+		if len(continuation) == 0 {
+			return rfcommChannelOf(attributes)
+		}
+	}
+	return 0, fmt.Errorf("SDP response of %s longer than %d parts", address, sdpMaxResponses)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package protocol
+
+import (
+	"context"
+	"errors"
+)
+
+// ResolveRfcommChannel asks the SDP server of the device for the RFCOMM channel of service, which is only implemented on Linux.
+func ResolveRfcommChannel(ctx context.Context, address MAC, service UUID) (uint8, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -2,182 +2,298 @@ package protocol
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"obx/utils"
-	"strconv"
-	"strings"
-	"time"
+	"obx/protocol/eq"
+	"sync"
 )
 
 type ISpeakerClient interface {
-	SetCustomEQ(bands string) error
-	SetOluvMode(mode string) error
-	HandleLightAction(action string, solid bool) error
-	SetShutdownTimeout(timeout string) error
-	PowerOffSpeaker() error
-	SetVideoMode(mode string) error
-	SetBeepVolume(volume int) error
-	SendMessage(hexMsg string) error
+	SetEQ(ctx context.Context, curve eq.Curve) error
+	SetOluvMode(ctx context.Context, mode OluvMode) error
+	SetLight(ctx context.Context, light LightState) error
+	SetShutdownTimeout(ctx context.Context, timeout ShutdownTimeout) error
+	PowerOffSpeaker(ctx context.Context) error
+	SetVideoMode(ctx context.Context, mode VideoMode) error
+	SetBeepVolume(ctx context.Context, volume BeepVolume) error
+	SendMessage(ctx context.Context, hexMsg string) error
+	SendFrame(ctx context.Context, frame Frame) error
 	CloseConnection() error
-	ReceiveMessage(bufferSize int) ([]byte, int, error)
-	ReadBatteryLevel() (int, error)
-	ReadFirmwarePackageName() (string, error)
+	ReadBatteryLevel(ctx context.Context) (int, error)
+	ReadFirmwarePackageName(ctx context.Context) (string, error)
+	ReadOluvMode(ctx context.Context) (OluvMode, error)
+	ReadCustomEQ(ctx context.Context) (curve eq.Curve, active bool, err error)
+	ReadLight(ctx context.Context) (LightState, error)
+	ReadBeepVolume(ctx context.Context) (BeepVolume, error)
+	ReadVideoMode(ctx context.Context) (VideoMode, error)
+	ReadShutdownTimeout(ctx context.Context) (ShutdownTimeout, error)
+	State() *StateTracker
+	Subscribe(filter EventFilter) (<-chan Event, func())
+	Model() *Model
 }
 
 type SpeakerClient struct {
 	rfcomm RfcommClient
+	mux    *frameMux
+	state  *StateTracker
+	model  *Model
+
+	modelMutex sync.Mutex
+	// firmwareModel is model with the quirks of firmware, see Model
+	firmwareModel *Model
+	firmware      string
+}
+
+// connectionNotifier is implemented by connections that report their state, like the Supervisor.
+type connectionNotifier interface {
+	Subscribe() (<-chan ConnectionState, func())
 }
 
-func NewSpeakerClient(rfcomm RfcommClient) *SpeakerClient {
+// NewSpeakerClient takes ownership of reading from rfcomm, replies are read by a single background goroutine.
+// Settings the model doesn't support fail with an UnsupportedError, a nil model is the UBoomX.
+func NewSpeakerClient(rfcomm RfcommClient, model *Model) *SpeakerClient {
+	if model == nil {
+		model = UBoomX
+	}
 	client := &SpeakerClient{}
 	client.rfcomm = rfcomm
+	client.model = model
+	client.state = NewStateTracker()
+	client.state.SetConnection(StateConnected)
+	client.mux = newFrameMux(rfcomm, client.state.ApplyReceived)
+
+	if notifier, ok := rfcomm.(connectionNotifier); ok {
+		go client.followConnection(notifier)
+	}
+	go func() {
+		<-client.mux.done
+		client.state.SetConnection(StateClosed)
+	}()
 	return client
 }
 
-// SetCustomEQ accepts a bands argument that is a comma-separated string of 10 integer values representing each band.
-func (client *SpeakerClient) SetCustomEQ(bands string) error {
-	bandValues := strings.Split(bands, ",")
-	if len(bandValues) != 10 {
-		return fmt.Errorf("invalid number of EQ bands, must be exactly 10 bands")
+func (client *SpeakerClient) followConnection(notifier connectionNotifier) {
+	states, unsubscribe := notifier.Subscribe()
+	defer unsubscribe()
+
+	for state := range states {
+		client.state.SetConnection(state)
 	}
+}
 
-	eqData := ""
-	for i, band := range bandValues {
-		bandValue, err := strconv.Atoi(band)
-		if err != nil {
-			return fmt.Errorf("invalid EQ band value: %s", band)
-		}
+// State returns the tracker of the speaker state, it is updated by every successful command and every reply.
+func (client *SpeakerClient) State() *StateTracker {
+	return client.state
+}
 
-		if bandValue < MinBandValue || bandValue > MaxBandValue {
-			return fmt.Errorf("EQ band value must be between 0 (-10 dB) and 120 (+10 dB)")
-		}
+// Model returns the profile of the speaker, with the quirks of its firmware once the firmware is known,
+// for example after ReadFirmwarePackageName or from the persisted state, see Model.ForFirmware.
+func (client *SpeakerClient) Model() *Model {
+	firmware := client.state.State().Firmware
 
-		eqData = fmt.Sprintf("%s%02x", eqData[:i*2], bandValue)
+	client.modelMutex.Lock()
+	defer client.modelMutex.Unlock()
+	if client.firmwareModel == nil || client.firmware != firmware {
+		// firmware that can't be parsed has no quirks
+		info, _ := ParseFirmware(firmware)
+		client.firmwareModel = client.model.ForFirmware(info)
+		client.firmware = firmware
 	}
-	hexMsg := fmt.Sprintf("efb0450b01%s00fe", eqData)
-	return client.SendMessage(hexMsg)
+	return client.firmwareModel
 }
 
-func (client *SpeakerClient) SetOluvMode(mode string) error {
-	hexMsg, ok := EQModes[mode]
-	if !ok {
-		return fmt.Errorf("invalid Oluv's EQ mode: %s", mode)
+// SetEQ switches to the custom EQ with the given curve.
+func (client *SpeakerClient) SetEQ(ctx context.Context, curve eq.Curve) error {
+	model := client.Model()
+	if err := model.checkCurve(curve); err != nil {
+		return err
 	}
-	return client.SendMessage(hexMsg)
+	return client.SendFrame(ctx, model.Frames.CustomEQ(curve))
 }
 
-func (client *SpeakerClient) HandleLightAction(action string, solid bool) error {
-	hexMsg, ok := LightActions[action]
-	if !ok {
-		if len(action) == 6 && utils.IsValidHex(action) {
-			mode := "02"
-			if solid {
-				mode = "01"
-			}
-			hexMsg = fmt.Sprintf("efb09504%s%s00fe", mode, action)
-		} else {
-			return fmt.Errorf("invalid light action or RGB value: %s", action)
-		}
+func (client *SpeakerClient) SetOluvMode(ctx context.Context, mode OluvMode) error {
+	model := client.Model()
+	if err := checkSupported(model, oluvModes, model.Capabilities.OluvModes, mode); err != nil {
+		return err
+	}
+	return client.SendFrame(ctx, model.Frames.OluvMode(mode))
+}
+
+// SetLight sets the light mode and color, a solid black light turns the light off.
+func (client *SpeakerClient) SetLight(ctx context.Context, light LightState) error {
+	model := client.Model()
+	if err := checkSupported(model, lightModes, model.Capabilities.LightModes, light.Mode); err != nil {
+		return err
+	}
+	return client.SendFrame(ctx, model.Frames.Light(light))
+}
+
+func (client *SpeakerClient) SetShutdownTimeout(ctx context.Context, timeout ShutdownTimeout) error {
+	model := client.Model()
+	if err := checkSupported(model, shutdownTimeouts, model.Capabilities.ShutdownTimeouts, timeout); err != nil {
+		return err
 	}
-	return client.SendMessage(hexMsg)
+	return client.SendFrame(ctx, model.Frames.ShutdownTimeout(timeout))
 }
 
-func (client *SpeakerClient) SetShutdownTimeout(timeout string) error {
-	hexMsg, ok := ShutdownTimeouts[timeout]
-	if !ok {
-		return fmt.Errorf("invalid shutdown timeout: %s", timeout)
+func (client *SpeakerClient) PowerOffSpeaker(ctx context.Context) error {
+	model := client.Model()
+	if !model.Capabilities.PowerOff {
+		return &UnsupportedError{Model: model.Name, Setting: "power off"}
 	}
-	return client.SendMessage(hexMsg)
+	return client.SendFrame(ctx, model.Frames.PowerOff())
 }
 
-func (client *SpeakerClient) PowerOffSpeaker() error {
-	return client.SendMessage(SpeakerPowerOff)
+func (client *SpeakerClient) SetVideoMode(ctx context.Context, mode VideoMode) error {
+	model := client.Model()
+	if err := checkSupported(model, videoModes, model.videoModes(), mode); err != nil {
+		return err
+	}
+	return client.SendFrame(ctx, model.Frames.VideoMode(mode))
 }
 
-func (client *SpeakerClient) SetVideoMode(mode string) error {
-	hexMsg, ok := VideoMode[mode]
-	if !ok {
-		return fmt.Errorf("invalid Video mode: %s", mode)
+func (client *SpeakerClient) SetBeepVolume(ctx context.Context, volume BeepVolume) error {
+	model := client.Model()
+	if err := checkSupported(model, beepVolumes, model.Capabilities.BeepVolumes, volume); err != nil {
+		return err
 	}
-	return client.SendMessage(hexMsg)
+	return client.SendFrame(ctx, model.Frames.BeepVolume(volume))
 }
 
-func (client *SpeakerClient) SetBeepVolume(volume int) error {
-	hexMsg, ok := BeepVolumes[volume]
-	if !ok {
-		return fmt.Errorf("invalid volume level: %d", volume)
+// SendMessage sends a raw hex message, it must be a structurally valid frame.
+func (client *SpeakerClient) SendMessage(ctx context.Context, hexMsg string) error {
+	frame, err := DecodeHex(hexMsg)
+	if err != nil {
+		return fmt.Errorf("invalid message %s: %w", hexMsg, err)
 	}
-	return client.SendMessage(hexMsg)
+	return client.SendFrame(ctx, frame)
 }
 
-func (client *SpeakerClient) SendMessage(hexMsg string) error {
-	return client.rfcomm.SendMessage(hexMsg)
+func (client *SpeakerClient) SendFrame(ctx context.Context, frame Frame) error {
+	message, err := frame.Encode()
+	if err != nil {
+		return err
+	}
+	err = client.rfcomm.SendMessage(ctx, message)
+	if err != nil {
+		return err
+	}
+	client.state.ApplySent(frame)
+	return nil
 }
 
 func (client *SpeakerClient) CloseConnection() error {
+	client.mux.close()
 	return client.rfcomm.CloseSocket()
 }
 
-func (client *SpeakerClient) ReceiveMessage(bufferSize int) ([]byte, int, error) {
-	return client.rfcomm.ReceiveMessage(bufferSize)
+// SubscribeUnsolicited returns a channel of frames the speaker sent without being asked, see Subscribe for decoded events.
+// Call the returned function to unsubscribe.
+func (client *SpeakerClient) SubscribeUnsolicited() (<-chan Frame, func()) {
+	return client.mux.subscribe()
 }
 
-func (client *SpeakerClient) ReadBatteryLevel() (int, error) {
-	err := client.SendMessage(BatteryLevelRequest)
+// request sends a frame and waits for the reply with the given opcode until ctx is done.
+// Concurrent requests for the same opcode are answered in the order they were sent.
+func (client *SpeakerClient) request(ctx context.Context, frame Frame, replyOpcode byte) (Frame, error) {
+	reply, err := client.mux.expect(ClassRead, replyOpcode)
 	if err != nil {
-		return 0, err
+		return Frame{}, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	err = client.SendFrame(ctx, frame)
+	if err != nil {
+		client.mux.cancel(ClassRead, replyOpcode, reply)
+		return Frame{}, err
+	}
 
-	for {
+	select {
+	case frame := <-reply:
+		return frame, nil
+	case <-client.mux.done:
+		// the reply could have arrived right before the connection ended
 		select {
-		case <-ctx.Done():
-			return 0, ctx.Err()
+		case frame := <-reply:
+			return frame, nil
 		default:
-			buf, n, err := client.ReceiveMessage(7)
-			if err != nil {
-				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-					return 0, ctx.Err()
-				}
-				return 0, err
-			}
-
-			if n >= 5 && buf[0] == 0xef && buf[1] == 0xa0 && buf[2] == 0x14 && buf[3] == 0x01 {
-				return int(buf[4]), nil
-			}
+			return Frame{}, client.mux.err
 		}
+	case <-ctx.Done():
+		client.mux.abandon(ClassRead, replyOpcode, reply)
+		return Frame{}, ctx.Err()
+	}
+}
+
+func (client *SpeakerClient) ReadBatteryLevel(ctx context.Context) (int, error) {
+	frame, err := client.request(ctx, client.Model().Frames.BatteryLevelRequest(), OpBatteryLevel)
+	if err != nil {
+		return 0, err
 	}
+	return ParseBatteryLevelReply(frame)
 }
 
-func (client *SpeakerClient) ReadFirmwarePackageName() (string, error) {
-	err := client.SendMessage(FirmwarePackageRequest)
+func (client *SpeakerClient) ReadFirmwarePackageName(ctx context.Context) (string, error) {
+	frame, err := client.request(ctx, client.Model().Frames.FirmwarePackageRequest(), OpFirmwarePackage)
 	if err != nil {
 		return "", err
 	}
+	return ParseFirmwarePackageReply(frame)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// readSetting requests the current value of a setting, see NewReadRequestFrame.
+// A setting the model doesn't support fails without asking the speaker.
+func (client *SpeakerClient) readSetting(ctx context.Context, opcode byte, supported bool) (Frame, error) {
+	model := client.Model()
+	if !supported {
+		return Frame{}, &UnsupportedError{Model: model.Name, Setting: OpcodeName(opcode)}
+	}
+	return client.request(ctx, model.Frames.ReadRequest(opcode), opcode)
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		default:
-			buf, n, err := client.ReceiveMessage(128)
-			if err != nil {
-				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-					return "", ctx.Err()
-				}
-				return "", err
-			}
-
-			if n >= 5 && buf[0] == 0xef && buf[1] == 0xa0 && buf[2] == 0x10 {
-				length := int(buf[3])
-				return string(buf[4 : 4+length]), nil
-			}
-		}
+func (client *SpeakerClient) ReadOluvMode(ctx context.Context) (OluvMode, error) {
+	frame, err := client.readSetting(ctx, OpOluvMode, len(client.Model().Capabilities.OluvModes) > 0)
+	if err != nil {
+		return 0, err
+	}
+	return ParseOluvModeReply(frame)
+}
+
+// ReadCustomEQ returns the custom EQ curve, active is false while an Oluv's EQ mode is used.
+func (client *SpeakerClient) ReadCustomEQ(ctx context.Context) (eq.Curve, bool, error) {
+	frame, err := client.readSetting(ctx, OpCustomEQ, client.Model().Capabilities.EQ != nil)
+	if err != nil {
+		return eq.Curve{}, false, err
+	}
+	return ParseCustomEQReply(frame)
+}
+
+func (client *SpeakerClient) ReadLight(ctx context.Context) (LightState, error) {
+	frame, err := client.readSetting(ctx, OpLight, len(client.Model().Capabilities.LightModes) > 0)
+	if err != nil {
+		return LightState{}, err
+	}
+	return ParseLightReply(frame)
+}
+
+func (client *SpeakerClient) ReadBeepVolume(ctx context.Context) (BeepVolume, error) {
+	frame, err := client.readSetting(ctx, OpBeepVolume, len(client.Model().Capabilities.BeepVolumes) > 0)
+	if err != nil {
+		return 0, err
+	}
+	return ParseBeepVolumeReply(frame)
+}
+
+func (client *SpeakerClient) ReadVideoMode(ctx context.Context) (VideoMode, error) {
+	frame, err := client.readSetting(ctx, OpVideoMode, client.Model().Capabilities.VideoMode)
+	if err != nil {
+		return 0, err
+	}
+	return ParseVideoModeReply(frame)
+}
+
+func (client *SpeakerClient) ReadShutdownTimeout(ctx context.Context) (ShutdownTimeout, error) {
+	frame, err := client.readSetting(ctx, OpShutdownTimeout, len(client.Model().Capabilities.ShutdownTimeouts) > 0)
+	if err != nil {
+		return 0, err
 	}
+	return ParseShutdownTimeoutReply(frame)
 }
@@ -0,0 +1,223 @@
+package protocol_test
+
+import (
+	"context"
+	"errors"
+	"obx/protocol"
+	"obx/protocol/emulator"
+	"obx/protocol/eq"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// newEmulatedClient returns a client of an emulated speaker in the given state.
+func newEmulatedClient(t *testing.T, state emulator.State, model *protocol.Model) (*emulator.Speaker, *protocol.SpeakerClient) {
+	t.Helper()
+	speaker := emulator.NewFromState(state)
+	client := protocol.NewSpeakerClient(speaker, model)
+	t.Cleanup(func() { _ = client.CloseConnection() })
+	return speaker, client
+}
+
+func TestSpeakerClientSettings(t *testing.T) {
+	curve, err := eq.NewCurve(-10, -5, 0, 1.5, 10, 0, 0, 0, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		set   func(ctx context.Context, client *protocol.SpeakerClient) error
+		check func(state emulator.State) bool
+		read  func(ctx context.Context, client *protocol.SpeakerClient) (any, error)
+		want  any
+	}{
+		{
+			name: "Oluv mode",
+			set: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				return c.SetOluvMode(ctx, protocol.OluvOutdoorPlus)
+			},
+			check: func(s emulator.State) bool { return s.OluvMode == 0x05 && s.CustomEQ == nil },
+			read:  func(ctx context.Context, c *protocol.SpeakerClient) (any, error) { return c.ReadOluvMode(ctx) },
+			want:  protocol.OluvOutdoorPlus,
+		},
+		{
+			name:  "custom EQ",
+			set:   func(ctx context.Context, c *protocol.SpeakerClient) error { return c.SetEQ(ctx, curve) },
+			check: func(s emulator.State) bool { return slices.Equal(s.CustomEQ, curve.Bytes()) },
+			read: func(ctx context.Context, c *protocol.SpeakerClient) (any, error) {
+				read, active, err := c.ReadCustomEQ(ctx)
+				if !active {
+					return nil, errors.New("custom EQ is not active")
+				}
+				return read, err
+			},
+			want: curve,
+		},
+		{
+			name: "light",
+			set: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				return c.SetLight(ctx, protocol.LightState{Mode: protocol.LightModeDancing, Color: [3]byte{0x12, 0x34, 0x56}})
+			},
+			check: func(s emulator.State) bool { return s.LightMode == 0x02 && s.LightColor == [3]byte{0x12, 0x34, 0x56} },
+			read:  func(ctx context.Context, c *protocol.SpeakerClient) (any, error) { return c.ReadLight(ctx) },
+			want:  protocol.LightState{Mode: protocol.LightModeDancing, Color: [3]byte{0x12, 0x34, 0x56}},
+		},
+		{
+			name: "beep volume",
+			set: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				return c.SetBeepVolume(ctx, protocol.BeepVolume100)
+			},
+			check: func(s emulator.State) bool { return s.BeepVolume == 0x05 },
+			read:  func(ctx context.Context, c *protocol.SpeakerClient) (any, error) { return c.ReadBeepVolume(ctx) },
+			want:  protocol.BeepVolume100,
+		},
+		{
+			name: "video mode",
+			set: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				return c.SetVideoMode(ctx, protocol.VideoModeOn)
+			},
+			check: func(s emulator.State) bool { return s.VideoMode == 0x01 },
+			read:  func(ctx context.Context, c *protocol.SpeakerClient) (any, error) { return c.ReadVideoMode(ctx) },
+			want:  protocol.VideoModeOn,
+		},
+		{
+			name: "shutdown timeout",
+			set: func(ctx context.Context, c *protocol.SpeakerClient) error {
+				return c.SetShutdownTimeout(ctx, protocol.ShutdownNever)
+			},
+			check: func(s emulator.State) bool { return s.ShutdownTimeout == 0xff },
+			read:  func(ctx context.Context, c *protocol.SpeakerClient) (any, error) { return c.ReadShutdownTimeout(ctx) },
+			want:  protocol.ShutdownNever,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext(t)
+			speaker, client := newEmulatedClient(t, emulator.DefaultState, nil)
+
+			if err := tt.set(ctx, client); err != nil {
+				t.Fatalf("set error = %v", err)
+			}
+			if state := speaker.State(); !tt.check(state) {
+				t.Errorf("speaker state = %+v", state)
+			}
+			got, err := tt.read(ctx, client)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("read = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeakerClientReadsBatteryAndFirmware(t *testing.T) {
+	ctx := testContext(t)
+	speaker, client := newEmulatedClient(t, emulator.DefaultState, nil)
+	speaker.SetBattery(42)
+
+	battery, err := client.ReadBatteryLevel(ctx)
+	if err != nil || battery != 42 {
+		t.Errorf("ReadBatteryLevel() = %d, %v, want 42", battery, err)
+	}
+	firmware, err := client.ReadFirmwarePackageName(ctx)
+	if err != nil || firmware != emulator.DefaultFirmware {
+		t.Errorf("ReadFirmwarePackageName() = %q, %v, want %q", firmware, err, emulator.DefaultFirmware)
+	}
+
+	state := client.State().State()
+	if state.Battery == nil || *state.Battery != 42 || state.Firmware != emulator.DefaultFirmware {
+		t.Errorf("tracked state = %+v, want the battery and firmware that were read", state)
+	}
+}
+
+func TestSpeakerClientUnsupportedSettings(t *testing.T) {
+	ctx := testContext(t)
+	model := &protocol.Model{
+		Name:   "Test speaker",
+		Frames: protocol.UBoomX.Frames,
+		Capabilities: protocol.Capabilities{
+			BeepVolumes: []protocol.BeepVolume{protocol.BeepVolume0, protocol.BeepVolume100},
+		},
+	}
+	speaker, client := newEmulatedClient(t, emulator.DefaultState, model)
+	var frames []protocol.Frame
+	speaker.OnFrame(func(frame protocol.Frame) {
+		frames = append(frames, frame)
+	})
+
+	if err := client.SetVideoMode(ctx, protocol.VideoModeOn); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("SetVideoMode() error = %v, want ErrUnsupported", err)
+	}
+	if err := client.SetBeepVolume(ctx, protocol.BeepVolume50); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("SetBeepVolume(50%%) error = %v, want ErrUnsupported", err)
+	}
+	if _, err := client.ReadOluvMode(ctx); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("ReadOluvMode() error = %v, want ErrUnsupported", err)
+	}
+	if len(frames) != 0 {
+		t.Errorf("unsupported settings sent %v", frames)
+	}
+
+	if err := client.SetBeepVolume(ctx, protocol.BeepVolume100); err != nil {
+		t.Fatalf("SetBeepVolume(100%%) error = %v", err)
+	}
+	if state := speaker.State(); state.BeepVolume != byte(protocol.BeepVolume100) {
+		t.Errorf("beep volume = %02x, want 100%%", state.BeepVolume)
+	}
+}
+
+func TestSpeakerClientEvents(t *testing.T) {
+	speaker, client := newEmulatedClient(t, emulator.DefaultState, nil)
+	events, unsubscribe := client.Subscribe(protocol.FieldEvents(protocol.FieldOluvMode))
+	defer unsubscribe()
+
+	// a button press on the speaker
+	if err := speaker.Push(protocol.NewFrame(protocol.ClassRead, protocol.OpOluvMode, byte(protocol.OluvBoom))); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Value != protocol.OluvBoom {
+			t.Errorf("event value = %v, want %v", event.Value, protocol.OluvBoom)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	if mode := client.State().State().OluvMode; mode == nil || *mode != protocol.OluvBoom {
+		t.Errorf("tracked Oluv mode = %v, want %v", mode, protocol.OluvBoom)
+	}
+}
+
+func TestSpeakerClientDisconnect(t *testing.T) {
+	ctx := testContext(t)
+	speaker, client := newEmulatedClient(t, emulator.DefaultState, nil)
+	speaker.Disconnect()
+
+	if _, err := client.ReadBatteryLevel(ctx); err == nil {
+		t.Error("ReadBatteryLevel() of a disconnected speaker succeeded")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.State().State().Connection != protocol.StateClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection state = %s, want closed", client.State().State().Connection)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// once the read side has ended, requests fail with ErrConnectionClosed and keep the cause
+	_, err := client.ReadBatteryLevel(ctx)
+	if !errors.Is(err, protocol.ErrConnectionClosed) || !errors.Is(err, emulator.ErrDisconnected) {
+		t.Errorf("ReadBatteryLevel() after the disconnect = %v, want ErrConnectionClosed caused by ErrDisconnected", err)
+	}
+}
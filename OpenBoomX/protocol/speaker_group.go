@@ -0,0 +1,301 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"obx/protocol/eq"
+	"sync"
+)
+
+var (
+	ErrUnknownDevice = errors.New("speaker is not in the group")
+	ErrEmptyGroup    = errors.New("speaker group is empty")
+)
+
+// GroupResult is the outcome of a group command on one speaker.
+type GroupResult struct {
+	Device string
+	Err    error
+}
+
+// GroupResults are the results of a group command, in the order the speakers were added.
+type GroupResults []GroupResult
+
+// Err joins the errors of the speakers that failed, it is nil if all succeeded.
+func (results GroupResults) Err() error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.Device, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SpeakerGroup sends commands to several speakers in parallel.
+// It is an ISpeakerClient itself: commands are sent to every speaker, while reads, the state and
+// the events come from the first speaker, which is expected to be set up like the others.
+type SpeakerGroup struct {
+	mutex   sync.Mutex
+	devices []string
+	clients map[string]ISpeakerClient
+	// empty is the state of a group without speakers
+	empty *StateTracker
+}
+
+func NewSpeakerGroup() *SpeakerGroup {
+	return &SpeakerGroup{
+		clients: make(map[string]ISpeakerClient),
+		empty:   NewStateTracker(),
+	}
+}
+
+// Add adds the client of device, every device can only be added once.
+func (g *SpeakerGroup) Add(device string, client ISpeakerClient) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok := g.clients[device]; ok {
+		return fmt.Errorf("speaker %s is already in the group", device)
+	}
+	g.devices = append(g.devices, device)
+	g.clients[device] = client
+	return nil
+}
+
+// Remove removes device from the group and returns its client, which is not closed.
+func (g *SpeakerGroup) Remove(device string) (ISpeakerClient, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	client, ok := g.clients[device]
+	if !ok {
+		return nil, false
+	}
+	delete(g.clients, device)
+	for i, d := range g.devices {
+		if d == device {
+			g.devices = append(g.devices[:i], g.devices[i+1:]...)
+			break
+		}
+	}
+	return client, true
+}
+
+// Devices returns the devices in the order they were added.
+func (g *SpeakerGroup) Devices() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]string(nil), g.devices...)
+}
+
+// Client returns the client of device.
+func (g *SpeakerGroup) Client(device string) (ISpeakerClient, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	client, ok := g.clients[device]
+	return client, ok
+}
+
+// Do runs command on the given devices in parallel, or on all of them if devices is empty,
+// and waits until every speaker is done.
+func (g *SpeakerGroup) Do(ctx context.Context, devices []string, command func(ctx context.Context, client ISpeakerClient) error) GroupResults {
+	if len(devices) == 0 {
+		devices = g.Devices()
+	}
+
+	results := make(GroupResults, len(devices))
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		results[i].Device = device
+		client, ok := g.Client(device)
+		if !ok {
+			results[i].Err = ErrUnknownDevice
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].Err = command(ctx, client)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// broadcast runs command on all speakers, an empty group fails with ErrEmptyGroup.
+func (g *SpeakerGroup) broadcast(ctx context.Context, command func(ctx context.Context, client ISpeakerClient) error) error {
+	results := g.Do(ctx, nil, command)
+	if len(results) == 0 {
+		return ErrEmptyGroup
+	}
+	return results.Err()
+}
+
+// first returns the client of the first speaker, which answers the reads of the group.
+func (g *SpeakerGroup) first() (ISpeakerClient, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if len(g.devices) == 0 {
+		return nil, ErrEmptyGroup
+	}
+	return g.clients[g.devices[0]], nil
+}
+
+func (g *SpeakerGroup) SetEQ(ctx context.Context, curve eq.Curve) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SetEQ(ctx, curve)
+	})
+}
+
+func (g *SpeakerGroup) SetOluvMode(ctx context.Context, mode OluvMode) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SetOluvMode(ctx, mode)
+	})
+}
+
+func (g *SpeakerGroup) SetLight(ctx context.Context, light LightState) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SetLight(ctx, light)
+	})
+}
+
+func (g *SpeakerGroup) SetShutdownTimeout(ctx context.Context, timeout ShutdownTimeout) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SetShutdownTimeout(ctx, timeout)
+	})
+}
+
+func (g *SpeakerGroup) PowerOffSpeaker(ctx context.Context) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.PowerOffSpeaker(ctx)
+	})
+}
+
+func (g *SpeakerGroup) SetVideoMode(ctx context.Context, mode VideoMode) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SetVideoMode(ctx, mode)
+	})
+}
+
+func (g *SpeakerGroup) SetBeepVolume(ctx context.Context, volume BeepVolume) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SetBeepVolume(ctx, volume)
+	})
+}
+
+func (g *SpeakerGroup) SendMessage(ctx context.Context, hexMsg string) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SendMessage(ctx, hexMsg)
+	})
+}
+
+func (g *SpeakerGroup) SendFrame(ctx context.Context, frame Frame) error {
+	return g.broadcast(ctx, func(ctx context.Context, client ISpeakerClient) error {
+		return client.SendFrame(ctx, frame)
+	})
+}
+
+// CloseConnection closes the connections of all speakers, they stay in the group.
+func (g *SpeakerGroup) CloseConnection() error {
+	return g.Do(context.Background(), nil, func(ctx context.Context, client ISpeakerClient) error {
+		return client.CloseConnection()
+	}).Err()
+}
+
+// ReadBatteryLevel reads the battery of the first speaker, use Do to read every speaker.
+func (g *SpeakerGroup) ReadBatteryLevel(ctx context.Context) (int, error) {
+	client, err := g.first()
+	if err != nil {
+		return 0, err
+	}
+	return client.ReadBatteryLevel(ctx)
+}
+
+func (g *SpeakerGroup) ReadFirmwarePackageName(ctx context.Context) (string, error) {
+	client, err := g.first()
+	if err != nil {
+		return "", err
+	}
+	return client.ReadFirmwarePackageName(ctx)
+}
+
+func (g *SpeakerGroup) ReadOluvMode(ctx context.Context) (OluvMode, error) {
+	client, err := g.first()
+	if err != nil {
+		return 0, err
+	}
+	return client.ReadOluvMode(ctx)
+}
+
+func (g *SpeakerGroup) ReadCustomEQ(ctx context.Context) (eq.Curve, bool, error) {
+	client, err := g.first()
+	if err != nil {
+		return eq.Curve{}, false, err
+	}
+	return client.ReadCustomEQ(ctx)
+}
+
+func (g *SpeakerGroup) ReadLight(ctx context.Context) (LightState, error) {
+	client, err := g.first()
+	if err != nil {
+		return LightState{}, err
+	}
+	return client.ReadLight(ctx)
+}
+
+func (g *SpeakerGroup) ReadBeepVolume(ctx context.Context) (BeepVolume, error) {
+	client, err := g.first()
+	if err != nil {
+		return 0, err
+	}
+	return client.ReadBeepVolume(ctx)
+}
+
+func (g *SpeakerGroup) ReadVideoMode(ctx context.Context) (VideoMode, error) {
+	client, err := g.first()
+	if err != nil {
+		return 0, err
+	}
+	return client.ReadVideoMode(ctx)
+}
+
+func (g *SpeakerGroup) ReadShutdownTimeout(ctx context.Context) (ShutdownTimeout, error) {
+	client, err := g.first()
+	if err != nil {
+		return 0, err
+	}
+	return client.ReadShutdownTimeout(ctx)
+}
+
+// State returns the state tracker of the first speaker.
+func (g *SpeakerGroup) State() *StateTracker {
+	client, err := g.first()
+	if err != nil {
+		return g.empty
+	}
+	return client.State()
+}
+
+// Model returns the model of the first speaker, or the UBoomX if the group is empty.
+// Commands a speaker's model doesn't support fail for that speaker only.
+func (g *SpeakerGroup) Model() *Model {
+	client, err := g.first()
+	if err != nil {
+		return UBoomX
+	}
+	return client.Model()
+}
+
+// Subscribe returns the events of the first speaker.
+func (g *SpeakerGroup) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	client, err := g.first()
+	if err != nil {
+		events := make(chan Event)
+		close(events)
+		return events, func() {}
+	}
+	return client.Subscribe(filter)
+}
@@ -0,0 +1,155 @@
+package protocol_test
+
+import (
+	"context"
+	"errors"
+	"obx/protocol"
+	"obx/protocol/emulator"
+	"testing"
+	"time"
+)
+
+// newEmulatedGroup returns a group of emulated speakers named after the given devices, in that order.
+func newEmulatedGroup(t *testing.T, devices ...string) (*protocol.SpeakerGroup, []*emulator.Speaker) {
+	t.Helper()
+	group := protocol.NewSpeakerGroup()
+	var speakers []*emulator.Speaker
+	for _, device := range devices {
+		speaker, client := newEmulatedClient(t, emulator.DefaultState, nil)
+		if err := group.Add(device, client); err != nil {
+			t.Fatal(err)
+		}
+		speakers = append(speakers, speaker)
+	}
+	return group, speakers
+}
+
+func TestSpeakerGroupSetsEverySpeaker(t *testing.T) {
+	group, speakers := newEmulatedGroup(t, "first", "second", "third")
+	if err := group.SetOluvMode(testContext(t), protocol.OluvBoom); err != nil {
+		t.Fatal(err)
+	}
+	for i, speaker := range speakers {
+		if mode := speaker.State().OluvMode; mode != byte(protocol.OluvBoom) {
+			t.Errorf("speaker %d Oluv mode = %#x, want %#x", i, mode, protocol.OluvBoom)
+		}
+	}
+}
+
+func TestSpeakerGroupDoWithDisconnectedSpeaker(t *testing.T) {
+	group, speakers := newEmulatedGroup(t, "first", "second", "third")
+	speakers[1].Disconnect()
+
+	results := group.Do(testContext(t), nil, func(ctx context.Context, client protocol.ISpeakerClient) error {
+		return client.SetOluvMode(ctx, protocol.OluvOutdoor)
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if results[i].Device != want {
+			t.Errorf("result %d is of %s, want %s", i, results[i].Device, want)
+		}
+		if failed := results[i].Err != nil; failed != (want == "second") {
+			t.Errorf("result of %s error = %v", want, results[i].Err)
+		}
+	}
+	// the speakers that are connected are still set
+	for _, i := range []int{0, 2} {
+		if mode := speakers[i].State().OluvMode; mode != byte(protocol.OluvOutdoor) {
+			t.Errorf("speaker %d Oluv mode = %#x, want %#x", i, mode, protocol.OluvOutdoor)
+		}
+	}
+	if err := results.Err(); err == nil {
+		t.Error("Err() of a failed speaker is nil")
+	}
+	if err := group.SetOluvMode(testContext(t), protocol.OluvOutdoor); err == nil {
+		t.Error("SetOluvMode() with a disconnected speaker succeeded")
+	}
+}
+
+func TestSpeakerGroupDoUnknownDevice(t *testing.T) {
+	group, speakers := newEmulatedGroup(t, "first")
+
+	results := group.Do(testContext(t), []string{"first", "missing"}, func(ctx context.Context, client protocol.ISpeakerClient) error {
+		return client.SetOluvMode(ctx, protocol.OluvBoom)
+	})
+
+	if len(results) != 2 || results[0].Err != nil || !errors.Is(results[1].Err, protocol.ErrUnknownDevice) {
+		t.Errorf("results = %+v, want first to succeed and missing to fail with ErrUnknownDevice", results)
+	}
+	if !errors.Is(results.Err(), protocol.ErrUnknownDevice) {
+		t.Errorf("Err() = %v, want ErrUnknownDevice", results.Err())
+	}
+	if mode := speakers[0].State().OluvMode; mode != byte(protocol.OluvBoom) {
+		t.Errorf("Oluv mode = %#x, want %#x", mode, protocol.OluvBoom)
+	}
+}
+
+func TestSpeakerGroupEmpty(t *testing.T) {
+	ctx := testContext(t)
+	group := protocol.NewSpeakerGroup()
+
+	if results := group.Do(ctx, nil, func(ctx context.Context, client protocol.ISpeakerClient) error {
+		t.Error("command ran in an empty group")
+		return nil
+	}); len(results) != 0 || results.Err() != nil {
+		t.Errorf("Do() = %+v, want no results", results)
+	}
+	if err := group.SetOluvMode(ctx, protocol.OluvBoom); !errors.Is(err, protocol.ErrEmptyGroup) {
+		t.Errorf("SetOluvMode() = %v, want ErrEmptyGroup", err)
+	}
+	if _, err := group.ReadBatteryLevel(ctx); !errors.Is(err, protocol.ErrEmptyGroup) {
+		t.Errorf("ReadBatteryLevel() = %v, want ErrEmptyGroup", err)
+	}
+	if group.State() == nil || group.Model() != protocol.UBoomX {
+		t.Error("an empty group has no state or not the default model")
+	}
+	events, unsubscribe := group.Subscribe(protocol.FieldEvents(protocol.FieldOluvMode))
+	defer unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("events of an empty group aren't closed")
+	}
+}
+
+func TestSpeakerGroupReadsFromFirstSpeaker(t *testing.T) {
+	group, speakers := newEmulatedGroup(t, "first", "second")
+	speakers[0].SetBattery(40)
+	speakers[1].SetBattery(90)
+	ctx := testContext(t)
+
+	if level, err := group.ReadBatteryLevel(ctx); err != nil || level != 40 {
+		t.Errorf("ReadBatteryLevel() = %d, %v, want 40 of the first speaker", level, err)
+	}
+	first, _ := group.Client("first")
+	if group.State() != first.State() {
+		t.Error("State() isn't the state of the first speaker")
+	}
+
+	events, unsubscribe := group.Subscribe(protocol.FieldEvents(protocol.FieldOluvMode))
+	defer unsubscribe()
+	// a button press on the second speaker isn't an event of the group
+	if err := speakers[1].Push(protocol.NewFrame(protocol.ClassRead, protocol.OpOluvMode, byte(protocol.OluvGround))); err != nil {
+		t.Fatal(err)
+	}
+	if err := speakers[0].Push(protocol.NewFrame(protocol.ClassRead, protocol.OpOluvMode, byte(protocol.OluvBoom))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if event.Value != protocol.OluvBoom {
+			t.Errorf("event value = %v, want %v of the first speaker", event.Value, protocol.OluvBoom)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+
+	// once the first speaker is removed, the second one answers
+	if _, ok := group.Remove("first"); !ok {
+		t.Fatal("Remove() didn't find the first speaker")
+	}
+	if level, err := group.ReadBatteryLevel(ctx); err != nil || level != 90 {
+		t.Errorf("ReadBatteryLevel() = %d, %v, want 90 of the second speaker", level, err)
+	}
+}
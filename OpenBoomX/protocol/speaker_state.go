@@ -0,0 +1,282 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"obx/protocol/eq"
+	"os"
+	"slices"
+	"sync"
+)
+
+// SpeakerState is the last known state of the speaker. Nil fields and an empty firmware are not known yet.
+type SpeakerState struct {
+	OluvMode *OluvMode `json:"oluvMode,omitempty"`
+	// CustomEQ is set while the custom EQ is used instead of an Oluv's EQ mode
+	CustomEQ        *eq.Curve        `json:"customEQ,omitempty"`
+	Light           *LightState      `json:"light,omitempty"`
+	BeepVolume      *BeepVolume      `json:"beepVolume,omitempty"`
+	VideoMode       *VideoMode       `json:"videoMode,omitempty"`
+	ShutdownTimeout *ShutdownTimeout `json:"shutdownTimeout,omitempty"`
+	// Battery isn't persisted, it changes all the time and is outdated by the next connection
+	Battery    *int            `json:"-"`
+	Firmware   string          `json:"firmware,omitempty"`
+	Connection ConnectionState `json:"-"`
+}
+
+func (state SpeakerState) clone() SpeakerState {
+	state.CustomEQ = clonePointer(state.CustomEQ)
+	state.OluvMode = clonePointer(state.OluvMode)
+	state.Light = clonePointer(state.Light)
+	state.BeepVolume = clonePointer(state.BeepVolume)
+	state.VideoMode = clonePointer(state.VideoMode)
+	state.ShutdownTimeout = clonePointer(state.ShutdownTimeout)
+	state.Battery = clonePointer(state.Battery)
+	return state
+}
+
+func clonePointer[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	clone := *value
+	return &clone
+}
+
+// StateField names the part of the SpeakerState that changed.
+type StateField int
+
+const (
+	FieldOluvMode StateField = iota
+	FieldCustomEQ
+	FieldLight
+	FieldBeepVolume
+	FieldVideoMode
+	FieldShutdownTimeout
+	FieldBattery
+	FieldFirmware
+	FieldConnection
+)
+
+func (field StateField) String() string {
+	switch field {
+	case FieldOluvMode:
+		return "Oluv mode"
+	case FieldCustomEQ:
+		return "custom EQ"
+	case FieldLight:
+		return "light"
+	case FieldBeepVolume:
+		return "beep volume"
+	case FieldVideoMode:
+		return "video mode"
+	case FieldShutdownTimeout:
+		return "shutdown timeout"
+	case FieldBattery:
+		return "battery"
+	case FieldFirmware:
+		return "firmware"
+	case FieldConnection:
+		return "connection"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChange is sent to subscribers whenever a field of the SpeakerState changes.
+type StateChange struct {
+	Field StateField
+	// State is the whole state after the change
+	State SpeakerState
+	// FromSpeaker is true if the speaker reported the change, false if it was a command sent by this client
+	FromSpeaker bool
+}
+
+// StateTracker keeps the SpeakerState up to date from the frames sent to and received from the speaker.
+// With PersistTo the state is saved on every change of a setting or the firmware, so the last known state is available before connecting.
+type StateTracker struct {
+	mutex       sync.Mutex
+	state       SpeakerState
+	path        string
+	subscribers []chan StateChange
+}
+
+func NewStateTracker() *StateTracker {
+	return &StateTracker{}
+}
+
+// State returns a copy of the current state.
+func (t *StateTracker) State() SpeakerState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.state.clone()
+}
+
+// Subscribe returns a channel of state changes. Call the returned function to unsubscribe.
+func (t *StateTracker) Subscribe() (<-chan StateChange, func()) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	subscriber := make(chan StateChange, subscriberBufferSize)
+	t.subscribers = append(t.subscribers, subscriber)
+
+	return subscriber, func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		for i, sub := range t.subscribers {
+			if sub == subscriber {
+				t.subscribers = append(t.subscribers[:i], t.subscribers[i+1:]...)
+				close(subscriber)
+				return
+			}
+		}
+	}
+}
+
+// PersistTo loads the last known state from path, if it exists, and saves the state there on every change.
+func (t *StateTracker) PersistTo(path string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.path = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading speaker state: %w", err)
+	}
+
+	var state SpeakerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("error unmarshalling speaker state: %w", err)
+	}
+	state.Connection = t.state.Connection
+	state.Battery = t.state.Battery
+	t.state = state
+	return nil
+}
+
+// save must be called with the mutex held.
+func (t *StateTracker) save() {
+	if t.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		log.Printf("Error marshalling speaker state: %v", err)
+		return
+	}
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		log.Printf("Error writing speaker state: %v", err)
+	}
+}
+
+// update applies change to the state and notifies the subscribers about the given fields.
+func (t *StateTracker) update(fromSpeaker bool, change func(state *SpeakerState), fields ...StateField) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	change(&t.state)
+	if !slices.Equal(fields, []StateField{FieldBattery}) {
+		t.save()
+	}
+	for _, field := range fields {
+		t.notify(StateChange{Field: field, State: t.state.clone(), FromSpeaker: fromSpeaker})
+	}
+}
+
+// notify must be called with the mutex held.
+func (t *StateTracker) notify(change StateChange) {
+	for _, subscriber := range t.subscribers {
+		select {
+		case subscriber <- change:
+		default:
+			log.Printf("State subscriber is not keeping up, dropping %s change", change.Field)
+		}
+	}
+}
+
+// SetConnection updates the connection state, it isn't persisted.
+func (t *StateTracker) SetConnection(connection ConnectionState) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.state.Connection == connection {
+		return
+	}
+	t.state.Connection = connection
+	t.notify(StateChange{Field: FieldConnection, State: t.state.clone(), FromSpeaker: true})
+}
+
+// ApplySent updates the state from a frame that was sent successfully.
+func (t *StateTracker) ApplySent(frame Frame) {
+	if frame.Class == ClassWrite {
+		t.apply(frame, false)
+	}
+}
+
+// ApplyReceived updates the state from a frame the speaker sent.
+func (t *StateTracker) ApplyReceived(frame Frame) {
+	if frame.Class == ClassRead {
+		t.apply(frame, true)
+	}
+}
+
+// apply updates the state from a write or a read reply, frames that aren't a known setting are ignored.
+func (t *StateTracker) apply(frame Frame, fromSpeaker bool) {
+	field, value, ok := decodeSetting(frame)
+	if !ok {
+		return
+	}
+
+	switch field {
+	case FieldOluvMode:
+		mode := value.(OluvMode)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.OluvMode = &mode
+			state.CustomEQ = nil
+		}, FieldOluvMode, FieldCustomEQ)
+	case FieldCustomEQ:
+		if value == nil {
+			// the speaker uses an Oluv's EQ mode, which is reported separately
+			return
+		}
+		curve := value.(eq.Curve)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.CustomEQ = &curve
+			state.OluvMode = nil
+		}, FieldCustomEQ, FieldOluvMode)
+	case FieldLight:
+		light := value.(LightState)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.Light = &light
+		}, FieldLight)
+	case FieldBeepVolume:
+		volume := value.(BeepVolume)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.BeepVolume = &volume
+		}, FieldBeepVolume)
+	case FieldVideoMode:
+		mode := value.(VideoMode)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.VideoMode = &mode
+		}, FieldVideoMode)
+	case FieldShutdownTimeout:
+		timeout := value.(ShutdownTimeout)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.ShutdownTimeout = &timeout
+		}, FieldShutdownTimeout)
+	case FieldBattery:
+		level := value.(int)
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.Battery = &level
+		}, FieldBattery)
+	case FieldFirmware:
+		t.update(fromSpeaker, func(state *SpeakerState) {
+			state.Firmware = value.(string)
+		}, FieldFirmware)
+	}
+}
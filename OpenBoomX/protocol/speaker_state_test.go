@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateTrackerPersistsSettingsOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "speaker.json")
+	tracker := NewStateTracker()
+	if err := tracker.PersistTo(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker.ApplyReceived(NewFrame(ClassRead, OpBatteryLevel, 95))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("a battery reply wrote the state file, error = %v", err)
+	}
+
+	tracker.ApplySent(NewFrame(ClassWrite, OpOluvMode, byte(OluvBoom)))
+	loaded := NewStateTracker()
+	if err := loaded.PersistTo(path); err != nil {
+		t.Fatal(err)
+	}
+	state := loaded.State()
+	if state.OluvMode == nil || *state.OluvMode != OluvBoom {
+		t.Errorf("persisted Oluv mode = %v, want %v", state.OluvMode, OluvBoom)
+	}
+	if state.Battery != nil {
+		t.Errorf("persisted battery = %d, want none", *state.Battery)
+	}
+	if battery := tracker.State().Battery; battery == nil || *battery != 95 {
+		t.Errorf("tracked battery = %v, want 95", battery)
+	}
+}
@@ -0,0 +1,364 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrNotConnected = errors.New("speaker is not connected, reconnecting")
+
+// ErrReconnected is returned once by Supervisor.ReceiveMessage before data of a new connection.
+// Bytes buffered from the lost connection must be dropped, they can't be completed into frames anymore.
+var ErrReconnected = errors.New("speaker reconnected")
+
+type ConnectionState int
+
+const (
+	StateConnecting ConnectionState = iota
+	StateConnected
+	StateLost
+	StateClosed
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateLost:
+		return "lost"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Dialer opens a new connection to the speaker.
+type Dialer func(ctx context.Context) (RfcommClient, error)
+
+const (
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 30 * time.Second
+	dialTimeout         = 15 * time.Second
+	replayTimeout       = 5 * time.Second
+)
+
+// replaySlot groups the writes of which only the last one matters after a reconnect.
+// Custom EQ and Oluv's EQ modes override each other, so they share a slot.
+type replaySlot int
+
+const (
+	replaySound replaySlot = iota
+	replayLight
+	replayBeep
+	replaySlotCount
+)
+
+var replaySlots = map[byte]replaySlot{
+	OpCustomEQ:   replaySound,
+	OpOluvMode:   replaySound,
+	OpLight:      replayLight,
+	OpBeepVolume: replayBeep,
+}
+
+// Supervisor is an RfcommClient that keeps a connection to the speaker alive.
+// Any read or write error is treated as a lost connection, which is redialed with exponential backoff.
+// After reconnecting the last EQ, Oluv mode, light and beep settings are sent again.
+// Reads block while the connection is being reestablished, writes fail with ErrNotConnected until it is.
+type Supervisor struct {
+	dial      Dialer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mutex     sync.Mutex
+	conn      RfcommClient
+	connected chan struct{}
+	// generation counts the connections, it changes when conn is replaced
+	generation uint64
+	// readGeneration is the connection ReceiveMessage last read from, it is only used by the reader
+	readGeneration uint64
+	state          ConnectionState
+	settings       [replaySlotCount][]byte
+	subscribers    []chan ConnectionState
+}
+
+// NewSupervisor dials the first connection, an error is returned if that fails.
+func NewSupervisor(ctx context.Context, dial Dialer) (*Supervisor, error) {
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Supervisor{
+		dial:           dial,
+		conn:           conn,
+		connected:      make(chan struct{}),
+		generation:     1,
+		readGeneration: 1,
+		state:          StateConnected,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	close(s.connected)
+	return s, nil
+}
+
+// State returns the current connection state.
+func (s *Supervisor) State() ConnectionState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state
+}
+
+// Subscribe returns a channel of connection state changes.
+// The channel is closed when the supervisor is closed or the returned function is called.
+func (s *Supervisor) Subscribe() (<-chan ConnectionState, func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	subscriber := make(chan ConnectionState, subscriberBufferSize)
+	if s.state == StateClosed {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+	s.subscribers = append(s.subscribers, subscriber)
+
+	return subscriber, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		for i, sub := range s.subscribers {
+			if sub == subscriber {
+				s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+				close(subscriber)
+				return
+			}
+		}
+	}
+}
+
+// setState must be called with the mutex held.
+func (s *Supervisor) setState(state ConnectionState) {
+	if s.state == state {
+		return
+	}
+	s.state = state
+	for _, subscriber := range s.subscribers {
+		select {
+		case subscriber <- state:
+		default:
+			log.Printf("Connection state subscriber is not keeping up, dropping %s", state)
+		}
+	}
+}
+
+// waitConnection returns the current connection and its generation, waiting for a reconnect if needed.
+func (s *Supervisor) waitConnection(ctx context.Context) (RfcommClient, uint64, error) {
+	for {
+		s.mutex.Lock()
+		conn, generation, connected := s.conn, s.generation, s.connected
+		s.mutex.Unlock()
+
+		if conn != nil {
+			return conn, generation, nil
+		}
+
+		select {
+		case <-connected:
+		case <-s.ctx.Done():
+			return nil, 0, ErrConnectionClosed
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+// connectionLost closes conn and starts reconnecting, unless that already happened.
+func (s *Supervisor) connectionLost(conn RfcommClient, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn != conn || s.state == StateClosed {
+		return
+	}
+
+	log.Printf("Speaker connection lost: %v", err)
+	if closeErr := conn.CloseSocket(); closeErr != nil {
+		log.Printf("Error closing speaker connection: %v", closeErr)
+	}
+	s.conn = nil
+	s.connected = make(chan struct{})
+	s.setState(StateLost)
+
+	go s.reconnect()
+}
+
+func (s *Supervisor) reconnect() {
+	backoff := minReconnectBackoff
+	for {
+		s.mutex.Lock()
+		if s.state == StateClosed {
+			s.mutex.Unlock()
+			return
+		}
+		s.setState(StateConnecting)
+		s.mutex.Unlock()
+
+		err := s.dialAndReplay()
+		if err == nil {
+			return
+		}
+
+		log.Printf("Reconnecting failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxReconnectBackoff)
+	}
+}
+
+// dialAndReplay dials a new connection and sends the remembered settings before handing it out.
+// Settings remembered while replaying are sent as well, the connection is only set once nothing is left to send.
+func (s *Supervisor) dialAndReplay() error {
+	ctx, cancel := context.WithTimeout(s.ctx, dialTimeout)
+	defer cancel()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel = context.WithTimeout(s.ctx, replayTimeout)
+	defer cancel()
+
+	var replayed [replaySlotCount][]byte
+	for {
+		s.mutex.Lock()
+		if s.state == StateClosed {
+			s.mutex.Unlock()
+			_ = conn.CloseSocket()
+			return nil
+		}
+		var pending [][]byte
+		for slot, message := range s.settings {
+			if message != nil && !bytes.Equal(message, replayed[slot]) {
+				pending = append(pending, message)
+				replayed[slot] = message
+			}
+		}
+		if len(pending) == 0 {
+			s.conn = conn
+			s.generation++
+			close(s.connected)
+			s.setState(StateConnected)
+			s.mutex.Unlock()
+			return nil
+		}
+		s.mutex.Unlock()
+
+		for _, message := range pending {
+			if err := conn.SendMessage(ctx, message); err != nil {
+				_ = conn.CloseSocket()
+				return err
+			}
+		}
+	}
+}
+
+// remember keeps the message if it is a setting that should be replayed after a reconnect.
+func (s *Supervisor) remember(message []byte) {
+	frame, err := Decode(message)
+	if err != nil || frame.Class != ClassWrite {
+		return
+	}
+	slot, ok := replaySlots[frame.Opcode]
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.settings[slot] = append([]byte(nil), message...)
+}
+
+// SendMessage fails right away while reconnecting, the last settings are replayed once connected again.
+func (s *Supervisor) SendMessage(ctx context.Context, message []byte) error {
+	s.remember(message)
+
+	s.mutex.Lock()
+	conn, state := s.conn, s.state
+	s.mutex.Unlock()
+
+	if state == StateClosed {
+		return ErrConnectionClosed
+	}
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	err := conn.SendMessage(ctx, message)
+	if err != nil && ctx.Err() == nil {
+		s.connectionLost(conn, err)
+		return fmt.Errorf("%w: %w", ErrNotConnected, err)
+	}
+	return err
+}
+
+// ReceiveMessage blocks through reconnects until data arrives, ctx is done or the supervisor is closed.
+// It returns ErrReconnected once before the first data of a new connection, reading can continue after it.
+// ReceiveMessage must not be called concurrently.
+func (s *Supervisor) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	for {
+		conn, generation, err := s.waitConnection(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		if generation != s.readGeneration {
+			s.readGeneration = generation
+			return nil, 0, ErrReconnected
+		}
+
+		buf, n, err := conn.ReceiveMessage(ctx, bufferSize)
+		if err == nil && n > 0 {
+			return buf, n, nil
+		}
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		s.connectionLost(conn, err)
+	}
+}
+
+func (s *Supervisor) CloseSocket() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state == StateClosed {
+		return nil
+	}
+
+	s.cancel()
+	s.setState(StateClosed)
+	for _, subscriber := range s.subscribers {
+		close(subscriber)
+	}
+	s.subscribers = nil
+
+	var err error
+	if s.conn != nil {
+		err = s.conn.CloseSocket()
+		s.conn = nil
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeConn is a connection that returns the reads pushed into rx and keeps the sent messages.
+type fakeConn struct {
+	rx        chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+	mutex     sync.Mutex
+	sent      [][]byte
+	// onSend is called before a message is kept, a returned error fails the send
+	onSend func(message []byte) error
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{rx: make(chan []byte, 8), closed: make(chan struct{})}
+}
+
+func (c *fakeConn) SendMessage(ctx context.Context, message []byte) error {
+	if c.onSend != nil {
+		if err := c.onSend(message); err != nil {
+			return err
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sent = append(c.sent, slices.Clone(message))
+	return nil
+}
+
+func (c *fakeConn) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	select {
+	case data := <-c.rx:
+		return data, len(data), nil
+	case <-c.closed:
+		return nil, 0, io.EOF
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+func (c *fakeConn) CloseSocket() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeConn) Sent() [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.Clone(c.sent)
+}
+
+// fakeDialer hands out the connections in order.
+func fakeDialer(conns ...*fakeConn) Dialer {
+	var mutex sync.Mutex
+	return func(ctx context.Context) (RfcommClient, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(conns) == 0 {
+			return nil, errors.New("no more connections")
+		}
+		conn := conns[0]
+		conns = conns[1:]
+		return conn, nil
+	}
+}
+
+func mustEncode(t *testing.T, frame Frame) []byte {
+	t.Helper()
+	data, err := frame.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func waitState(t *testing.T, s *Supervisor, state ConnectionState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("state is %s, want %s", s.State(), state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisorSendErrorIsNotConnected(t *testing.T) {
+	first, second := newFakeConn(), newFakeConn()
+	first.onSend = func([]byte) error { return syscall.ECONNABORTED }
+
+	s, err := NewSupervisor(context.Background(), fakeDialer(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.CloseSocket()
+
+	err = s.SendMessage(context.Background(), mustEncode(t, NewBeepVolumeFrame(BeepVolume50)))
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("SendMessage() error = %v, want ErrNotConnected", err)
+	}
+	if !errors.Is(err, syscall.ECONNABORTED) {
+		t.Errorf("SendMessage() error = %v, want it to wrap the cause", err)
+	}
+
+	waitState(t, s, StateConnected)
+	if sent := second.Sent(); len(sent) != 1 || !slices.Equal(sent[0], mustEncode(t, NewBeepVolumeFrame(BeepVolume50))) {
+		t.Errorf("replayed %x, want the beep volume", sent)
+	}
+}
+
+func TestSupervisorReplaysSettingsRememberedDuringReplay(t *testing.T) {
+	first, second := newFakeConn(), newFakeConn()
+	beep := mustEncode(t, NewBeepVolumeFrame(BeepVolume25))
+	oluv := mustEncode(t, NewOluvModeFrame(OluvOutdoor))
+
+	s, err := NewSupervisor(context.Background(), fakeDialer(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.CloseSocket()
+
+	if err := s.SendMessage(context.Background(), beep); err != nil {
+		t.Fatal(err)
+	}
+
+	// the Oluv mode is set while the beep volume is being replayed
+	replaying := make(chan struct{})
+	resume := make(chan struct{})
+	var once sync.Once
+	second.onSend = func([]byte) error {
+		once.Do(func() {
+			close(replaying)
+			<-resume
+		})
+		return nil
+	}
+
+	_ = first.CloseSocket()
+	go func() {
+		_, _, _ = s.ReceiveMessage(context.Background(), MaxFrameSize)
+	}()
+
+	select {
+	case <-replaying:
+	case <-time.After(5 * time.Second):
+		t.Fatal("settings weren't replayed")
+	}
+	if err := s.SendMessage(context.Background(), oluv); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("SendMessage() while replaying error = %v, want ErrNotConnected", err)
+	}
+	close(resume)
+
+	waitState(t, s, StateConnected)
+	sent := second.Sent()
+	if len(sent) != 2 || !slices.Equal(sent[0], beep) || !slices.Equal(sent[1], oluv) {
+		t.Errorf("replayed %x, want the beep volume and the Oluv mode", sent)
+	}
+}
+
+func TestFrameScannerDropsPartialFrameOnReconnect(t *testing.T) {
+	first, second := newFakeConn(), newFakeConn()
+	s, err := NewSupervisor(context.Background(), fakeDialer(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.CloseSocket()
+
+	battery := NewFrame(ClassRead, OpBatteryLevel, 0x5f)
+	data := mustEncode(t, battery)
+	// half of a frame, then the connection drops
+	first.rx <- data[:3]
+	_ = first.CloseSocket()
+	second.rx <- data
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	frame, err := NewFrameScanner(s).Next(ctx)
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if frame.String() != battery.String() {
+		t.Errorf("Next() = %s, want %s", frame, battery)
+	}
+}
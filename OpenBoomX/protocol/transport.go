@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transport opens a connection to target, the part of a device URI after "scheme://".
+type Transport func(ctx context.Context, target string) (RfcommClient, error)
+
+var (
+	transportsMutex sync.RWMutex
+	transports      = map[string]Transport{}
+)
+
+func init() {
+	RegisterTransport("rfcomm", dialRfcomm)
+	RegisterTransport("tcp", netTransport("tcp"))
+	RegisterTransport("unix", netTransport("unix"))
+	RegisterTransport("replay", dialReplay)
+}
+
+// RegisterTransport makes a transport available to Dial under the given URI scheme.
+func RegisterTransport(scheme string, transport Transport) {
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+	transports[scheme] = transport
+}
+
+// TransportSchemes returns the registered URI schemes in alphabetical order.
+func TransportSchemes() []string {
+	transportsMutex.RLock()
+	defer transportsMutex.RUnlock()
+
+	schemes := make([]string, 0, len(transports))
+	for scheme := range transports {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Dial connects to a device URI such as rfcomm://F8:AB:E5:xx:xx:xx/2, tcp://host:port, unix:///path
+// or replay:///path/session.jsonl?speed=2.
+// A bare MAC address is treated as rfcomm://MAC on the default channel.
+func Dial(ctx context.Context, device string) (RfcommClient, error) {
+	scheme, target, found := strings.Cut(device, "://")
+	if !found {
+		if _, err := ParseMAC(device); err != nil {
+			return nil, fmt.Errorf("invalid device %q, expected a MAC address or a URI like rfcomm://MAC/channel", device)
+		}
+		scheme, target = "rfcomm", device
+	}
+
+	transportsMutex.RLock()
+	transport, ok := transports[scheme]
+	transportsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transport %q, available: %s", scheme, strings.Join(TransportSchemes(), ", "))
+	}
+	return transport(ctx, target)
+}
+
+// dialRfcomm connects to "MAC" or "MAC/channel".
+func dialRfcomm(ctx context.Context, target string) (RfcommClient, error) {
+	address, channel, err := parseRfcommTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewRfcommClientChannel(ctx, address, channel)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// parseRfcommTarget parses "MAC" or "MAC/channel", the channel is RfcommChannel if there is none.
+func parseRfcommTarget(target string) (address string, channel uint8, err error) {
+	address, channelStr, hasChannel := strings.Cut(target, "/")
+	if _, err := ParseMAC(address); err != nil {
+		return "", 0, err
+	}
+
+	channel = uint8(RfcommChannel)
+	if hasChannel {
+		if channel, err = ParseRfcommChannel(channelStr); err != nil {
+			return "", 0, err
+		}
+	}
+	return address, channel, nil
+}
+
+// ParseRfcommChannel parses the channel of an rfcomm:// URI, which must be between 1 and 30.
+func ParseRfcommChannel(text string) (uint8, error) {
+	channel, err := strconv.ParseUint(text, 10, 8)
+	if err != nil || channel < 1 || channel > 30 {
+		return 0, fmt.Errorf("invalid RFCOMM channel %q, must be between 1 and 30", text)
+	}
+	return uint8(channel), nil
+}
+
+func netTransport(network string) Transport {
+	return func(ctx context.Context, target string) (RfcommClient, error) {
+		client, err := NewNetClient(ctx, network, target)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+}
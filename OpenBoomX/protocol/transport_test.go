@@ -0,0 +1,146 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRfcommTarget(t *testing.T) {
+	tests := []struct {
+		target      string
+		wantAddress string
+		wantChannel uint8
+		wantErr     bool
+	}{
+		{target: "F8:AB:E5:00:00:01", wantAddress: "F8:AB:E5:00:00:01", wantChannel: RfcommChannel},
+		{target: "F8:AB:E5:00:00:01/1", wantAddress: "F8:AB:E5:00:00:01", wantChannel: 1},
+		{target: "F8:AB:E5:00:00:01/30", wantAddress: "F8:AB:E5:00:00:01", wantChannel: 30},
+		{target: "f8-ab-e5-00-00-01/5", wantAddress: "f8-ab-e5-00-00-01", wantChannel: 5},
+		{target: "F8:AB:E5:00:00:01/0", wantErr: true},
+		{target: "F8:AB:E5:00:00:01/31", wantErr: true},
+		{target: "F8:AB:E5:00:00:01/300", wantErr: true},
+		{target: "F8:AB:E5:00:00:01/xyz", wantErr: true},
+		{target: "F8:AB:E5:00:00:01/", wantErr: true},
+		{target: "F8:AB:E5:00:00/2", wantErr: true},
+		{target: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			address, channel, err := parseRfcommTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRfcommTarget(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+			if address != tt.wantAddress || channel != tt.wantChannel {
+				t.Errorf("parseRfcommTarget(%q) = %q, %d, want %q, %d", tt.target, address, channel, tt.wantAddress, tt.wantChannel)
+			}
+		})
+	}
+}
+
+// replaceTransport registers transport under scheme for the test, the previous one is restored afterwards.
+func replaceTransport(t *testing.T, scheme string, transport Transport) {
+	t.Helper()
+	transportsMutex.Lock()
+	previous, ok := transports[scheme]
+	transportsMutex.Unlock()
+	RegisterTransport(scheme, transport)
+	t.Cleanup(func() {
+		transportsMutex.Lock()
+		defer transportsMutex.Unlock()
+		if ok {
+			transports[scheme] = previous
+		} else {
+			delete(transports, scheme)
+		}
+	})
+}
+
+func TestDialSchemes(t *testing.T) {
+	var targets []string
+	replaceTransport(t, "rfcomm", func(ctx context.Context, target string) (RfcommClient, error) {
+		targets = append(targets, target)
+		return newFakeConn(), nil
+	})
+
+	tests := []struct {
+		device     string
+		wantTarget string
+	}{
+		// a bare MAC address is an rfcomm target on the default channel
+		{device: "F8:AB:E5:00:00:01", wantTarget: "F8:AB:E5:00:00:01"},
+		{device: "rfcomm://F8:AB:E5:00:00:01/5", wantTarget: "F8:AB:E5:00:00:01/5"},
+	}
+	for _, tt := range tests {
+		targets = nil
+		if _, err := Dial(context.Background(), tt.device); err != nil {
+			t.Errorf("Dial(%q) error = %v", tt.device, err)
+			continue
+		}
+		if !slices.Equal(targets, []string{tt.wantTarget}) {
+			t.Errorf("Dial(%q) dialed %q, want %q", tt.device, targets, tt.wantTarget)
+		}
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		device  string
+		wantErr string
+	}{
+		{device: "bogus://somewhere", wantErr: `unknown transport "bogus", available: replay, rfcomm, tcp, unix`},
+		{device: "speaker", wantErr: "expected a MAC address"},
+		{device: "F8:AB:E5:00:00", wantErr: "expected a MAC address"},
+		{device: "rfcomm://F8:AB:E5:00:00:01/0", wantErr: "must be between 1 and 30"},
+		{device: "rfcomm://F8:AB:E5:00:00:01/31", wantErr: "must be between 1 and 30"},
+		{device: "rfcomm://speaker/2", wantErr: "invalid MAC address"},
+		{device: "tcp://127.0.0.1", wantErr: "missing port"},
+		{device: "tcp://127.0.0.1:speaker", wantErr: "unknown port"},
+		{device: "tcp://127.0.0.1:99999", wantErr: "invalid port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			client, err := Dial(ctx, tt.device)
+			if err == nil {
+				_ = client.CloseSocket()
+				t.Fatalf("Dial(%q) succeeded", tt.device)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Dial(%q) error = %v, want it to contain %q", tt.device, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialTCP(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback network: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := Dial(context.Background(), "tcp://"+listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.CloseSocket()
+}
+
+func TestTransportSchemes(t *testing.T) {
+	if got, want := TransportSchemes(), []string{"replay", "rfcomm", "tcp", "unix"}; !slices.Equal(got, want) {
+		t.Errorf("TransportSchemes() = %v, want %v", got, want)
+	}
+
+	replaceTransport(t, "emulator", func(ctx context.Context, target string) (RfcommClient, error) {
+		return newFakeConn(), nil
+	})
+	if got, want := TransportSchemes(), []string{"emulator", "replay", "rfcomm", "tcp", "unix"}; !slices.Equal(got, want) {
+		t.Errorf("TransportSchemes() after registering emulator = %v, want %v", got, want)
+	}
+}
@@ -3,84 +3,77 @@
 package protocol
 
 import (
-	"encoding/hex"
+	"context"
 	"errors"
-	"fmt"
 	"golang.org/x/sys/unix"
-	"strconv"
-	"strings"
+	"os"
+	"sync"
 	"syscall"
 )
 
 type UnixClient struct {
-	fd      int
-	address string
+	file       *os.File
+	address    string
+	writeMutex sync.Mutex
 }
 
-func NewRfcommClient(address string) (*UnixClient, error) {
+func NewRfcommClient(ctx context.Context, address string) (*UnixClient, error) {
+	return NewRfcommClientChannel(ctx, address, RfcommChannel)
+}
+
+// NewRfcommClientChannel connects to the RFCOMM channel of address, cancelling ctx interrupts connecting.
+func NewRfcommClientChannel(ctx context.Context, address string, channel uint8) (*UnixClient, error) {
 	client := &UnixClient{}
 	client.address = address
-	fd, err := NewRfcommSocket(address, RfcommChannel)
+	file, err := NewRfcommSocket(ctx, address, channel)
 	if err != nil {
 		return nil, err
 	}
-	client.fd = fd
+	client.file = file
 	return client, nil
 }
 
-func (client *UnixClient) SendMessage(hexMsg string) error {
-	message, err := hex.DecodeString(hexMsg)
-	if err != nil {
-		return fmt.Errorf("failed to decode hex message: %w", err)
-	}
-
-	_, err = unix.Write(client.fd, message)
-	if err != nil {
-		return err
-	}
-	return nil
+// SendMessage writes the message, it returns early with the context error if ctx is done first.
+func (client *UnixClient) SendMessage(ctx context.Context, message []byte) error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	return writeContext(ctx, client.file, message)
 }
 
-func (client *UnixClient) ReceiveMessage(bufferSize int) ([]byte, int, error) {
-	buf := make([]byte, bufferSize)
-	n, err := unix.Read(client.fd, buf)
-	if err != nil {
-		return nil, n, err
-	}
-	return buf, n, nil
+// ReceiveMessage reads once from the socket, it returns early with the context error if ctx is done first.
+// It must not be called concurrently.
+func (client *UnixClient) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	return readContext(ctx, client.file, bufferSize)
 }
 
 func (client *UnixClient) CloseSocket() error {
-	return unix.Close(client.fd)
+	return client.file.Close()
 }
 
-func NewRfcommSocket(address string, channel uint8) (int, error) {
-	addr := str2ba(address)
-
-	fd, err := unix.Socket(syscall.AF_BLUETOOTH, syscall.SOCK_STREAM, unix.BTPROTO_RFCOMM)
+// NewRfcommSocket connects an RFCOMM socket, the returned file is non-blocking and registered with the runtime poller,
+// which gives us read and write deadlines.
+func NewRfcommSocket(ctx context.Context, address string, channel uint8) (*os.File, error) {
+	addr, err := str2ba(address)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	sockAddr := &unix.SockaddrRFCOMM{Addr: addr, Channel: channel}
-
-	err = unix.Connect(fd, sockAddr)
+	fd, err := unix.Socket(syscall.AF_BLUETOOTH, syscall.SOCK_STREAM, unix.BTPROTO_RFCOMM)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	return fd, nil
+	sockAddr := &unix.SockaddrRFCOMM{Addr: addr, Channel: channel}
+	return connectContext(ctx, fd, sockAddr, "rfcomm:"+address)
 }
 
 // str2ba converts MAC address string representation to little-endian byte array
-func str2ba(addr string) [6]byte {
-	a := strings.Split(addr, ":")
-	var b [6]byte
-	for i, tmp := range a {
-		u, _ := strconv.ParseUint(tmp, 16, 8)
-		b[len(b)-1-i] = byte(u)
+func str2ba(addr string) ([6]byte, error) {
+	mac, err := ParseMAC(addr)
+	if err != nil {
+		return [6]byte{}, err
 	}
-	return b
+	return mac.littleEndian(), nil
 }
 
 func IsSocketDisconnected(err error) bool {
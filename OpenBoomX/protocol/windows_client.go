@@ -3,24 +3,34 @@
 package protocol
 
 import (
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/windows"
 )
 
 type WindowsClient struct {
-	handle  windows.Handle
-	address string
+	handle     windows.Handle
+	address    string
+	writeMutex sync.Mutex
 }
 
-func NewRfcommClient(address string) (*WindowsClient, error) {
+func NewRfcommClient(ctx context.Context, address string) (*WindowsClient, error) {
+	return NewRfcommClientChannel(ctx, address, RfcommChannel)
+}
+
+// NewRfcommClientChannel connects to the RFCOMM channel of address. Winsock has no non-blocking connect for
+// Bluetooth sockets that could be cancelled, so ctx is only checked before connecting.
+func NewRfcommClientChannel(ctx context.Context, address string, channel uint8) (*WindowsClient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	client := &WindowsClient{}
 	client.address = address
-	handle, err := NewRfcommSocket(address, RfcommChannel)
+	handle, err := NewRfcommSocket(address, channel)
 	if err != nil {
 		return nil, err
 	}
@@ -28,33 +38,87 @@ func NewRfcommClient(address string) (*WindowsClient, error) {
 	return client, nil
 }
 
-func (c *WindowsClient) SendMessage(hexMsg string) error {
-	message, err := hex.DecodeString(hexMsg)
+// overlapped runs a WSASend or WSARecv as overlapped I/O and waits for it to complete or ctx to be done,
+// which cancels it with CancelIoEx. Unlike SO_SNDTIMEO and SO_RCVTIMEO, after which the state of the socket
+// is undefined, a cancelled operation leaves the socket usable. It returns the number of bytes transferred.
+func (c *WindowsClient) overlapped(ctx context.Context, start func(overlapped *windows.Overlapped) error) (uint32, error) {
+	done, err := windows.CreateEvent(nil, 1, 0, nil)
 	if err != nil {
-		return fmt.Errorf("failed to decode hex message: %w", err)
+		return 0, err
+	}
+	defer windows.CloseHandle(done)
+	cancelled, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(cancelled)
+	stop := context.AfterFunc(ctx, func() {
+		_ = windows.SetEvent(cancelled)
+	})
+	defer stop()
+
+	// the kernel uses the OVERLAPPED structure until the operation is done, so it must not live on the stack
+	overlapped := &windows.Overlapped{HEvent: done}
+	err = start(overlapped)
+	// WSA_IO_PENDING has the value of ERROR_IO_PENDING
+	if err != nil && !errors.Is(err, windows.ERROR_IO_PENDING) {
+		return 0, err
 	}
 
-	var bytesSent uint32
-	err = windows.WSASend(c.handle, &windows.WSABuf{Len: uint32(len(message)), Buf: &message[0]}, 1, &bytesSent, 0, nil, nil)
+	event, err := windows.WaitForMultipleObjects([]windows.Handle{done, cancelled}, false, windows.INFINITE)
 	if err != nil {
-		return fmt.Errorf("WSASend failed: %w", err)
+		return 0, err
+	}
+	if event == windows.WAIT_OBJECT_0+1 {
+		// the operation may complete anyway, its result is only known once the cancellation is done
+		_ = windows.CancelIoEx(c.handle, overlapped)
 	}
 
+	// the WSA variant keeps Winsock error codes like WSAECONNABORTED, see IsSocketDisconnected
+	var transferred, flags uint32
+	err = windows.WSAGetOverlappedResult(c.handle, overlapped, &transferred, true, &flags)
+	return transferred, err
+}
+
+// SendMessage writes the whole message, it returns early with the context error if ctx is done first.
+// A partial send is continued with the rest of the message.
+func (c *WindowsClient) SendMessage(ctx context.Context, message []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	for len(message) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wsaBuf := windows.WSABuf{Len: uint32(len(message)), Buf: &message[0]}
+		sent, err := c.overlapped(ctx, func(overlapped *windows.Overlapped) error {
+			return windows.WSASend(c.handle, &wsaBuf, 1, nil, 0, overlapped, nil)
+		})
+		if err != nil {
+			return contextError(ctx, fmt.Errorf("WSASend failed: %w", err))
+		}
+		message = message[sent:]
+	}
 	return nil
 }
 
-func (c *WindowsClient) ReceiveMessage(bufferSize int) ([]byte, int, error) {
+// ReceiveMessage reads once from the socket, it returns early with the context error if ctx is done first.
+// It must not be called concurrently.
+func (c *WindowsClient) ReceiveMessage(ctx context.Context, bufferSize int) ([]byte, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
 	buf := make([]byte, bufferSize)
-	var bytesReceived uint32
-	var flags uint32
 	wsaBuf := windows.WSABuf{Len: uint32(bufferSize), Buf: &buf[0]}
 
-	err := windows.WSARecv(c.handle, &wsaBuf, 1, &bytesReceived, &flags, nil, nil)
+	var flags uint32
+	received, err := c.overlapped(ctx, func(overlapped *windows.Overlapped) error {
+		return windows.WSARecv(c.handle, &wsaBuf, 1, nil, &flags, overlapped, nil)
+	})
 	if err != nil {
-		return nil, int(bytesReceived), fmt.Errorf("WSARecv failed: %w", err)
+		return nil, int(received), contextError(ctx, fmt.Errorf("WSARecv failed: %w", err))
 	}
-
-	return buf, int(bytesReceived), nil
+	return buf, int(received), nil
 }
 
 func (client *WindowsClient) CloseSocket() error {
@@ -67,20 +131,22 @@ func NewRfcommSocket(address string, channel uint8) (windows.Handle, error) {
 		return windows.InvalidHandle, err
 	}
 
-	handle, err := windows.Socket(windows.AF_BTH, windows.SOCK_STREAM, windows.BTHPROTO_RFCOMM)
+	sppGuid, err := windows.GUIDFromString("{" + SerialPortService.String() + "}")
 	if err != nil {
 		return windows.InvalidHandle, err
 	}
 
-	sppGuid, err := windows.GUIDFromString("{00001101-0000-1000-8000-00805f9b34fb}")
+	sockAddr := &windows.SockaddrBth{BtAddr: addr, ServiceClassId: sppGuid, Port: uint32(channel)}
+
+	handle, err := windows.Socket(windows.AF_BTH, windows.SOCK_STREAM, windows.BTHPROTO_RFCOMM)
 	if err != nil {
 		return windows.InvalidHandle, err
 	}
 
-	sockAddr := &windows.SockaddrBth{BtAddr: addr, ServiceClassId: sppGuid, Port: uint32(channel)}
-
 	err = windows.Connect(handle, sockAddr)
 	if err != nil {
+		// the socket is of no use after a failed connect, every dial and reconnect attempt opens a new one
+		_ = windows.Closesocket(handle)
 		return windows.InvalidHandle, err
 	}
 
@@ -92,19 +158,11 @@ func NewRfcommSocket(address string, channel uint8) (windows.Handle, error) {
 }
 
 func addrToUint64(addr string) (uint64, error) {
-	addr = strings.ReplaceAll(addr, ":", "")
-
-	bytes, err := hex.DecodeString(addr)
+	mac, err := ParseMAC(addr)
 	if err != nil {
 		return 0, err
 	}
-
-	var btAddr uint64
-	for i := 0; i < len(bytes); i++ {
-		btAddr = (btAddr << 8) | uint64(bytes[i])
-	}
-
-	return btAddr, nil
+	return mac.uint64(), nil
 }
 
 func IsSocketDisconnected(err error) bool {
@@ -2,38 +2,183 @@ package bluetooth
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"obx/protocol"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"time"
-
 	"tinygo.org/x/bluetooth"
 )
 
-func FindDeviceAddress(adapter *bluetooth.Adapter, deviceName string, timeout time.Duration) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+var (
+	errNoBlueZ       = errors.New("BlueZ is not available")
+	errNoKnownUBoomX = errors.New("no known speaker")
+)
+
+// DefaultScanDuration is how long Scan and the obx scan command look for speakers.
+const DefaultScanDuration = 10 * time.Second
+
+// Candidate is a Bluetooth device that may be a speaker, as last seen by Discover.
+type Candidate struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	// RSSI is the signal strength of the last advertisement in dBm
+	RSSI int16 `json:"rssi"`
+	// OUIMatch is set if the address starts with the OUI of a speaker model
+	OUIMatch bool `json:"ouiMatch"`
+	// Model is the name of the speaker model whose name the candidate advertises, see protocol.MatchModel
+	Model    string    `json:"model,omitempty"`
+	LastSeen time.Time `json:"lastSeen"`
+}
 
-	deviceAddrCh := make(chan string, 1)
+// IsSupported reports whether the candidate advertises the name of a supported speaker model.
+func (c Candidate) IsSupported() bool {
+	return c.Model != ""
+}
+
+// isEarFun reports whether a device is worth listing: a supported speaker, another EarFun device or an EarFun address.
+func (c Candidate) isEarFun() bool {
+	return c.OUIMatch || strings.HasPrefix(strings.ToLower(c.Name), "earfun")
+}
+
+func newCandidate(result bluetooth.ScanResult, seen time.Time) Candidate {
+	candidate := Candidate{
+		Address:  strings.ToUpper(result.Address.String()),
+		Name:     result.LocalName(),
+		RSSI:     result.RSSI,
+		LastSeen: seen,
+	}
+	if scanRewritesAddress && candidate.Name == protocol.UBoomXName2 {
+		// FIXME: a hack for getting the correct MAC address of the device, because scanning on windows doesn't seem to work correctly
+		candidate.Address = strings.Replace(candidate.Address, protocol.UBoomXOUI2, protocol.UBoomXOUI, 1)
+	}
+	candidate.match()
+	return candidate
+}
+
+// scanRewritesAddress is set where the speaker is only seen by its BLE name UBoomXName2, whose address
+// newCandidate rewrites to the one of the speaker. Elsewhere the speaker is found by its BR/EDR name
+// and a UBoomXName2 sighting has an address that can't be connected to.
+var scanRewritesAddress = runtime.GOOS == "windows"
+
+// match sets the model and OUIMatch of the candidate from its name and address.
+func (c *Candidate) match() {
+	c.Model = ""
+	c.OUIMatch = false
+	for _, model := range protocol.Models() {
+		if c.Model == "" && model.MatchesName(c.Name) && (scanRewritesAddress || c.Name != protocol.UBoomXName2) {
+			c.Model = model.Name
+		}
+		c.OUIMatch = c.OUIMatch || model.MatchesAddress(c.Address)
+	}
+}
+
+// Discover scans for duration, or until ctx is done, and calls found for every EarFun device while the scan is running.
+// A device is reported when it is first seen and again when its name or signal strength changes.
+// found is called by one goroutine at a time. Reaching duration isn't an error, canceling ctx returns its error.
+func Discover(ctx context.Context, duration time.Duration, found func(Candidate)) error {
+	adapter := bluetooth.DefaultAdapter
+	if err := adapter.Enable(); err != nil {
+		return err
+	}
+
+	scanCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	scanDone := make(chan struct{})
+	defer close(scanDone)
+	go func() {
+		select {
+		case <-scanCtx.Done():
+			_ = adapter.StopScan()
+		case <-scanDone:
+		}
+	}()
 
-	err := adapter.Scan(func(adapter *bluetooth.Adapter, device bluetooth.ScanResult) {
-		if ctx.Err() != nil {
-			adapter.StopScan()
+	seen := make(map[string]Candidate)
+	var mutex sync.Mutex
+	err := adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		candidate := newCandidate(result, time.Now())
+		if !candidate.isEarFun() {
 			return
 		}
 
-		name := device.LocalName()
-		if name == deviceName {
-			deviceAddrCh <- device.Address.String()
-			adapter.StopScan()
+		mutex.Lock()
+		defer mutex.Unlock()
+		if scanCtx.Err() != nil {
+			return
+		}
+		last, ok := seen[candidate.Address]
+		if ok && candidate.Name == "" {
+			// not every advertisement has the name
+			candidate.Name = last.Name
+			candidate.match()
+		}
+		seen[candidate.Address] = candidate
+		if !ok || last.Name != candidate.Name || last.RSSI != candidate.RSSI {
+			found(candidate)
 		}
 	})
-
 	if err != nil {
-		return "", err
+		return err
+	}
+	return ctx.Err()
+}
+
+// Scan discovers EarFun devices for duration and returns the latest sighting of each, see SortCandidates.
+func Scan(ctx context.Context, duration time.Duration) ([]Candidate, error) {
+	var candidates []Candidate
+	err := Discover(ctx, duration, func(candidate Candidate) {
+		candidates = MergeCandidate(candidates, candidate)
+	})
+	SortCandidates(candidates)
+	return candidates, err
+}
+
+// MergeCandidate replaces the earlier sighting of the candidate's device or appends it.
+func MergeCandidate(candidates []Candidate, candidate Candidate) []Candidate {
+	i := slices.IndexFunc(candidates, func(c Candidate) bool {
+		return c.Address == candidate.Address
+	})
+	if i < 0 {
+		return append(candidates, candidate)
 	}
+	candidates[i] = candidate
+	return candidates
+}
+
+// SortCandidates sorts supported speakers first, then by signal strength from the strongest.
+func SortCandidates(candidates []Candidate) {
+	slices.SortStableFunc(candidates, func(a, b Candidate) int {
+		if a.IsSupported() != b.IsSupported() {
+			if a.IsSupported() {
+				return -1
+			}
+			return 1
+		}
+		return int(b.RSSI) - int(a.RSSI)
+	})
+}
 
-	select {
-	case <-ctx.Done():
-		return "", ctx.Err()
-	case address := <-deviceAddrCh:
-		return address, nil
+// FindUBoomX returns the first supported speaker seen within timeout.
+func FindUBoomX(ctx context.Context, timeout time.Duration) (Candidate, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found Candidate
+	err := Discover(ctx, timeout, func(candidate Candidate) {
+		if found.Address == "" && candidate.IsSupported() {
+			found = candidate
+			cancel()
+		}
+	})
+	if found.Address != "" {
+		return found, nil
+	}
+	if err != nil {
+		return Candidate{}, err
 	}
+	return Candidate{}, fmt.Errorf("no supported speaker found within %s", timeout)
 }
@@ -0,0 +1,63 @@
+package bluetooth
+
+import (
+	"obx/protocol"
+	"testing"
+)
+
+func TestCandidateMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		rewrites  bool
+		candidate Candidate
+		model     string
+		ouiMatch  bool
+	}{
+		{
+			name:      "BR/EDR name",
+			candidate: Candidate{Name: protocol.UBoomXName, Address: "F8:AB:E5:00:00:01"},
+			model:     protocol.UBoomXName,
+			ouiMatch:  true,
+		},
+		{
+			name:      "BR/EDR name with rewritten addresses",
+			rewrites:  true,
+			candidate: Candidate{Name: protocol.UBoomXName, Address: "F8:AB:E5:00:00:01"},
+			model:     protocol.UBoomXName,
+			ouiMatch:  true,
+		},
+		{
+			name:      "BLE name",
+			candidate: Candidate{Name: protocol.UBoomXName2, Address: "C7:AB:E5:00:00:01"},
+			ouiMatch:  true,
+		},
+		{
+			name:      "BLE name with rewritten addresses",
+			rewrites:  true,
+			candidate: Candidate{Name: protocol.UBoomXName2, Address: "F8:AB:E5:00:00:01"},
+			model:     protocol.UBoomXName,
+			ouiMatch:  true,
+		},
+		{
+			name:      "other EarFun device",
+			candidate: Candidate{Name: "EarFun Air Pro 3", Address: "00:11:22:33:44:55"},
+		},
+		{
+			name:      "unnamed speaker address",
+			candidate: Candidate{Address: "F8:AB:E5:00:00:01"},
+			ouiMatch:  true,
+		},
+	}
+	rewrites := scanRewritesAddress
+	t.Cleanup(func() { scanRewritesAddress = rewrites })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanRewritesAddress = tt.rewrites
+			candidate := tt.candidate
+			candidate.match()
+			if candidate.Model != tt.model || candidate.OUIMatch != tt.ouiMatch {
+				t.Errorf("match() = model %q, OUI match %v, want %q, %v", candidate.Model, candidate.OUIMatch, tt.model, tt.ouiMatch)
+			}
+		})
+	}
+}
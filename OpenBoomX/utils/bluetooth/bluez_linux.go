@@ -0,0 +1,127 @@
+//go:build linux
+
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	bluezService         = "org.bluez"
+	bluezDeviceInterface = "org.bluez.Device1"
+	objectManagerMethod  = "org.freedesktop.DBus.ObjectManager.GetManagedObjects"
+)
+
+// BlueZDevice is a device BlueZ knows about, because it is paired, connected or was seen recently.
+type BlueZDevice struct {
+	Path      dbus.ObjectPath
+	Candidate Candidate
+	Paired    bool
+	Connected bool
+}
+
+// ListBlueZDevices returns the org.bluez.Device1 objects of the BlueZ daemon on conn.
+func ListBlueZDevices(conn *dbus.Conn) ([]BlueZDevice, error) {
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err := conn.Object(bluezService, "/").Call(objectManagerMethod, 0).Store(&objects)
+	if err != nil {
+		return nil, fmt.Errorf("error listing BlueZ devices: %w", err)
+	}
+
+	var devices []BlueZDevice
+	for path, interfaces := range objects {
+		properties, ok := interfaces[bluezDeviceInterface]
+		if !ok {
+			continue
+		}
+		device := BlueZDevice{
+			Path:      path,
+			Paired:    variantValue[bool](properties, "Paired"),
+			Connected: variantValue[bool](properties, "Connected"),
+		}
+		device.Candidate = newBlueZCandidate(
+			variantValue[string](properties, "Address"),
+			variantValue[string](properties, "Name"),
+			variantValue[string](properties, "Alias"),
+			variantValue[int16](properties, "RSSI"),
+		)
+		devices = append(devices, device)
+	}
+	slices.SortFunc(devices, func(a, b BlueZDevice) int {
+		return strings.Compare(string(a.Path), string(b.Path))
+	})
+	return devices, nil
+}
+
+// variantValue returns the property, or the zero value if it is missing or of another type.
+func variantValue[T any](properties map[string]dbus.Variant, name string) T {
+	value, _ := properties[name].Value().(T)
+	return value
+}
+
+func newBlueZCandidate(address string, name string, alias string, rssi int16) Candidate {
+	if name == "" {
+		// BlueZ only has the name once the device advertised it, the alias falls back to the address
+		name = alias
+	}
+	candidate := Candidate{
+		Address:  strings.ToUpper(address),
+		Name:     name,
+		RSSI:     rssi,
+		LastSeen: time.Now(),
+	}
+	candidate.match()
+	return candidate
+}
+
+// FindBlueZUBoomX returns a supported speaker BlueZ already knows, without scanning.
+// Connected speakers are preferred over paired ones, and devices named like a speaker model over renamed ones with its address.
+func FindBlueZUBoomX(conn *dbus.Conn) (Candidate, error) {
+	devices, err := ListBlueZDevices(conn)
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	devices = slices.DeleteFunc(devices, func(device BlueZDevice) bool {
+		// an EarFun address may be a renamed speaker, but not if it is named like another EarFun product
+		otherProduct := strings.HasPrefix(strings.ToLower(device.Candidate.Name), "earfun")
+		return !device.Candidate.IsSupported() && (!device.Candidate.OUIMatch || otherProduct)
+	})
+	if len(devices) == 0 {
+		return Candidate{}, errNoKnownUBoomX
+	}
+	slices.SortStableFunc(devices, func(a, b BlueZDevice) int {
+		return bluezRank(a) - bluezRank(b)
+	})
+	return devices[0].Candidate, nil
+}
+
+// bluezRank orders devices from the best match, a connected speaker, to an unpaired renamed one.
+func bluezRank(device BlueZDevice) int {
+	rank := 0
+	if !device.Connected {
+		rank += 4
+	}
+	if !device.Paired {
+		rank += 2
+	}
+	if !device.Candidate.IsSupported() {
+		rank++
+	}
+	return rank
+}
+
+// findKnownUBoomX asks BlueZ on the system bus for a supported speaker.
+func findKnownUBoomX() (Candidate, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return Candidate{}, errors.Join(errNoBlueZ, err)
+	}
+	defer conn.Close()
+	return FindBlueZUBoomX(conn)
+}
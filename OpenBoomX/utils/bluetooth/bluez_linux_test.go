@@ -0,0 +1,194 @@
+//go:build linux
+
+package bluetooth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"obx/protocol"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// busConfig is a session bus that lets anyone own any name, so the test can pretend to be BlueZ.
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startBus starts a private dbus-daemon and returns its address, the test is skipped if there is no dbus-daemon.
+func startBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(busConfig, dir)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("error reading the bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connectBus(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+type fakeDevice struct {
+	path      dbus.ObjectPath
+	address   string
+	name      string
+	paired    bool
+	connected bool
+}
+
+// fakeBlueZ is the ObjectManager of a BlueZ daemon with an adapter and the devices.
+type fakeBlueZ struct {
+	devices []fakeDevice
+}
+
+func (b *fakeBlueZ) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		"/org/bluez/hci0": {
+			"org.bluez.Adapter1": {"Address": dbus.MakeVariant("00:11:22:33:44:55")},
+		},
+	}
+	for _, device := range b.devices {
+		properties := map[string]dbus.Variant{
+			"Address":   dbus.MakeVariant(device.address),
+			"Alias":     dbus.MakeVariant(device.name),
+			"Paired":    dbus.MakeVariant(device.paired),
+			"Connected": dbus.MakeVariant(device.connected),
+		}
+		if device.name != "" {
+			properties["Name"] = dbus.MakeVariant(device.name)
+		} else {
+			// BlueZ falls back to the address for the alias of devices without a name
+			properties["Alias"] = dbus.MakeVariant(strings.ReplaceAll(device.address, ":", "-"))
+		}
+		objects[device.path] = map[string]map[string]dbus.Variant{bluezDeviceInterface: properties}
+	}
+	return objects, nil
+}
+
+// serveBlueZ exports the devices as org.bluez on the bus.
+func serveBlueZ(t *testing.T, address string, devices []fakeDevice) {
+	t.Helper()
+	conn := connectBus(t, address)
+	if err := conn.Export(&fakeBlueZ{devices: devices}, "/", "org.freedesktop.DBus.ObjectManager"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(bluezService, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("error owning %s: %v (reply %d)", bluezService, err, reply)
+	}
+}
+
+func TestFindBlueZUBoomX(t *testing.T) {
+	address := startBus(t)
+
+	paired := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_01", address: "F8:AB:E5:00:00:01", name: "EarFun UBOOM X", paired: true}
+	connected := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_02", address: "F8:AB:E5:00:00:02", name: "EarFun UBOOM X", paired: true, connected: true}
+	unpaired := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_03", address: "F8:AB:E5:00:00:03", name: "EarFun UBOOM X"}
+	renamed := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_04", address: "F8:AB:E5:00:00:04", name: "Garden speaker", paired: true}
+	otherProduct := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_05", address: "F8:AB:E5:00:00:05", name: "EarFun Air Pro 3", paired: true, connected: true}
+	wrongName := fakeDevice{path: "/org/bluez/hci0/dev_00_1A_7D_00_00_06", address: "00:1A:7D:00:00:06", name: "Kitchen radio", paired: true, connected: true}
+
+	tests := []struct {
+		name    string
+		devices []fakeDevice
+		want    string
+		wantErr error
+	}{
+		{name: "paired", devices: []fakeDevice{paired}, want: paired.address},
+		{name: "connected before paired", devices: []fakeDevice{paired, connected}, want: connected.address},
+		{name: "unpaired", devices: []fakeDevice{unpaired}, want: unpaired.address},
+		{name: "paired before unpaired", devices: []fakeDevice{unpaired, paired}, want: paired.address},
+		{name: "renamed speaker", devices: []fakeDevice{renamed}, want: renamed.address},
+		{name: "speaker name before renamed", devices: []fakeDevice{renamed, paired}, want: paired.address},
+		{name: "other EarFun product", devices: []fakeDevice{otherProduct}, wantErr: errNoKnownUBoomX},
+		{name: "wrong name", devices: []fakeDevice{wrongName}, wantErr: errNoKnownUBoomX},
+		{name: "wrong name and speaker", devices: []fakeDevice{wrongName, otherProduct, unpaired}, want: unpaired.address},
+		{name: "no devices", wantErr: errNoKnownUBoomX},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveBlueZ(t, address, tt.devices)
+			candidate, err := FindBlueZUBoomX(connectBus(t, address))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindBlueZUBoomX() = %+v, %v, want error %v", candidate, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindBlueZUBoomX() error = %v", err)
+			}
+			if candidate.Address != tt.want {
+				t.Errorf("FindBlueZUBoomX() = %s, want %s", candidate.Address, tt.want)
+			}
+		})
+	}
+}
+
+func TestListBlueZDevices(t *testing.T) {
+	address := startBus(t)
+	device := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_01", address: "f8:ab:e5:00:00:01", name: "EarFun UBOOM X", paired: true}
+	nameless := fakeDevice{path: "/org/bluez/hci0/dev_F8_AB_E5_00_00_02", address: "F8:AB:E5:00:00:02"}
+	serveBlueZ(t, address, []fakeDevice{nameless, device})
+
+	devices, err := ListBlueZDevices(connectBus(t, address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("ListBlueZDevices() returned %d devices, want the 2 devices without the adapter", len(devices))
+	}
+	if got := devices[0]; got.Path != device.path || got.Candidate.Address != "F8:AB:E5:00:00:01" || !got.Paired ||
+		got.Connected || got.Candidate.Model != protocol.UBoomX.Name {
+		t.Errorf("devices[0] = %+v", got)
+	}
+	if got := devices[1]; got.Candidate.Name != "F8-AB-E5-00-00-02" || !got.Candidate.OUIMatch || got.Candidate.IsSupported() {
+		t.Errorf("devices[1] = %+v, want the alias as its name", got)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package bluetooth
+
+// findKnownUBoomX looks up a speaker the system already knows, which is only supported with BlueZ on Linux.
+func findKnownUBoomX() (Candidate, error) {
+	return Candidate{}, errNoBlueZ
+}
@@ -0,0 +1,194 @@
+package bluetooth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"obx/protocol"
+	"obx/utils/registry"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sdpTimeout bounds looking up the RFCOMM channel, the connection itself has the rest of the dial context
+	sdpTimeout = 5 * time.Second
+	// sdpRetryInterval is how long the fallback channel is used after a failed SDP lookup before looking it up again,
+	// so reconnecting to a speaker that is out of range doesn't wait for the lookup every time
+	sdpRetryInterval = 2 * time.Minute
+)
+
+var (
+	connectedChannelsMutex sync.Mutex
+	// connectedChannels are the channels speakers were connected on last by this process
+	connectedChannels = map[protocol.MAC]ResolvedChannel{}
+
+	failedLookupsMutex sync.Mutex
+	// failedLookups are the fallback channels of the speakers whose SDP lookup failed recently
+	failedLookups = map[protocol.MAC]failedLookup{}
+)
+
+type failedLookup struct {
+	fallback ResolvedChannel
+	at       time.Time
+}
+
+// ChannelSource tells where the RFCOMM channel of a speaker came from.
+type ChannelSource string
+
+const (
+	ChannelFromURI      ChannelSource = "device URI"
+	ChannelFromRegistry ChannelSource = "registry"
+	ChannelFromSDP      ChannelSource = "SDP"
+	ChannelFallback     ChannelSource = "fallback"
+)
+
+// ResolvedChannel is the RFCOMM channel a speaker is connected on.
+type ResolvedChannel struct {
+	Address protocol.MAC
+	Channel uint8
+	Source  ChannelSource
+	// Err is why the channel couldn't be resolved if it is the fallback
+	Err error
+}
+
+func (resolved ResolvedChannel) String() string {
+	if resolved.Err != nil {
+		return fmt.Sprintf("%d (%s: %v)", resolved.Channel, resolved.Source, resolved.Err)
+	}
+	return fmt.Sprintf("%d (%s)", resolved.Channel, resolved.Source)
+}
+
+// URI returns the device URI of the speaker on the channel, see protocol.Dial.
+func (resolved ResolvedChannel) URI() string {
+	return fmt.Sprintf("rfcomm://%s/%d", resolved.Address, resolved.Channel)
+}
+
+// ResolveUBoomXChannel returns the RFCOMM channel of a MAC address or rfcomm:// URI: the channel given in the URI,
+// the one cached in the registry or the one in the speaker's SDP records, which is cached then. refresh skips the cache.
+// protocol.RfcommChannel is the fallback if the SDP lookup fails, which is kept for sdpRetryInterval unless refresh is set.
+// ok is false for devices that aren't Bluetooth speakers, an error is returned for a URI with an invalid channel.
+func ResolveUBoomXChannel(ctx context.Context, device string, refresh bool) (resolved ResolvedChannel, ok bool, err error) {
+	address, ok := protocol.DeviceMAC(device)
+	if !ok {
+		return ResolvedChannel{}, false, nil
+	}
+	resolved.Address = address
+
+	if target, found := strings.CutPrefix(device, "rfcomm://"); found {
+		if _, channel, hasChannel := strings.Cut(target, "/"); hasChannel {
+			resolved.Channel, err = protocol.ParseRfcommChannel(channel)
+			if err != nil {
+				return ResolvedChannel{}, true, err
+			}
+			resolved.Source = ChannelFromURI
+			return resolved, true, nil
+		}
+	}
+
+	known, err := registry.Open()
+	if err != nil {
+		log.Println(err)
+	}
+	if known != nil && !refresh {
+		if device, found := known.Find(address.String()); found && device.RfcommChannel != 0 {
+			resolved.Channel, resolved.Source = device.RfcommChannel, ChannelFromRegistry
+			return resolved, true, nil
+		}
+	}
+
+	if fallback, found := recentFailedLookup(address); found && !refresh {
+		return fallback, true, nil
+	}
+
+	sdpCtx, cancel := context.WithTimeout(ctx, sdpTimeout)
+	defer cancel()
+	channel, err := protocol.ResolveRfcommChannel(sdpCtx, address, protocol.SerialPortService)
+	if err != nil {
+		resolved.Channel, resolved.Source, resolved.Err = protocol.RfcommChannel, ChannelFallback, err
+		// a canceled dial says nothing about the speaker
+		if ctx.Err() == nil {
+			setFailedLookup(address, &resolved)
+		}
+		return resolved, true, nil
+	}
+	setFailedLookup(address, nil)
+	resolved.Channel, resolved.Source = channel, ChannelFromSDP
+	if known != nil {
+		err := known.Update(address, func(device *registry.Device) error {
+			device.RfcommChannel = channel
+			return nil
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return resolved, true, nil
+}
+
+// recentFailedLookup returns the fallback channel of a speaker whose SDP lookup failed less than sdpRetryInterval ago.
+func recentFailedLookup(address protocol.MAC) (ResolvedChannel, bool) {
+	failedLookupsMutex.Lock()
+	defer failedLookupsMutex.Unlock()
+	failed, found := failedLookups[address]
+	if !found || time.Since(failed.at) >= sdpRetryInterval {
+		return ResolvedChannel{}, false
+	}
+	return failed.fallback, true
+}
+
+// setFailedLookup keeps the fallback channel after a failed SDP lookup, nil forgets it after a successful one.
+func setFailedLookup(address protocol.MAC, fallback *ResolvedChannel) {
+	failedLookupsMutex.Lock()
+	defer failedLookupsMutex.Unlock()
+	if fallback == nil {
+		delete(failedLookups, address)
+		return
+	}
+	failedLookups[address] = failedLookup{fallback: *fallback, at: time.Now()}
+}
+
+// dialUBoomXChannel connects to a Bluetooth speaker on its resolved channel, see ResolveUBoomXChannel.
+// If the cached channel doesn't connect anymore, for example because a firmware update moved the service,
+// the channel is resolved again.
+func dialUBoomXChannel(ctx context.Context, device string) (protocol.RfcommClient, error) {
+	resolved, ok, err := ResolveUBoomXChannel(ctx, device, false)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return protocol.Dial(ctx, device)
+	}
+	log.Printf("Connecting to %s on RFCOMM channel %s", resolved.Address, resolved)
+
+	rfcomm, err := protocol.Dial(ctx, resolved.URI())
+	if err != nil && resolved.Source == ChannelFromRegistry {
+		fresh, _, _ := ResolveUBoomXChannel(ctx, device, true)
+		if fresh.Source == ChannelFromSDP && fresh.Channel != resolved.Channel {
+			log.Printf("RFCOMM channel of %s moved to %s", resolved.Address, fresh)
+			resolved = fresh
+			rfcomm, err = protocol.Dial(ctx, resolved.URI())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	connectedChannelsMutex.Lock()
+	defer connectedChannelsMutex.Unlock()
+	connectedChannels[resolved.Address] = resolved
+	return rfcomm, nil
+}
+
+// ConnectedChannel returns the RFCOMM channel the speaker was connected on last by this process.
+func ConnectedChannel(device string) (ResolvedChannel, bool) {
+	address, ok := protocol.DeviceMAC(device)
+	if !ok {
+		return ResolvedChannel{}, false
+	}
+	connectedChannelsMutex.Lock()
+	defer connectedChannelsMutex.Unlock()
+	resolved, ok := connectedChannels[address]
+	return resolved, ok
+}
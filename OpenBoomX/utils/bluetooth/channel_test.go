@@ -0,0 +1,65 @@
+package bluetooth
+
+import (
+	"context"
+	"obx/protocol"
+	"testing"
+	"time"
+)
+
+func TestResolveUBoomXChannelKeepsFallback(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	const device = "F8:AB:E5:00:00:42"
+	address, _ := protocol.DeviceMAC(device)
+	t.Cleanup(func() { setFailedLookup(address, nil) })
+
+	// nothing answers the SDP lookup in the test environment
+	first, ok, err := ResolveUBoomXChannel(context.Background(), device, false)
+	if err != nil || !ok || first.Source != ChannelFallback || first.Channel != protocol.RfcommChannel || first.Err == nil {
+		t.Fatalf("ResolveUBoomXChannel() = %v, want the fallback channel", first)
+	}
+
+	second, _, _ := ResolveUBoomXChannel(context.Background(), device, false)
+	if second != first {
+		t.Errorf("ResolveUBoomXChannel() = %v, want the fallback of the failed lookup %v", second, first)
+	}
+
+	// the failed lookup is retried after sdpRetryInterval
+	failedLookupsMutex.Lock()
+	failed := failedLookups[address]
+	failed.at = time.Now().Add(-sdpRetryInterval)
+	failedLookups[address] = failed
+	failedLookupsMutex.Unlock()
+	if _, found := recentFailedLookup(address); found {
+		t.Error("a failed lookup is kept longer than sdpRetryInterval")
+	}
+}
+
+func TestResolveUBoomXChannelFromURI(t *testing.T) {
+	resolved, ok, err := ResolveUBoomXChannel(context.Background(), "rfcomm://F8:AB:E5:00:00:42/5", false)
+	if err != nil || !ok || resolved.Channel != 5 || resolved.Source != ChannelFromURI {
+		t.Errorf("ResolveUBoomXChannel() = %v, %v, want channel 5 from the URI", resolved, err)
+	}
+	if _, ok, err := ResolveUBoomXChannel(context.Background(), "tcp://127.0.0.1:1234", false); ok || err != nil {
+		t.Errorf("ResolveUBoomXChannel() resolved a TCP device, error %v", err)
+	}
+}
+
+func TestResolveUBoomXChannelInvalidURIChannel(t *testing.T) {
+	for _, device := range []string{
+		"rfcomm://F8:AB:E5:00:00:42/xyz",
+		"rfcomm://F8:AB:E5:00:00:42/300",
+		"rfcomm://F8:AB:E5:00:00:42/31",
+		"rfcomm://F8:AB:E5:00:00:42/0",
+		"rfcomm://F8:AB:E5:00:00:42/",
+	} {
+		// an invalid channel isn't replaced by the registry's or the SDP lookup's
+		if resolved, _, err := ResolveUBoomXChannel(context.Background(), device, false); err == nil {
+			t.Errorf("ResolveUBoomXChannel(%q) = %v, want an error", device, resolved)
+		}
+		if _, err := dialUBoomXChannel(context.Background(), device); err == nil {
+			t.Errorf("dialUBoomXChannel(%q) succeeded", device)
+		}
+	}
+}
@@ -1,51 +1,237 @@
 package bluetooth
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"obx/protocol"
-	"runtime"
-	"strings"
+	"obx/utils"
+	"obx/utils/registry"
+	"sync"
 	"time"
-	"tinygo.org/x/bluetooth"
 )
 
-func GetUBoomXAddress() (string, error) {
-	adapter := bluetooth.DefaultAdapter
-	if err := adapter.Enable(); err != nil {
-		return "", err
+// GetUBoomX returns a speaker the system already knows, like a connected audio sink on Linux,
+// or scans for the first speaker in range, see FindUBoomX.
+func GetUBoomX(ctx context.Context) (Candidate, error) {
+	candidate, err := findKnownUBoomX()
+	if err == nil {
+		return candidate, nil
 	}
+	if !errors.Is(err, errNoBlueZ) && !errors.Is(err, errNoKnownUBoomX) {
+		log.Printf("Error looking up known speakers, scanning: %v", err)
+	}
+	return FindUBoomX(ctx, 5*time.Second)
+}
 
-	if runtime.GOOS == "windows" {
-		address, err := FindDeviceAddress(adapter, protocol.UBoomXName2, 5*time.Second)
+// UBoomXDialer returns a dialer for a MAC address or device URI, see protocol.Dial and SelectUBoomX.
+// Bluetooth speakers are connected on the RFCOMM channel resolved by ResolveUBoomXChannel.
+func UBoomXDialer(device string) protocol.Dialer {
+	return func(ctx context.Context) (protocol.RfcommClient, error) {
+		rfcomm, err := dialUBoomXChannel(ctx, device)
 		if err != nil {
-			return "", err
+			return nil, fmt.Errorf("is device already connected to speaker?: %w", err)
 		}
-		// FIXME: a hack for getting the correct MAC address of the device, because scanning on windows doesn't seem to work correctly
-		address = strings.Replace(address, protocol.UBoomXOUI2, protocol.UBoomXOUI, 1)
-		return address, nil
+		return rfcomm, nil
 	}
+}
 
-	address, err := FindDeviceAddress(adapter, protocol.UBoomXName, 5*time.Second)
+// SelectUBoomX returns the device to connect to. A nickname is replaced with the address of the known speaker,
+// MAC addresses and URIs are kept, and an empty device is the speaker connected last, which sets last.
+// Empty is returned if no speaker is known yet.
+func SelectUBoomX(device string) (selected string, last bool, err error) {
+	known, err := registry.Open()
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+	if device != "" {
+		selected, err = known.Resolve(device)
+		return selected, false, err
 	}
-	return address, nil
+	if lastConnected, ok := known.LastConnected(); ok {
+		return lastConnected.Address.String(), true, nil
+	}
+	return "", false, nil
 }
 
-func ConnectUBoomX() (protocol.ISpeakerClient, error) {
-	address, err := GetUBoomXAddress()
+// connectUBoomX connects to the selected device, see SelectUBoomX. Without a known speaker, or if the speaker
+// connected last can't be reached, the first speaker in range is scanned for. It returns the device it connected to,
+// which is remembered in the registry with its model if it is a Bluetooth speaker.
+func connectUBoomX[T any](ctx context.Context, device string, connect func(ctx context.Context, device string) (T, error)) (T, string, error) {
+	var result T
+	selected, last, err := SelectUBoomX(device)
+	if err != nil {
+		return result, "", err
+	}
+	// model is the model a scan found, the registry knows the model of the other speakers
+	model := ""
+	if selected == "" {
+		candidate, err := GetUBoomX(ctx)
+		if err != nil {
+			return result, "", fmt.Errorf("is speaker not connected?: %w", err)
+		}
+		selected, model = candidate.Address, candidate.Model
+	}
+
+	result, err = connect(ctx, selected)
+	if err != nil && last {
+		log.Printf("Could not connect to the last speaker %s, scanning: %v", selected, err)
+		if candidate, scanErr := GetUBoomX(ctx); scanErr != nil {
+			log.Printf("Error scanning for a speaker: %v", scanErr)
+		} else if candidate.Address != selected {
+			selected, model = candidate.Address, candidate.Model
+			result, err = connect(ctx, selected)
+		}
+	}
 	if err != nil {
-		err = fmt.Errorf("is speaker not connected?: %w", err)
-		return nil, err
+		return result, selected, err
+	}
+
+	if err := rememberUBoomX(selected, model); err != nil {
+		log.Println(err)
 	}
+	return result, selected, nil
+}
 
-	rfcomm, err := protocol.NewRfcommClient(address)
+// rememberUBoomX records that device was connected, devices that aren't Bluetooth speakers are ignored.
+// An empty model keeps the known model, or matches one by the address, see ModelOf.
+func rememberUBoomX(device string, model string) error {
+	address, ok := protocol.DeviceMAC(device)
+	if !ok {
+		return nil
+	}
+	known, err := registry.Open()
 	if err != nil {
-		err = fmt.Errorf("is device already connected to speaker?: %w", err)
-		return nil, err
+		return err
+	}
+	return known.Update(address, func(device *registry.Device) error {
+		if model != "" {
+			device.Model = model
+		} else if device.Model == "" {
+			device.Model = modelOf(device.Address, "").Name
+		}
+		device.LastConnected = time.Now()
+		return nil
+	})
+}
+
+// ModelOf returns the model profile of a device: the model the registry has for a Bluetooth speaker, the model
+// with the OUI of its address, or protocol.UBoomX for speakers that can't be matched, like emulators.
+func ModelOf(device string) *protocol.Model {
+	address, ok := protocol.DeviceMAC(device)
+	if !ok {
+		return protocol.UBoomX
 	}
+	name := ""
+	if known, err := registry.Open(); err != nil {
+		log.Println(err)
+	} else if knownDevice, ok := known.Find(address.String()); ok {
+		name = knownDevice.Model
+	}
+	return modelOf(address, name)
+}
 
-	client := protocol.NewSpeakerClient(rfcomm)
+func modelOf(address protocol.MAC, name string) *protocol.Model {
+	if model, ok := protocol.ModelByName(name); ok {
+		return model
+	}
+	if model, ok := protocol.MatchModel("", address.String()); ok {
+		return model
+	}
+	return protocol.UBoomX
+}
 
-	return client, nil
+// RememberFirmware reads the firmware of the speaker and keeps it in the registry, see SelectUBoomX.
+func RememberFirmware(ctx context.Context, client protocol.ISpeakerClient, device string) error {
+	if _, ok := protocol.DeviceMAC(device); !ok {
+		return nil
+	}
+	firmware, err := client.ReadFirmwarePackageName(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading firmware: %w", err)
+	}
+	return RecordFirmware(device, firmware)
+}
+
+// RecordFirmware keeps the firmware the speaker reported in the registry, devices that aren't Bluetooth speakers are ignored.
+func RecordFirmware(device string, firmware string) error {
+	address, ok := protocol.DeviceMAC(device)
+	if !ok {
+		return nil
+	}
+	known, err := registry.Open()
+	if err != nil {
+		return err
+	}
+	return known.Update(address, func(device *registry.Device) error {
+		device.Firmware = firmware
+		return nil
+	})
+}
+
+// DialUBoomX opens a connection to the device, see connectUBoomX, and returns the device it connected to.
+func DialUBoomX(ctx context.Context, device string) (protocol.RfcommClient, string, error) {
+	return connectUBoomX(ctx, device, func(ctx context.Context, device string) (protocol.RfcommClient, error) {
+		return UBoomXDialer(device)(ctx)
+	})
+}
+
+// SuperviseUBoomX connects to the speaker through a protocol.Supervisor, which reconnects when the connection drops.
+// It returns the device it connected to, see connectUBoomX.
+func SuperviseUBoomX(ctx context.Context, device string) (*protocol.Supervisor, string, error) {
+	return connectUBoomX(ctx, device, func(ctx context.Context, device string) (*protocol.Supervisor, error) {
+		return protocol.NewSupervisor(ctx, UBoomXDialer(device))
+	})
+}
+
+// ConnectUBoomX returns a client of the device and the device it connected to, see connectUBoomX.
+func ConnectUBoomX(ctx context.Context, device string) (protocol.ISpeakerClient, string, error) {
+	rfcomm, selected, err := DialUBoomX(ctx, device)
+	if err != nil {
+		return nil, selected, err
+	}
+	return protocol.NewSpeakerClient(rfcomm, ModelOf(selected)), selected, nil
+}
+
+// ConnectUBoomXGroup connects to all devices in parallel and persists their state, see PersistState.
+// The group holds the speakers that could be connected, results has the outcome of every device.
+func ConnectUBoomXGroup(ctx context.Context, devices []string) (group *protocol.SpeakerGroup, results protocol.GroupResults) {
+	group = protocol.NewSpeakerGroup()
+	results = make(protocol.GroupResults, len(devices))
+	clients := make([]protocol.ISpeakerClient, len(devices))
+	selected := make([]string, len(devices))
+
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		results[i].Device = device
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients[i], selected[i], results[i].Err = ConnectUBoomX(ctx, device)
+		}()
+	}
+	wg.Wait()
+
+	for i, client := range clients {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := PersistState(client, selected[i]); err != nil {
+			log.Printf("Error keeping state of %s: %v", devices[i], err)
+		}
+		if results[i].Err = group.Add(devices[i], client); results[i].Err != nil {
+			_ = client.CloseConnection()
+		}
+	}
+	return group, results
+}
+
+// PersistState loads the last known state of device into client and keeps saving it, see utils.DeviceStatePath.
+func PersistState(client protocol.ISpeakerClient, device string) error {
+	path, err := utils.DeviceStatePath(device)
+	if err != nil {
+		return err
+	}
+	return client.State().PersistTo(path)
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// AppName names the config directory and the GUI window, see gui/constants.
+const AppName = "OpenBoomX"
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ConfigPath returns the OpenBoomX directory in the user config directory without creating it, see ConfigDir.
+func ConfigPath(subdirs ...string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user config directory: %w", err)
+	}
+	return filepath.Join(append([]string{configDir, AppName}, subdirs...)...), nil
+}
+
+// ConfigDir returns the OpenBoomX directory in the user config directory, it is created if it doesn't exist.
+func ConfigDir(subdirs ...string) (string, error) {
+	dir, err := ConfigPath(subdirs...)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating config directory: %w", err)
+	}
+	return dir, nil
+}
+
+// DeviceStatePath returns the file the last known state of a device is kept in.
+// An empty device, which means scanning for the speaker, has a file of its own.
+func DeviceStatePath(device string) (string, error) {
+	dir, err := ConfigDir("devices")
+	if err != nil {
+		return "", err
+	}
+
+	name := unsafeFileChars.ReplaceAllString(device, "_")
+	if device == "" {
+		name = "scanned"
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
@@ -4,8 +4,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"image/color"
-	"sort"
-	"strconv"
 )
 
 func Must(action string, err error) {
@@ -19,34 +17,13 @@ func IsValidHex(s string) bool {
 	return err == nil
 }
 
-func SortedKeysByValue(m map[string]string) []string {
-	keys := make([]string, 0, len(m))
-	for key := range m {
-		keys = append(keys, key)
+// Names returns the names of values, in the same order.
+func Names[T fmt.Stringer](values []T) []string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = value.String()
 	}
-	sort.Slice(keys, func(i, j int) bool {
-		return m[keys[i]] < m[keys[j]]
-	})
-	return keys
-}
-
-func SortedKeysByValueInt(m map[int]string) []string {
-	keys := make([]int, 0, len(m))
-	for key := range m {
-		keys = append(keys, key)
-	}
-
-	sort.Slice(keys, func(i, j int) bool {
-		return m[keys[i]] < m[keys[j]]
-	})
-
-	keysStr := make([]string, len(m))
-
-	for i, k := range keys {
-		keysStr[i] = strconv.Itoa(k)
-	}
-
-	return keysStr
+	return names
 }
 
 func NrgbaToHex(c color.NRGBA) string {
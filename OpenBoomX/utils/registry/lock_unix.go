@@ -0,0 +1,32 @@
+//go:build unix
+
+package registry
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// lockFile takes an exclusive lock of the file at path, which is created if it doesn't exist, until unlock is called.
+func lockFile(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fd := int(file.Fd())
+	for {
+		err = unix.Flock(fd, unix.LOCK_EX)
+		if !errors.Is(err, unix.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unix.Flock(fd, unix.LOCK_UN)
+		file.Close()
+	}, nil
+}
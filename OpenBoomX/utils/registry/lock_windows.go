@@ -0,0 +1,25 @@
+//go:build windows
+
+package registry
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// lockFile takes an exclusive lock of the file at path, which is created if it doesn't exist, until unlock is called.
+func lockFile(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	handle := windows.Handle(file.Fd())
+	if err := windows.LockFileEx(handle, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		_ = windows.UnlockFileEx(handle, 0, 1, 0, &windows.Overlapped{})
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,237 @@
+// Package registry remembers the speakers OpenBoomX connected to, so they can be reconnected without scanning
+// and picked by nickname.
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"obx/protocol"
+	"obx/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileName = "registry.json"
+
+// fileMutex serializes the changes of registries in this process, the lock file next to the registry those of
+// other processes. Each change reloads the file first.
+var fileMutex sync.Mutex
+
+// Device is a known speaker.
+type Device struct {
+	Address  protocol.MAC `json:"address"`
+	Nickname string       `json:"nickname,omitempty"`
+	// Model is the name the speaker advertises, like "EarFun UBOOM X"
+	Model string `json:"model,omitempty"`
+	// Firmware is the firmware package name the speaker reported last
+	Firmware string `json:"firmware,omitempty"`
+	// RfcommChannel is the channel resolved from the speaker's SDP records, zero if it wasn't resolved yet
+	RfcommChannel uint8     `json:"rfcommChannel,omitempty"`
+	LastConnected time.Time `json:"lastConnected"`
+}
+
+// Name returns the nickname, or the address if there is none.
+func (device Device) Name() string {
+	if device.Nickname != "" {
+		return device.Nickname
+	}
+	return device.Address.String()
+}
+
+// Registry is the list of known speakers kept in a JSON file.
+type Registry struct {
+	path    string
+	devices []Device
+}
+
+// Open loads the registry in the OpenBoomX config directory. The directory is only created once the registry is changed.
+func Open() (*Registry, error) {
+	dir, err := utils.ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return Load(filepath.Join(dir, fileName))
+}
+
+// Load loads the registry kept in path, a missing file is an empty registry.
+func Load(path string) (*Registry, error) {
+	registry := &Registry{path: path}
+	if err := registry.load(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+func (r *Registry) load() error {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		r.devices = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading device registry: %w", err)
+	}
+	var devices []Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return fmt.Errorf("error parsing device registry %s: %w", r.path, err)
+	}
+	r.devices = devices
+	return nil
+}
+
+// lock creates the directory of the registry and locks the registry against changes by this and other processes
+// until unlock is called.
+func (r *Registry) lock() (unlock func(), err error) {
+	fileMutex.Lock()
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		fileMutex.Unlock()
+		return nil, fmt.Errorf("error creating config directory: %w", err)
+	}
+	unlockFile, err := lockFile(r.path + ".lock")
+	if err != nil {
+		fileMutex.Unlock()
+		return nil, fmt.Errorf("error locking device registry: %w", err)
+	}
+	return func() {
+		unlockFile()
+		fileMutex.Unlock()
+	}, nil
+}
+
+// save replaces the registry file, readers that don't lock the registry see either the old or the new file.
+// It must be called with the registry locked.
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r.devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling device registry: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(r.path), fileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing device registry: %w", err)
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), r.path)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("error writing device registry: %w", err)
+	}
+	return nil
+}
+
+// Devices returns the known speakers, the last connected first.
+func (r *Registry) Devices() []Device {
+	devices := slices.Clone(r.devices)
+	slices.SortStableFunc(devices, func(a, b Device) int {
+		return b.LastConnected.Compare(a.LastConnected)
+	})
+	return devices
+}
+
+// Find returns the speaker with the given nickname, ignoring case, or address.
+func (r *Registry) Find(name string) (Device, bool) {
+	address, err := protocol.ParseMAC(name)
+	for _, device := range r.devices {
+		if (err == nil && device.Address == address) || (device.Nickname != "" && strings.EqualFold(device.Nickname, name)) {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// LastConnected returns the speaker that was connected last.
+func (r *Registry) LastConnected() (Device, bool) {
+	devices := r.Devices()
+	if len(devices) == 0 || devices[0].LastConnected.IsZero() {
+		return Device{}, false
+	}
+	return devices[0], true
+}
+
+// Resolve replaces a nickname with the address of its speaker. MAC addresses, URIs and the empty device are returned as they are.
+func (r *Registry) Resolve(device string) (string, error) {
+	if device == "" || strings.Contains(device, "://") {
+		return device, nil
+	}
+	if _, err := protocol.ParseMAC(device); err == nil {
+		return device, nil
+	}
+	if known, ok := r.Find(device); ok {
+		return known.Address.String(), nil
+	}
+	return "", fmt.Errorf("unknown device %q, expected a MAC address, a URI or the nickname of a known speaker", device)
+}
+
+// Update changes the speaker with the given address, which is added if it isn't known yet, and saves the registry.
+func (r *Registry) Update(address protocol.MAC, update func(device *Device) error) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(r.devices, func(device Device) bool {
+		return device.Address == address
+	})
+	if i < 0 {
+		r.devices = append(r.devices, Device{Address: address})
+		i = len(r.devices) - 1
+	}
+	if err := update(&r.devices[i]); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// SetNickname names the speaker, an empty nickname removes it. Nicknames are unique and can't look like an address or URI.
+func (r *Registry) SetNickname(address protocol.MAC, nickname string) error {
+	nickname = strings.TrimSpace(nickname)
+	if nickname != "" {
+		if _, err := protocol.ParseMAC(nickname); err == nil || strings.Contains(nickname, "://") {
+			return fmt.Errorf("invalid nickname %q, it looks like a device address", nickname)
+		}
+	}
+
+	return r.Update(address, func(device *Device) error {
+		for _, other := range r.devices {
+			if nickname != "" && other.Address != address && strings.EqualFold(other.Nickname, nickname) {
+				return fmt.Errorf("nickname %q is already used by %s", nickname, other.Address)
+			}
+		}
+		device.Nickname = nickname
+		return nil
+	})
+}
+
+// Forget removes the speaker.
+func (r *Registry) Forget(address protocol.MAC) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(r.devices, func(device Device) bool {
+		return device.Address == address
+	})
+	if i < 0 {
+		return fmt.Errorf("%s is not a known speaker", address)
+	}
+	r.devices = slices.Delete(r.devices, i, i+1)
+	return r.save()
+}
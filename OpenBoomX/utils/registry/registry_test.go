@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"obx/protocol"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOpenDoesNotCreateConfigDir(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("HOME", config)
+	t.Setenv("AppData", config)
+
+	registry, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.LastConnected(); ok {
+		t.Error("an empty registry has a last connected speaker")
+	}
+	if entries, err := os.ReadDir(config); err != nil || len(entries) != 0 {
+		t.Errorf("config directory has %v, %v after Open, want nothing", entries, err)
+	}
+}
+
+func TestUpdateKeepsConcurrentChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", fileName)
+	const speakers = 20
+
+	var wg sync.WaitGroup
+	for i := range speakers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every change loads a registry of its own, like separate processes do
+			registry, err := Load(path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			address := protocol.MAC{0xf8, 0xab, 0xe5, 0, 0, byte(i)}
+			if err := registry.Update(address, func(device *Device) error { return nil }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	registry, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devices := registry.Devices(); len(devices) != speakers {
+		t.Errorf("registry has %d speakers, want %d", len(devices), speakers)
+	}
+}
+
+func TestLockFileExcludesOtherLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json.lock")
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		// a lock of another open file, which is what another process has
+		unlockOther, err := lockFile(path)
+		if err != nil {
+			t.Error(err)
+			unlockOther = func() {}
+		}
+		locked <- unlockOther
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("the file was locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case unlockOther := <-locked:
+		unlockOther()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't released")
+	}
+}